@@ -0,0 +1,358 @@
+// Package api defines the JSON shapes of the public REST API and generates its
+// OpenAPI document. Handlers convert database models from the structs package into
+// these DTOs so that schema changes do not leak into the API.
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+type User struct {
+	ID        string `json:"id"`
+	UserName  string `json:"user_name"`
+	AvatarURL string `json:"avatar_url"`
+	TeamID    int    `json:"team_id"`
+}
+
+type Contact struct {
+	Phone            string `json:"phone"`
+	EmergencyContact string `json:"emergency_contact"`
+}
+
+type Team struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Color     string  `json:"color"`
+	Icon      string  `json:"icon"`
+	Motto     string  `json:"motto"`
+	CaptainID *string `json:"captain_id"`
+	GameID    *int    `json:"game_id"`
+}
+
+type TeamDetail struct {
+	Team    Team   `json:"team"`
+	Members []User `json:"members"`
+}
+
+type UserDetail struct {
+	UserProfile User `json:"user_profile"`
+	Team        Team `json:"team"`
+}
+
+type Me struct {
+	UserProfile User    `json:"user_profile"`
+	Contact     Contact `json:"contact"`
+	Role        string  `json:"role"`
+	Team        Team    `json:"team"`
+	TeamMembers []User  `json:"team_members"`
+}
+
+type Profile struct {
+	UserProfile User    `json:"user_profile"`
+	Contact     Contact `json:"contact"`
+}
+
+type Geolocation struct {
+	ID        int       `json:"id"`
+	UserID    string    `json:"user_id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Coarsened bool      `json:"coarsened"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TeamPosition is the latest location of a team, as shown on the map.
+type TeamPosition struct {
+	Team        Team        `json:"team"`
+	Members     []User      `json:"members"`
+	Geolocation Geolocation `json:"geolocation"`
+}
+
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type CreatedAPIToken struct {
+	// Token は発行時のこのレスポンスでしか返さない
+	Token    string   `json:"token"`
+	APIToken APIToken `json:"api_token"`
+}
+
+type RetentionRun struct {
+	ID             int       `json:"id"`
+	GameID         int       `json:"game_id"`
+	Mode           string    `json:"mode"`
+	Affected       int64     `json:"affected"`
+	RecordedBefore time.Time `json:"recorded_before"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AuditLog is one entry of the audit log. Before and After hold the changed fields.
+type AuditLog struct {
+	ID         int             `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorID    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+}
+
+// Health is the body of /healthz and /readyz. Checks maps each readiness check to
+// "ok" or the reason it failed.
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type Account struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Export struct {
+	ExportedAt   time.Time     `json:"exported_at"`
+	Account      Account       `json:"account"`
+	UserProfile  User          `json:"user_profile"`
+	Contact      Contact       `json:"contact"`
+	Team         Team          `json:"team"`
+	Geolocations []Geolocation `json:"geolocations"`
+	APITokens    []APIToken    `json:"api_tokens"`
+}
+
+// Request bodies
+
+type GeolocationRequest struct {
+	Latitude  *float64 `json:"latitude" openapi:"required"`
+	Longitude *float64 `json:"longitude" openapi:"required"`
+}
+
+type UserNameRequest struct {
+	Name string `json:"name"`
+}
+
+type ProfileUpdateRequest struct {
+	UserName         *string `json:"user_name" form:"user_name"`
+	Avatar           *string `json:"avatar" form:"avatar"`
+	Phone            *string `json:"phone" form:"phone"`
+	EmergencyContact *string `json:"emergency_contact" form:"emergency_contact"`
+}
+
+type TeamUpdateRequest struct {
+	Name      *string `json:"name"`
+	Color     *string `json:"color"`
+	Icon      *string `json:"icon"`
+	Motto     *string `json:"motto"`
+	CaptainID *string `json:"captain_id"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// Conversions from database models
+
+// avatarURL turns the stored avatar into a URL. Avatars served by this server are
+// stored as a key relative to /api/v1 (see lib.AvatarKey) and get basePath, the URL
+// path the app is served under, so they keep working when the base path changes.
+// Older rows may still hold an external URL, which is returned as it is.
+func avatarURL(basePath string, stored string) string {
+	if strings.HasPrefix(stored, lib.AvatarKeyPrefix) {
+		return basePath + "/api/v1/" + stored
+	}
+	return stored
+}
+
+// NewUser and the other conversions that include users take the base path for the
+// avatar URLs.
+func NewUser(p *structs.UserProfile, basePath string) User {
+	return User{
+		ID:        p.ID,
+		UserName:  p.UserName,
+		AvatarURL: avatarURL(basePath, p.AvatarURL),
+		TeamID:    p.TeamID,
+	}
+}
+
+func NewUsers(profiles []structs.UserProfile, basePath string) []User {
+	users := make([]User, 0, len(profiles))
+	for i := range profiles {
+		users = append(users, NewUser(&profiles[i], basePath))
+	}
+	return users
+}
+
+func NewContact(p *structs.UserProfile) Contact {
+	return Contact{
+		Phone:            p.Phone,
+		EmergencyContact: p.EmergencyContact,
+	}
+}
+
+func NewProfile(p *structs.UserProfile, basePath string) Profile {
+	return Profile{
+		UserProfile: NewUser(p, basePath),
+		Contact:     NewContact(p),
+	}
+}
+
+func NewProfiles(profiles []structs.UserProfile, basePath string) []Profile {
+	result := make([]Profile, 0, len(profiles))
+	for i := range profiles {
+		result = append(result, NewProfile(&profiles[i], basePath))
+	}
+	return result
+}
+
+func NewTeam(t *structs.Team) Team {
+	return Team{
+		ID:        t.ID,
+		Name:      t.Name,
+		Color:     t.Color,
+		Icon:      t.Icon,
+		Motto:     t.Motto,
+		CaptainID: t.CaptainID,
+		GameID:    t.GameID,
+	}
+}
+
+func NewTeamDetail(d *structs.TeamDetail, basePath string) TeamDetail {
+	return TeamDetail{
+		Team:    NewTeam(&d.Team),
+		Members: NewUsers(d.Members, basePath),
+	}
+}
+
+func NewUserDetail(d *structs.UserDetail, basePath string) UserDetail {
+	return UserDetail{
+		UserProfile: NewUser(&d.UserProfile, basePath),
+		Team:        NewTeam(&d.Team),
+	}
+}
+
+func NewGeolocation(g *structs.Geolocation) Geolocation {
+	return Geolocation{
+		ID:        g.ID,
+		UserID:    g.UserID,
+		Latitude:  g.Latitude,
+		Longitude: g.Longitude,
+		Coarsened: g.Coarsened,
+		CreatedAt: g.CreatedAt,
+	}
+}
+
+func NewGeolocations(geolocations []structs.Geolocation) []Geolocation {
+	result := make([]Geolocation, 0, len(geolocations))
+	for i := range geolocations {
+		result = append(result, NewGeolocation(&geolocations[i]))
+	}
+	return result
+}
+
+func NewTeamPositions(details []structs.GeolocationDetail, basePath string) []TeamPosition {
+	positions := make([]TeamPosition, 0, len(details))
+	for i := range details {
+		positions = append(positions, TeamPosition{
+			Team:        NewTeam(&details[i].TeamDetail.Team),
+			Members:     NewUsers(details[i].TeamDetail.Members, basePath),
+			Geolocation: NewGeolocation(&details[i].Geolocation),
+		})
+	}
+	return positions
+}
+
+func NewAPIToken(t *structs.APIToken) APIToken {
+	return APIToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Scopes:     lib.ParseScopes(t.Scopes),
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+	}
+}
+
+func NewAPITokens(tokens []structs.APIToken) []APIToken {
+	result := make([]APIToken, 0, len(tokens))
+	for i := range tokens {
+		result = append(result, NewAPIToken(&tokens[i]))
+	}
+	return result
+}
+
+func NewRetentionRuns(runs []structs.RetentionRun) []RetentionRun {
+	result := make([]RetentionRun, 0, len(runs))
+	for _, run := range runs {
+		result = append(result, RetentionRun{
+			ID:             run.ID,
+			GameID:         run.GameID,
+			Mode:           run.Mode,
+			Affected:       run.Affected,
+			RecordedBefore: run.RecordedBefore,
+			CreatedAt:      run.CreatedAt,
+		})
+	}
+	return result
+}
+
+func NewAuditLogs(logs []structs.AuditLog) []AuditLog {
+	result := make([]AuditLog, 0, len(logs))
+	for _, entry := range logs {
+		result = append(result, AuditLog{
+			ID:         entry.ID,
+			CreatedAt:  entry.CreatedAt,
+			ActorID:    entry.ActorID,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			Before:     auditJSON(entry.Before),
+			After:      auditJSON(entry.After),
+			IP:         entry.IP,
+			RequestID:  entry.RequestID,
+		})
+	}
+	return result
+}
+
+func auditJSON(value string) json.RawMessage {
+	if value == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(value)
+}
+
+func NewExport(e *structs.UserExport, basePath string) Export {
+	return Export{
+		ExportedAt: e.ExportedAt,
+		Account: Account{
+			ID:        e.User.ID,
+			Email:     e.User.Email,
+			Role:      e.User.Role,
+			CreatedAt: e.User.CreatedAt,
+		},
+		UserProfile:  NewUser(&e.UserProfile, basePath),
+		Contact:      NewContact(&e.UserProfile),
+		Team:         NewTeam(&e.Team),
+		Geolocations: NewGeolocations(e.Geolocations),
+		APITokens:    NewAPITokens(e.APITokens),
+	}
+}
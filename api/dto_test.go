@@ -0,0 +1,27 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func TestNewUserAvatarURL(t *testing.T) {
+	tests := []struct {
+		stored   string
+		basePath string
+		want     string
+	}{
+		{"avatars/u1?v=1", "", "/api/v1/avatars/u1?v=1"},
+		{"avatars/u1?v=1", "/tenchi", "/tenchi/api/v1/avatars/u1?v=1"},
+		// 旧バージョンで保存された Google の URL はそのまま返す
+		{"https://lh3.googleusercontent.com/a/x", "/tenchi", "https://lh3.googleusercontent.com/a/x"},
+		{"", "/tenchi", ""},
+	}
+	for _, tt := range tests {
+		got := NewUser(&structs.UserProfile{ID: "u1", AvatarURL: tt.stored}, tt.basePath).AvatarURL
+		if got != tt.want {
+			t.Errorf("NewUser(%q, %q).AvatarURL = %q, want %q", tt.stored, tt.basePath, got, tt.want)
+		}
+	}
+}
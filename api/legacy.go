@@ -0,0 +1,105 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// The unversioned /api paths answered with the structs of the structs package, encoded
+// as they are (keys such as "ID" and "UserName"). Clients written against them, like
+// the Discord bot, still get those shapes from the deprecated mount. Routes added with
+// /api/v1 have no legacy shape and answer with the v1 one on both mounts.
+
+const legacyLocal = "api_legacy"
+
+// IsLegacy reports whether the request came in on the deprecated unversioned paths.
+func IsLegacy(c *fiber.Ctx) bool {
+	legacy, _ := c.Locals(legacyLocal).(bool)
+	return legacy
+}
+
+// legacyAvatarURL resolves a stored avatar key to the unversioned path it had before
+// /api/v1, e.g. /api/avatars/<id>?v=<unix time>.
+func legacyAvatarURL(basePath string, stored string) string {
+	if strings.HasPrefix(stored, lib.AvatarKeyPrefix) {
+		return basePath + "/api/" + stored
+	}
+	return stored
+}
+
+func LegacyUser(p structs.UserProfile, basePath string) structs.UserProfile {
+	p.AvatarURL = legacyAvatarURL(basePath, p.AvatarURL)
+	return p
+}
+
+func LegacyUsers(profiles []structs.UserProfile, basePath string) []structs.UserProfile {
+	result := make([]structs.UserProfile, 0, len(profiles))
+	for _, p := range profiles {
+		result = append(result, LegacyUser(p, basePath))
+	}
+	return result
+}
+
+// LegacyMe is the old GET /api/user/me response. It has no role.
+type LegacyMe struct {
+	UserProfile structs.UserProfile   `json:"user_profile"`
+	Contact     structs.Contact       `json:"contact"`
+	Team        structs.Team          `json:"team"`
+	TeamMembers []structs.UserProfile `json:"team_members"`
+}
+
+func NewLegacyMe(d *structs.UserDetail, members []structs.UserProfile, basePath string) LegacyMe {
+	return LegacyMe{
+		UserProfile: LegacyUser(d.UserProfile, basePath),
+		Contact:     d.UserProfile.Contact(),
+		Team:        d.Team,
+		TeamMembers: LegacyUsers(members, basePath),
+	}
+}
+
+// LegacyProfile is the old PATCH /api/user/me response.
+type LegacyProfile struct {
+	UserProfile structs.UserProfile `json:"user_profile"`
+	Contact     structs.Contact     `json:"contact"`
+}
+
+func NewLegacyProfile(p *structs.UserProfile, basePath string) LegacyProfile {
+	return LegacyProfile{
+		UserProfile: LegacyUser(*p, basePath),
+		Contact:     p.Contact(),
+	}
+}
+
+func LegacyUserDetail(d structs.UserDetail, basePath string) structs.UserDetail {
+	d.UserProfile = LegacyUser(d.UserProfile, basePath)
+	return d
+}
+
+func LegacyTeamDetail(d structs.TeamDetail, basePath string) structs.TeamDetail {
+	d.Members = LegacyUsers(d.Members, basePath)
+	return d
+}
+
+func LegacyTeamPositions(details []structs.GeolocationDetail, basePath string) []structs.GeolocationDetail {
+	result := make([]structs.GeolocationDetail, 0, len(details))
+	for _, d := range details {
+		d.TeamDetail = LegacyTeamDetail(d.TeamDetail, basePath)
+		result = append(result, d)
+	}
+	return result
+}
+
+func LegacyExport(e structs.UserExport, basePath string) structs.UserExport {
+	e.UserProfile = LegacyUser(e.UserProfile, basePath)
+	return e
+}
+
+// LegacyCreatedAPIToken is the old POST /api/user/me/tokens response.
+type LegacyCreatedAPIToken struct {
+	Token    string           `json:"token"`
+	APIToken structs.APIToken `json:"api_token"`
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+var pathParamPattern = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// Document collects the operations registered through Router and renders them as an
+// OpenAPI 3.0 document. Schemas are generated from the DTO types by reflection.
+type Document struct {
+	Title      string
+	Version    string
+	ServerURL  string
+	operations []documentedOperation
+}
+
+type documentedOperation struct {
+	method  string
+	path    string
+	op      Operation
+	secured bool
+}
+
+func NewDocument(title string, version string, serverURL string) *Document {
+	return &Document{Title: title, Version: version, ServerURL: serverURL}
+}
+
+func (d *Document) add(method string, path string, op Operation, secured bool) {
+	d.operations = append(d.operations, documentedOperation{method: method, path: path, op: op, secured: secured})
+}
+
+// Spec builds the OpenAPI document. It is a plain map so it can be passed to c.JSON.
+func (d *Document) Spec() fiber.Map {
+	g := &schemaGenerator{schemas: fiber.Map{}}
+	errorRef := g.schemaFor(reflect.TypeOf(lib.APIError{}))
+
+	paths := fiber.Map{}
+	for _, o := range d.operations {
+		path := pathParamPattern.ReplaceAllString(o.path, "{$1}")
+		item, ok := paths[path].(fiber.Map)
+		if !ok {
+			item = fiber.Map{}
+			paths[path] = item
+		}
+		item[strings.ToLower(o.method)] = d.operation(g, o, errorRef)
+	}
+
+	return fiber.Map{
+		"openapi": "3.0.3",
+		"info": fiber.Map{
+			"title":   d.Title,
+			"version": d.Version,
+		},
+		"servers": []fiber.Map{{"url": d.ServerURL}},
+		"paths":   paths,
+		"components": fiber.Map{
+			"schemas": g.schemas,
+			"securitySchemes": fiber.Map{
+				"session": fiber.Map{"type": "apiKey", "in": "cookie", "name": "jwt"},
+				"token":   fiber.Map{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+func (d *Document) operation(g *schemaGenerator, o documentedOperation, errorRef fiber.Map) fiber.Map {
+	op := o.op
+	result := fiber.Map{}
+	if op.ID != "" {
+		result["operationId"] = op.ID
+	}
+	if op.Summary != "" {
+		result["summary"] = op.Summary
+	}
+	if op.Description != "" {
+		result["description"] = op.Description
+	}
+	if len(op.Tags) > 0 {
+		result["tags"] = op.Tags
+	}
+
+	var params []fiber.Map
+	for _, m := range pathParamPattern.FindAllStringSubmatch(o.path, -1) {
+		params = append(params, fiber.Map{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   fiber.Map{"type": "string"},
+		})
+	}
+	for _, p := range op.Query {
+		param := fiber.Map{
+			"name":   p.Name,
+			"in":     "query",
+			"schema": fiber.Map{"type": p.Type},
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		result["parameters"] = params
+	}
+
+	if op.Request != nil {
+		contentTypes := op.RequestContentTypes
+		if len(contentTypes) == 0 {
+			contentTypes = []string{fiber.MIMEApplicationJSON}
+		}
+		schema := g.schemaFor(reflect.TypeOf(op.Request))
+		content := fiber.Map{}
+		for _, contentType := range contentTypes {
+			content[contentType] = fiber.Map{"schema": schema}
+		}
+		result["requestBody"] = fiber.Map{"required": true, "content": content}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	success := fiber.Map{"description": http.StatusText(status)}
+	switch {
+	case op.ResponseContentType != "":
+		success["content"] = fiber.Map{
+			op.ResponseContentType: fiber.Map{"schema": fiber.Map{"type": "string", "format": "binary"}},
+		}
+	case op.Response != nil:
+		success["content"] = fiber.Map{
+			fiber.MIMEApplicationJSON: fiber.Map{"schema": g.schemaFor(reflect.TypeOf(op.Response))},
+		}
+	}
+	result["responses"] = fiber.Map{
+		strconv.Itoa(status): success,
+		"default": fiber.Map{
+			"description": "Error",
+			"content": fiber.Map{
+				fiber.MIMEApplicationJSON: fiber.Map{"schema": errorRef},
+			},
+		},
+	}
+
+	if o.secured {
+		// Cookie セッションか API トークンのどちらかで認証する
+		security := []fiber.Map{{"session": []string{}}}
+		if !op.Session {
+			scopes := []string{}
+			if op.Scope != "" {
+				scopes = append(scopes, op.Scope)
+			}
+			security = append(security, fiber.Map{"token": scopes})
+		}
+		result["security"] = security
+	} else {
+		result["security"] = []fiber.Map{}
+	}
+	return result
+}
+
+type schemaGenerator struct {
+	schemas fiber.Map
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor returns the schema of t. Named structs are added to components and
+// referenced by $ref.
+func (g *schemaGenerator) schemaFor(t reflect.Type) fiber.Map {
+	switch {
+	case t == timeType:
+		return fiber.Map{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		// 任意の JSON（監査ログの変更前後の値など）
+		return fiber.Map{"type": "object", "nullable": true}
+	case t.Kind() == reflect.Pointer:
+		schema := g.schemaFor(t.Elem())
+		if _, ok := schema["$ref"]; ok {
+			return fiber.Map{"allOf": []fiber.Map{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return fiber.Map{"type": "string"}
+	case reflect.Bool:
+		return fiber.Map{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return fiber.Map{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return fiber.Map{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return fiber.Map{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return fiber.Map{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		return fiber.Map{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return fiber.Map{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.objectSchema(t)
+		}
+		ref := fiber.Map{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// 再帰的な型に備えて、先に名前を登録してから中身を作る
+			g.schemas[t.Name()] = fiber.Map{}
+			g.schemas[t.Name()] = g.objectSchema(t)
+		}
+		return ref
+	}
+	// interface{} など、形が決まらないもの
+	return fiber.Map{}
+}
+
+func (g *schemaGenerator) objectSchema(t reflect.Type) fiber.Map {
+	properties := fiber.Map{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		switch {
+		case field.Tag.Get("openapi") == "required":
+			// 未指定を検出するためにポインタにしている必須項目
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			properties[name] = g.schemaFor(fieldType)
+			required = append(required, name)
+		case !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer:
+			properties[name] = g.schemaFor(field.Type)
+			required = append(required, name)
+		default:
+			properties[name] = g.schemaFor(field.Type)
+		}
+	}
+	schema := fiber.Map{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Operation describes a route for the OpenAPI document. Scope and Session are also
+// enforced by the Router, so the document cannot drift from the actual checks.
+type Operation struct {
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	// Scope はこの操作に必要な API トークンのスコープ
+	Scope string
+	// Session が true ならログインセッション（Cookie）からのみ呼び出せる
+	Session bool
+	Query   []Param
+	// Request and Response are zero values of the body types, e.g. GeolocationRequest{}.
+	Request             interface{}
+	RequestContentTypes []string
+	Response            interface{}
+	// ResponseContentType defaults to application/json.
+	ResponseContentType string
+	// Status is the success status code, 200 by default.
+	Status int
+}
+
+type Param struct {
+	Name        string
+	Type        string // "string", "integer" or "boolean"
+	Description string
+}
+
+type mount struct {
+	router     fiber.Router
+	prefix     string
+	deprecated bool
+}
+
+// Router registers each route on /api/v1 and on the old unversioned /api paths, and
+// records it in the OpenAPI document. The unversioned paths are deprecated aliases:
+// they send a Deprecation header and keep the response shapes they had before v1
+// (see IsLegacy).
+type Router struct {
+	mounts     []mount
+	successor  string
+	middleware []fiber.Handler
+	secured    bool
+	doc        *Document
+
+	requireScope   func(scope string) fiber.Handler
+	requireSession fiber.Handler
+}
+
+// NewRouter mounts routes on app under prefix+"/v1" and, deprecated, under prefix.
+func NewRouter(app *fiber.App, prefix string, doc *Document, requireScope func(scope string) fiber.Handler, requireSession fiber.Handler) *Router {
+	v1 := prefix + "/v1"
+	return &Router{
+		mounts: []mount{
+			{router: app.Group(v1), prefix: v1},
+			{router: app.Group(prefix), prefix: prefix, deprecated: true},
+		},
+		successor:      v1,
+		doc:            doc,
+		requireScope:   requireScope,
+		requireSession: requireSession,
+	}
+}
+
+// Secured returns a Router whose routes run the given authentication handlers first.
+func (r *Router) Secured(handlers ...fiber.Handler) *Router {
+	secured := *r
+	secured.middleware = append(append([]fiber.Handler{}, r.middleware...), handlers...)
+	secured.secured = true
+	return &secured
+}
+
+func (r *Router) Get(path string, op Operation, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodGet, path, op, handlers...)
+}
+
+func (r *Router) Post(path string, op Operation, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPost, path, op, handlers...)
+}
+
+func (r *Router) Patch(path string, op Operation, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodPatch, path, op, handlers...)
+}
+
+func (r *Router) Delete(path string, op Operation, handlers ...fiber.Handler) {
+	r.Add(fiber.MethodDelete, path, op, handlers...)
+}
+
+func (r *Router) Add(method string, path string, op Operation, handlers ...fiber.Handler) {
+	chain := append([]fiber.Handler{}, r.middleware...)
+	if op.Scope != "" {
+		chain = append(chain, r.requireScope(op.Scope))
+	}
+	if op.Session {
+		chain = append(chain, r.requireSession)
+	}
+	chain = append(chain, handlers...)
+
+	for _, m := range r.mounts {
+		if m.deprecated {
+			m.router.Add(method, path, append([]fiber.Handler{r.deprecation(m.prefix)}, chain...)...)
+		} else {
+			m.router.Add(method, path, chain...)
+		}
+	}
+	r.doc.add(method, path, op, r.secured)
+}
+
+// deprecation marks responses from the unversioned paths, points to the /v1 path and
+// asks the handlers for the legacy response shapes.
+func (r *Router) deprecation(prefix string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(legacyLocal, true)
+		c.Set("Deprecation", "true")
+		c.Set(fiber.HeaderLink, "<"+r.successor+strings.TrimPrefix(c.Path(), prefix)+`>; rel="successor-version"`)
+		return c.Next()
+	}
+}
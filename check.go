@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/migrations"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+const checkUsage = `usage: tenchi-geolocation check [validate]
+
+Reports rows that refer to missing users, teams or games.
+With "validate", the foreign keys added as NOT VALID are validated afterwards (Postgres).`
+
+// runCheck implements the "check" subcommand.
+func runCheck(db *gorm.DB, args []string) error {
+	validate := false
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "validate":
+		validate = true
+	default:
+		return fmt.Errorf("%s", checkUsage)
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	if pending, err := migrator.Check(); err != nil {
+		return err
+	} else if pending > 0 {
+		return fmt.Errorf("%d pending migrations; run \"tenchi-geolocation migrate up\" first", pending)
+	}
+
+	dbInstance := &structs.Database{DB: db}
+	issues, err := dbInstance.CheckIntegrity()
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Printf("%s: %d rows in %s (id: %s)\n", issue.Description, issue.Count, issue.Table, strings.Join(issue.Samples, ", "))
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("found %d kinds of orphaned rows", len(issues))
+	}
+	fmt.Println("no orphaned rows")
+
+	if validate {
+		validated, err := dbInstance.ValidateForeignKeys()
+		for _, name := range validated {
+			fmt.Printf("validated %s\n", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
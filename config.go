@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+const configUsage = `usage: tenchi-geolocation [flags] config check
+
+Prints the effective settings and where they come from, then every problem found.`
+
+// maxSettingWidth は config check で表示する値の最大の長さ
+const maxSettingWidth = 60
+
+// runConfig implements the "config" subcommand.
+func runConfig(cfg *lib.Config, args []string) error {
+	if len(args) != 1 || args[0] != "check" {
+		return fmt.Errorf("%s", configUsage)
+	}
+
+	file, secretsFile := cfg.File, cfg.SecretsFile
+	if file == "" {
+		file = "(none)"
+	}
+	if secretsFile == "" {
+		secretsFile = "(none)"
+	}
+	fmt.Printf("file: %s\nsecrets: %s\n\n", file, secretsFile)
+
+	var plaintext []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE\tENV")
+	for _, s := range cfg.Settings() {
+		source := s.Source
+		if s.Ref != "" {
+			source += " (" + s.Ref + ")"
+		} else if s.Secret && s.Source == "file" && s.Value != "" {
+			plaintext = append(plaintext, s.Name)
+		}
+		value := s.Value
+		// CSP などの長い値で表が崩れないように縮める
+		if len(value) > maxSettingWidth {
+			value = value[:maxSettingWidth-3] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, value, source, s.Env)
+	}
+	w.Flush()
+	fmt.Println()
+	for _, name := range plaintext {
+		fmt.Printf("warning: %s is stored in plain text in %s; use a file: reference or the secrets file\n", name, cfg.File)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	fmt.Println("configuration is valid")
+	return nil
+}
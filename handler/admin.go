@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func (h *Handler) ListRetentionRuns(c *fiber.Ctx) error {
+	runs, err := h.retention.ListRuns(c.QueryInt("limit", 100))
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewRetentionRuns(runs), runs)
+}
+
+func (h *Handler) ListAuditLogs(c *fiber.Ctx) error {
+	filter := structs.AuditLogFilter{
+		ActorID:    c.Query("actor_id"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		BeforeID:   c.QueryInt("before_id"),
+		Limit:      c.QueryInt("limit", 100),
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return lib.ValidationError(name, err)
+			}
+			*t = parsed
+		}
+	}
+	logs, err := h.audit.List(filter)
+	if err != nil {
+		return err
+	}
+	return c.JSON(api.NewAuditLogs(logs))
+}
+
+func (h *Handler) ListContacts(c *fiber.Ctx) error {
+	profiles, err := h.users.ListContacts(c.Context(), c.QueryInt("team_id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(api.NewProfiles(profiles, h.basePath))
+}
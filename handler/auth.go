@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+func (h *Handler) Login(c *fiber.Ctx) error {
+	authURL := lib.GetGoogleOAuthURL(h.oauth)
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+func (h *Handler) Callback(c *fiber.Ctx) error {
+	userCallback, err := lib.LoginOperation(c, h.oauth)
+	if err != nil {
+		return err
+	}
+
+	id, ok := (*userCallback)["sub"]
+	if !ok {
+		return fmt.Errorf("user ID not found in callback")
+	}
+	idStr, ok := id.(string)
+	if !ok {
+		return fmt.Errorf("user ID is not a string")
+	}
+	email, _ := (*userCallback)["email"].(string)
+	picture, _ := (*userCallback)["picture"].(string)
+
+	token, err := h.auth.SignIn(c.Context(), idStr, email, picture)
+	if err != nil {
+		return err
+	}
+	h.setSessionCookie(c, token)
+	return c.Redirect(h.basePath+"/", fiber.StatusFound)
+}
+
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	h.clearSessionCookie(c)
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/service"
+)
+
+func (h *Handler) ListTeamPositions(c *fiber.Ctx) error {
+	geolocationDetails, err := h.geo.Latest(c.Context())
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewTeamPositions(geolocationDetails, h.basePath), api.LegacyTeamPositions(geolocationDetails, h.basePath))
+}
+
+func (h *Handler) AddGeolocation(c *fiber.Ctx) error {
+	var req api.GeolocationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return lib.InvalidRequest(err)
+	}
+	geolocation, err := h.geo.Add(c.Context(), currentUserID(c), service.GeolocationInput{
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+	})
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewGeolocation(geolocation), geolocation)
+}
@@ -0,0 +1,184 @@
+// Package handler turns HTTP requests into service calls and service results into
+// the DTOs of the api package.
+package handler
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/oauth2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/service"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// AuthService signs users in and authenticates requests (*service.AuthService).
+type AuthService interface {
+	SignIn(ctx context.Context, userID string, email string, picture string) (string, error)
+	AuthenticateToken(bearer string) (*lib.Identity, error)
+	AuthenticateSession(jwtToken string) (identity *lib.Identity, renewed string, err error)
+}
+
+type UserService interface {
+	Me(userID string) (*structs.UserDetail, *structs.TeamDetail, error)
+	GetUser(userID string) (*structs.UserDetail, error)
+	UpdateProfile(ctx context.Context, userID string, input service.ProfileInput) (*structs.UserProfile, error)
+	ChangeUserName(ctx context.Context, userID string, name string) (*structs.UserProfile, error)
+	Delete(ctx context.Context, userID string, purgeLocations bool) error
+	ListContacts(ctx context.Context, teamID int) ([]structs.UserProfile, error)
+	Export(userID string) (*structs.UserExport, error)
+	Avatar(ctx context.Context, userID string) ([]byte, string, error)
+}
+
+type TokenService interface {
+	List(userID string) ([]structs.APIToken, error)
+	Create(ctx context.Context, identity *lib.Identity, name string, scopes []string, expiresInDays int) (string, *structs.APIToken, error)
+	Revoke(ctx context.Context, userID string, tokenID string) (*structs.APIToken, error)
+}
+
+type TeamService interface {
+	Get(teamID string) (*structs.TeamDetail, error)
+	Update(ctx context.Context, identity *lib.Identity, teamID string, input service.TeamInput) (*structs.Team, error)
+}
+
+type GeoService interface {
+	Latest(ctx context.Context) ([]structs.GeolocationDetail, error)
+	Add(ctx context.Context, userID string, input service.GeolocationInput) (*structs.Geolocation, error)
+}
+
+type RetentionService interface {
+	ListRuns(limit int) ([]structs.RetentionRun, error)
+}
+
+// HealthService answers the readiness probe. Draining is left to main.
+type HealthService interface {
+	Ready(ctx context.Context) []service.HealthCheck
+}
+
+type AuditService interface {
+	List(filter structs.AuditLogFilter) ([]structs.AuditLog, error)
+}
+
+var (
+	_ AuthService      = (*service.AuthService)(nil)
+	_ UserService      = (*service.UserService)(nil)
+	_ TokenService     = (*service.TokenService)(nil)
+	_ TeamService      = (*service.TeamService)(nil)
+	_ GeoService       = (*service.GeoService)(nil)
+	_ RetentionService = (*service.RetentionService)(nil)
+	_ HealthService    = (*service.HealthService)(nil)
+	_ AuditService     = (*service.AuditService)(nil)
+)
+
+// Handler holds the services the routes call. Build it with New in main.
+type Handler struct {
+	oauth     *oauth2.Config
+	cookies   lib.CookieConfig
+	basePath  string
+	auth      AuthService
+	users     UserService
+	tokens    TokenService
+	teams     TeamService
+	geo       GeoService
+	retention RetentionService
+	health    HealthService
+	audit     AuditService
+}
+
+// Services are the services behind the handlers. main passes the ones in the service
+// package; tests can pass their own.
+type Services struct {
+	Auth      AuthService
+	Users     UserService
+	Tokens    TokenService
+	Teams     TeamService
+	Geo       GeoService
+	Retention RetentionService
+	Health    HealthService
+	Audit     AuditService
+}
+
+// New returns the handlers. basePath is the URL path the app is served under ("" for
+// the root).
+func New(oauth *oauth2.Config, cookies lib.CookieConfig, basePath string, services Services) *Handler {
+	return &Handler{
+		oauth:     oauth,
+		cookies:   cookies,
+		basePath:  basePath,
+		auth:      services.Auth,
+		users:     services.Users,
+		tokens:    services.Tokens,
+		teams:     services.Teams,
+		geo:       services.Geo,
+		retention: services.Retention,
+		health:    services.Health,
+		audit:     services.Audit,
+	}
+}
+
+func currentIdentity(c *fiber.Ctx) *lib.Identity {
+	identity, ok := c.Locals("identity").(*lib.Identity)
+	if !ok {
+		return &lib.Identity{}
+	}
+	return identity
+}
+
+func currentUserID(c *fiber.Ctx) string {
+	return currentIdentity(c).UserID
+}
+
+// clientIP returns the client's address found by RequestLogger behind trusted proxies.
+func clientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(lib.LocalClientIP).(string); ok {
+		return ip
+	}
+	return c.IP()
+}
+
+// respond sends v1 as JSON, or legacy on the deprecated unversioned paths, which kept
+// the response shapes they had before /api/v1 (see api.IsLegacy).
+func respond(c *fiber.Ctx, v1 interface{}, legacy interface{}) error {
+	if api.IsLegacy(c) {
+		return c.JSON(legacy)
+	}
+	return c.JSON(v1)
+}
+
+// セッションの Cookie には Path を付けない。以前の Cookie（/api/v1 など）と重ならないようにする
+func (h *Handler) setSessionCookie(c *fiber.Ctx, token string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    token,
+		Domain:   h.cookies.Domain,
+		HTTPOnly: true,
+		Secure:   h.cookies.Secure,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+func (h *Handler) clearSessionCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Domain:   h.cookies.Domain,
+		HTTPOnly: true,
+		Secure:   h.cookies.Secure,
+		SameSite: fiber.CookieSameSiteStrictMode,
+		Expires:  time.Unix(0, 0), // 1970年
+	})
+}
+
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+)
+
+// Healthz reports that the process is alive. It does not touch the database, so a
+// database outage does not get the server restarted.
+func (h *Handler) Healthz(c *fiber.Ctx) error {
+	return c.JSON(api.Health{Status: "ok"})
+}
+
+// Readyz reports whether the server should receive traffic: the database is reachable,
+// all migrations are applied and the server is not shutting down.
+func (h *Handler) Readyz(c *fiber.Ctx) error {
+	health := api.Health{Status: "ok", Checks: map[string]string{}}
+	for _, check := range h.health.Ready(c.Context()) {
+		if check.Err != nil {
+			health.Status = "unavailable"
+			health.Checks[check.Name] = check.Err.Error()
+		} else {
+			health.Checks[check.Name] = "ok"
+		}
+	}
+	if health.Status != "ok" {
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(health)
+}
@@ -0,0 +1,10 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+// Metrics serves the metrics in the Prometheus exposition format.
+var Metrics = adaptor.HTTPHandler(lib.MetricsHandler())
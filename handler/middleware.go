@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/service"
+)
+
+// RequireLogin authenticates the request with an API token or the session cookie and
+// stores the caller's *lib.Identity in c.Locals("identity").
+func (h *Handler) RequireLogin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Authorization: Bearer が付いていれば API トークンとして扱う
+		if bearer := lib.GetBearerToken(c); bearer != "" {
+			identity, err := h.auth.AuthenticateToken(bearer)
+			if err != nil {
+				return err
+			}
+			c.Locals("identity", identity)
+			lib.ActiveSessions.Seen(identity.AuthMethod, identity.UserID)
+			return c.Next()
+		}
+
+		jwtToken := c.Cookies("jwt")
+		if jwtToken == "" {
+			return lib.NewAPIError(fiber.StatusUnauthorized, lib.CodeAuthenticationRequired, "Login is required")
+		}
+		identity, renewed, err := h.auth.AuthenticateSession(jwtToken)
+		if err != nil {
+			return err
+		}
+		if renewed != "" {
+			h.setSessionCookie(c, renewed)
+		}
+		c.Locals("identity", identity)
+		lib.ActiveSessions.Seen(identity.AuthMethod, identity.UserID)
+		return c.Next()
+	}
+}
+
+// RequireScope rejects requests whose credentials do not grant the given scope.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !lib.HasScope(currentIdentity(c).Scopes, scope) {
+			return lib.NewAPIError(fiber.StatusForbidden, lib.CodeMissingScope, "Missing required scope").
+				WithDetails(fiber.Map{"scope": scope})
+		}
+		return c.Next()
+	}
+}
+
+// RequireSession only allows cookie sessions, so API tokens cannot manage other tokens.
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if currentIdentity(c).AuthMethod != service.AuthMethodSession {
+			return lib.NewAPIError(fiber.StatusForbidden, lib.CodeSessionRequired, "This operation requires a login session")
+		}
+		return c.Next()
+	}
+}
+
+// AllowTimingMiddleware only lets location submissions through during the game's
+// submission windows (by default within 3 minutes of each half hour).
+func AllowTimingMiddleware(game lib.GameConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !game.InSubmissionWindow(c.Context().Time()) {
+			return lib.NewAPIError(fiber.StatusForbidden, lib.CodeOutsideWindow, "Request not allowed at this time")
+		}
+		return c.Next()
+	}
+}
+
+// RateLimit rejects requests beyond limit with 429 and Retry-After. Requests are
+// counted per user after RequireLogin and per client IP address before it; every
+// route using the same group shares one counter.
+func RateLimit(limiter *lib.RateLimiter, group string, limit lib.RateLimit) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		subject := "ip:" + clientIP(c)
+		if identity, ok := c.Locals("identity").(*lib.Identity); ok {
+			subject = "user:" + identity.UserID
+		}
+		allowed, retryAfter, err := limiter.Allow(c.Context(), group, subject, limit)
+		if err != nil {
+			slog.WarnContext(c.Context(), "Rate limit check failed", "group", group, "error", err)
+		}
+		if !allowed {
+			lib.RateLimited.Inc(group)
+			seconds := max(int(math.Ceil(retryAfter.Seconds())), 1)
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+			return lib.NewAPIError(fiber.StatusTooManyRequests, lib.CodeRateLimited, "Too many requests").
+				WithDetails(fiber.Map{"retry_after": seconds})
+		}
+		return c.Next()
+	}
+}
+
+// RedirectToBasePath adds the trailing slash to the base path itself, so that the
+// map page's relative URLs resolve under it.
+func RedirectToBasePath(basePath string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Path() == basePath {
+			return c.Redirect(basePath+"/", fiber.StatusMovedPermanently)
+		}
+		return c.Next()
+	}
+}
+
+// requestIDPattern limits the request IDs accepted from a proxy, so that clients
+// cannot inject arbitrary text into the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestLogger assigns every request an ID (the X-Request-ID sent by a proxy, or a
+// new one), returns it in X-Request-ID and logs the request when it is done. It also
+// finds the client's address behind the trusted proxies. Errors are rendered here so
+// that the status code is known.
+func RequestLogger(proxies lib.TrustedProxies) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		id := c.Get(fiber.HeaderXRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		ip := strings.Clone(proxies.ClientIP(c.IP(), c.Get(fiber.HeaderXForwardedFor)))
+		c.Locals(lib.LocalRequestID, id)
+		c.Locals(lib.LocalClientIP, ip)
+		c.Set(fiber.HeaderXRequestID, id)
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		// クエリ文字列には OAuth の code などが含まれるのでパスだけを残す
+		slog.LogAttrs(c.Context(), level, "request",
+			slog.String("method", c.Method()),
+			slog.String("path", c.Path()),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", ip),
+		)
+		return nil
+	}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// HTTPMetrics records the duration of every request by route pattern. Errors are
+// rendered here so that the status code is known; the error handler is not run again.
+func HTTPMetrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+		status := c.Response().StatusCode()
+		// 一致するルートがなければ Use のパスのままになる。任意のパスをラベルにしない
+		route := c.Route().Path
+		if c.Route().Method == "USE" || status == fiber.StatusNotFound && route == "/" {
+			route = "unmatched"
+		}
+		lib.HTTPRequestDuration.Observe(time.Since(start).Seconds(), c.Method(), route, strconv.Itoa(status))
+		return nil
+	}
+}
+
+// GeolocationRejections counts rejected location submissions by error code. It runs
+// before AllowTimingMiddleware so that submissions outside the window are counted.
+func GeolocationRejections() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		var apiErr *lib.APIError
+		if errors.As(err, &apiErr) && apiErr.Status < fiber.StatusInternalServerError {
+			lib.GeolocationRejections.Inc(apiErr.Code)
+		}
+		return err
+	}
+}
+
+// RequireMetricsToken protects /metrics with a bearer token. Config.Validate makes sure
+// the token is set; an empty token rejects every request.
+func RequireMetricsToken(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token == "" || subtle.ConstantTimeCompare([]byte(lib.GetBearerToken(c)), []byte(token)) != 1 {
+			return lib.NewAPIError(fiber.StatusUnauthorized, lib.CodeAuthenticationRequired, "A valid metrics token is required")
+		}
+		return c.Next()
+	}
+}
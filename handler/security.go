@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+const (
+	csrfCookieName = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+var csrfTokenPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// SecurityHeaders sets the Content-Security-Policy and the other headers that keep
+// the map page from being framed or sniffed. HSTS is only sent over HTTPS.
+func SecurityHeaders(cfg lib.SecurityConfig) fiber.Handler {
+	hsts := "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+	return func(c *fiber.Ctx) error {
+		if cfg.CSP != "" {
+			c.Set(fiber.HeaderContentSecurityPolicy, cfg.CSP)
+		}
+		if cfg.HSTSMaxAge > 0 && c.Protocol() == "https" {
+			c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+		}
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		c.Set(fiber.HeaderXFrameOptions, "DENY")
+		c.Set(fiber.HeaderReferrerPolicy, "strict-origin-when-cross-origin")
+		// 位置情報は地図のページ自身だけが使う
+		c.Set(fiber.HeaderPermissionsPolicy, "geolocation=(self), camera=(), microphone=()")
+		return c.Next()
+	}
+}
+
+// CORS lets the listed origins call the API from the browser, with credentials.
+// Requests from other origins get no CORS headers, so browsers block them.
+func CORS(origins []string) fiber.Handler {
+	allowMethods := strings.Join([]string{fiber.MethodGet, fiber.MethodPost, fiber.MethodPatch, fiber.MethodDelete}, ", ")
+	allowHeaders := strings.Join([]string{fiber.HeaderAuthorization, fiber.HeaderContentType, csrfHeaderName, fiber.HeaderXRequestID}, ", ")
+	exposeHeaders := strings.Join([]string{fiber.HeaderRetryAfter, fiber.HeaderXRequestID, "Deprecation", fiber.HeaderLink}, ", ")
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin == "" {
+			return c.Next()
+		}
+		c.Vary(fiber.HeaderOrigin)
+		allowed := slices.Contains(origins, origin)
+		if allowed {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+			c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+			c.Set(fiber.HeaderAccessControlExposeHeaders, exposeHeaders)
+		}
+		if c.Method() != fiber.MethodOptions || c.Get(fiber.HeaderAccessControlRequestMethod) == "" {
+			return c.Next()
+		}
+		// プリフライトはここで応答する。許可しないオリジンにはヘッダを付けない
+		if allowed {
+			c.Set(fiber.HeaderAccessControlAllowMethods, allowMethods)
+			c.Set(fiber.HeaderAccessControlAllowHeaders, allowHeaders)
+			c.Set(fiber.HeaderAccessControlMaxAge, "600")
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// CSRF protects cookie sessions with a double-submit token: every response sets the
+// csrf_token cookie if it is missing, and state-changing requests that carry the
+// session cookie must send the same value in X-CSRF-Token. Other sites can make the
+// browser send the cookie but cannot read it. Requests with an API token are not
+// checked because browsers never attach one by themselves.
+//
+// The cookie's path is basePath, so that the map page can read it.
+func CSRF(cookies lib.CookieConfig, basePath string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Cookies(csrfCookieName)
+		if !csrfTokenPattern.MatchString(token) {
+			token = newCSRFToken()
+			c.Cookie(&fiber.Cookie{
+				Name:   csrfCookieName,
+				Value:  token,
+				Path:   basePath + "/",
+				Domain: cookies.Domain,
+				// ページの JavaScript が読んでヘッダに入れるので HTTPOnly にはしない
+				Secure:   cookies.Secure,
+				SameSite: fiber.CookieSameSiteStrictMode,
+			})
+		}
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+		if lib.GetBearerToken(c) != "" || c.Cookies("jwt") == "" {
+			return c.Next()
+		}
+		if subtle.ConstantTimeCompare([]byte(c.Get(csrfHeaderName)), []byte(token)) != 1 {
+			return lib.NewAPIError(fiber.StatusForbidden, lib.CodeInvalidCSRFToken, "Missing or invalid CSRF token").
+				WithDetails(fiber.Map{"header": csrfHeaderName, "cookie": csrfCookieName})
+		}
+		return c.Next()
+	}
+}
+
+func newCSRFToken() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/service"
+)
+
+func (h *Handler) GetTeam(c *fiber.Ctx) error {
+	teamDetail, err := h.teams.Get(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewTeamDetail(teamDetail, h.basePath), api.LegacyTeamDetail(*teamDetail, h.basePath))
+}
+
+func (h *Handler) UpdateTeam(c *fiber.Ctx) error {
+	var req api.TeamUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return lib.InvalidRequest(err)
+	}
+	team, err := h.teams.Update(c.Context(), currentIdentity(c), c.Params("id"), service.TeamInput{
+		Name:      req.Name,
+		Color:     req.Color,
+		Icon:      req.Icon,
+		Motto:     req.Motto,
+		CaptainID: req.CaptainID,
+	})
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewTeam(team), team)
+}
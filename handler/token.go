@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+func (h *Handler) ListAPITokens(c *fiber.Ctx) error {
+	tokens, err := h.tokens.List(currentUserID(c))
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewAPITokens(tokens), tokens)
+}
+
+func (h *Handler) CreateAPIToken(c *fiber.Ctx) error {
+	var req api.CreateAPITokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return lib.InvalidRequest(err)
+	}
+	token, apiToken, err := h.tokens.Create(c.Context(), currentIdentity(c), req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		return err
+	}
+	// 平文のトークンを返すのはこの一度だけ
+	return respond(c.Status(fiber.StatusCreated), api.CreatedAPIToken{
+		Token:    token,
+		APIToken: api.NewAPIToken(apiToken),
+	}, api.LegacyCreatedAPIToken{Token: token, APIToken: *apiToken})
+}
+
+func (h *Handler) RevokeAPIToken(c *fiber.Ctx) error {
+	apiToken, err := h.tokens.Revoke(c.Context(), currentUserID(c), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewAPIToken(apiToken), apiToken)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/service"
+)
+
+func (h *Handler) GetMe(c *fiber.Ctx) error {
+	userDetail, teamDetail, err := h.users.Me(currentUserID(c))
+	if err != nil {
+		return err
+	}
+	return respond(c, api.Me{
+		UserProfile: api.NewUser(&userDetail.UserProfile, h.basePath),
+		Contact:     api.NewContact(&userDetail.UserProfile),
+		Role:        currentIdentity(c).Role,
+		Team:        api.NewTeam(&userDetail.Team),
+		TeamMembers: api.NewUsers(teamDetail.Members, h.basePath),
+	}, api.NewLegacyMe(userDetail, teamDetail.Members, h.basePath))
+}
+
+func (h *Handler) UpdateMe(c *fiber.Ctx) error {
+	// JSON と multipart/form-data（アバター画像のアップロード）の両方を受け付ける
+	var req api.ProfileUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return lib.InvalidRequest(err)
+	}
+	input := service.ProfileInput{
+		UserName:         req.UserName,
+		Avatar:           req.Avatar,
+		Phone:            req.Phone,
+		EmergencyContact: req.EmergencyContact,
+	}
+	if file, err := c.FormFile("avatar"); err == nil {
+		data, err := readFormFile(file)
+		if err != nil {
+			return lib.ValidationError("avatar", err)
+		}
+		input.AvatarImage = data
+	}
+
+	userProfile, err := h.users.UpdateProfile(c.Context(), currentUserID(c), input)
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewProfile(userProfile, h.basePath), api.NewLegacyProfile(userProfile, h.basePath))
+}
+
+func (h *Handler) DeleteMe(c *fiber.Ctx) error {
+	if err := h.users.Delete(c.Context(), currentUserID(c), c.QueryBool("purge_locations", false)); err != nil {
+		return err
+	}
+	h.clearSessionCookie(c)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) ExportMe(c *fiber.Ctx) error {
+	export, err := h.users.Export(currentUserID(c))
+	if err != nil {
+		return err
+	}
+	c.Attachment("tenchi-geolocation-export.json")
+	return respond(c, api.NewExport(export, h.basePath), api.LegacyExport(*export, h.basePath))
+}
+
+func (h *Handler) GetUser(c *fiber.Ctx) error {
+	userDetail, err := h.users.GetUser(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewUserDetail(userDetail, h.basePath), api.LegacyUserDetail(*userDetail, h.basePath))
+}
+
+func (h *Handler) ChangeUserName(c *fiber.Ctx) error {
+	var req api.UserNameRequest
+	if err := c.BodyParser(&req); err != nil {
+		return lib.InvalidRequest(err)
+	}
+	userProfile, err := h.users.ChangeUserName(c.Context(), currentUserID(c), req.Name)
+	if err != nil {
+		return err
+	}
+	return respond(c, api.NewUser(userProfile, h.basePath), api.LegacyUser(*userProfile, h.basePath))
+}
+
+func (h *Handler) GetAvatar(c *fiber.Ctx) error {
+	data, contentType, err := h.users.Avatar(c.Context(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+	// URL に更新時刻が入っているので長めにキャッシュさせる
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(data)
+}
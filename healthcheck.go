@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+const healthcheckUsage = `usage: tenchi-geolocation [flags] healthcheck
+
+Requests <BasePath>/readyz from the server on the configured listen address and
+exits with a non-zero status unless it is ready. For container health checks.`
+
+// runHealthcheck implements the "healthcheck" subcommand. It reads the same
+// configuration as the server, so it follows Listen and BasePath.
+func runHealthcheck(cfg *lib.Config, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%s", healthcheckUsage)
+	}
+	host, port, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	url := "http://" + net.JoinHostPort(host, port) + cfg.BasePath + "/readyz"
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
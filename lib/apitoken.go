@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	ScopeGeoRead  = "geo:read"
+	ScopeGeoWrite = "geo:write"
+	ScopeAdmin    = "admin"
+)
+
+const (
+	RolePlayer = "player"
+	RoleAdmin  = "admin"
+)
+
+// APITokenPrefix は発行するトークンの接頭辞。ログなどで見分けやすくするため
+const APITokenPrefix = "tgeo_"
+
+var knownScopes = []string{ScopeGeoRead, ScopeGeoWrite, ScopeAdmin}
+
+// GenerateAPIToken returns a new random token and the hash to store in the database.
+// The plain token is only shown to the user once.
+func GenerateAPIToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+	token := APITokenPrefix + hex.EncodeToString(buf)
+	return token, HashAPIToken(token), nil
+}
+
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetBearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func GetBearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func ParseScopes(scopes string) []string {
+	var result []string
+	for _, s := range strings.Split(scopes, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, s := range scopes {
+		if !HasScope(knownScopes, s) {
+			return fmt.Errorf("unknown scope: %s", s)
+		}
+	}
+	return nil
+}
+
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopesForRole returns the scopes granted to a cookie session of the given role.
+func ScopesForRole(role string) []string {
+	if role == RoleAdmin {
+		return []string{ScopeGeoRead, ScopeGeoWrite, ScopeAdmin}
+	}
+	return []string{ScopeGeoRead, ScopeGeoWrite}
+}
+
+// TokenScopes returns the scopes of an API token owned by a user of the given role: the
+// scopes it was issued with, minus those the role no longer has. A token created by an
+// admin loses "admin" when the owner is demoted.
+func TokenScopes(tokenScopes []string, role string) []string {
+	granted := ScopesForRole(role)
+	var result []string
+	for _, s := range tokenScopes {
+		if HasScope(granted, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
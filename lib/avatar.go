@@ -0,0 +1,265 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+const (
+	// AvatarSize は保存するアバター画像の一辺のピクセル数
+	AvatarSize = 256
+	// AvatarKeyPrefix はこのサーバが配信するアバターとして DB に保存する値の接頭辞。
+	// /api/v1 からの相対パスで、ベースパスはレスポンスを作るときに付ける
+	AvatarKeyPrefix = "avatars/"
+
+	maxAvatarPixels     = 4096 * 4096
+	maxRemoteAvatarSize = 5 * 1024 * 1024
+)
+
+var ErrAvatarNotFound = errors.New("avatar not found")
+
+var avatarKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// AvatarStore keeps processed avatar images keyed by user ID.
+type AvatarStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// AvatarProfiles is the part of the user repository the avatar helpers need.
+type AvatarProfiles interface {
+	SetGoogleAvatarURL(userID string, pictureURL string) (*structs.UserProfile, error)
+	UpdateUserProfile(userID string, update structs.ProfileUpdate) (*structs.UserProfile, error)
+	ListProfilesWithRemoteAvatar() ([]structs.UserProfile, error)
+}
+
+type AvatarConfig struct {
+	Storage     string // "local" or "s3"
+	Dir         string
+	S3Endpoint  string
+	S3Bucket    string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+func NewAvatarStore(cfg AvatarConfig) (AvatarStore, error) {
+	switch cfg.Storage {
+	case "", "local":
+		return &LocalAvatarStore{Dir: cfg.Dir}, nil
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+			return nil, fmt.Errorf("s3 avatar storage requires endpoint, bucket, access key and secret key")
+		}
+		return NewS3AvatarStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown avatar storage: %s", cfg.Storage)
+	}
+}
+
+// LocalAvatarStore stores avatars as files in Dir.
+type LocalAvatarStore struct {
+	Dir string
+}
+
+func (s *LocalAvatarStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !ValidAvatarKey(key) {
+		return fmt.Errorf("invalid avatar key: %q", key)
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	// 書きかけのファイルを配信しないよう、一時ファイルに書いてから置き換える
+	tmp, err := os.CreateTemp(s.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, key))
+}
+
+func (s *LocalAvatarStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	if !ValidAvatarKey(key) {
+		return nil, "", ErrAvatarNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrAvatarNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	return data, http.DetectContentType(data), nil
+}
+
+func (s *LocalAvatarStore) Delete(ctx context.Context, key string) error {
+	if !ValidAvatarKey(key) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.Dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func ValidAvatarKey(key string) bool {
+	return avatarKeyPattern.MatchString(key)
+}
+
+// AvatarKey is the value stored as the avatar URL of an avatar in the store. The version
+// query changes on every update so browsers do not show a stale image.
+func AvatarKey(userID string) string {
+	return AvatarKeyPrefix + userID + "?v=" + strconv.FormatInt(time.Now().Unix(), 10)
+}
+
+// ProcessAvatar decodes an image, crops it to a centered square and resizes it to
+// AvatarSize, returning PNG data.
+func ProcessAvatar(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("avatar must be a PNG, JPEG, GIF or WebP image")
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return nil, fmt.Errorf("avatar must be at most %d pixels", maxAvatarPixels)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode avatar: %w", err)
+	}
+
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+	size := AvatarSize
+	if side < size {
+		size = side
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func StoreAvatar(ctx context.Context, store AvatarStore, userID string, data []byte) error {
+	processed, err := ProcessAvatar(data)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, userID, processed, "image/png")
+}
+
+// FetchRemoteAvatar downloads an avatar such as a Google profile picture.
+func FetchRemoteAvatar(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch avatar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch avatar: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteAvatarSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRemoteAvatarSize {
+		return nil, fmt.Errorf("remote avatar is too large")
+	}
+	return data, nil
+}
+
+// SyncGoogleAvatar remembers the latest Google picture URL and, unless the user
+// uploaded their own avatar, copies the picture into the store.
+func SyncGoogleAvatar(ctx context.Context, db AvatarProfiles, store AvatarStore, userID string, pictureURL string) error {
+	userProfile, err := db.SetGoogleAvatarURL(userID, pictureURL)
+	if err != nil {
+		return err
+	}
+	if userProfile.AvatarSource != structs.AvatarSourceGoogle || pictureURL == "" {
+		return nil
+	}
+	return CacheGoogleAvatar(ctx, db, store, userProfile)
+}
+
+func CacheGoogleAvatar(ctx context.Context, db AvatarProfiles, store AvatarStore, userProfile *structs.UserProfile) error {
+	if userProfile.GoogleAvatarURL == "" {
+		return fmt.Errorf("user %s has no Google avatar", userProfile.ID)
+	}
+	data, err := FetchRemoteAvatar(ctx, userProfile.GoogleAvatarURL)
+	if err != nil {
+		return err
+	}
+	if err := StoreAvatar(ctx, store, userProfile.ID, data); err != nil {
+		return err
+	}
+	avatarURL := AvatarKey(userProfile.ID)
+	source := structs.AvatarSourceGoogle
+	_, err = db.UpdateUserProfile(userProfile.ID, structs.ProfileUpdate{AvatarURL: &avatarURL, AvatarSource: &source})
+	return err
+}
+
+// CacheRemoteAvatars copies avatars that are still hot-linked to Google into the store.
+func CacheRemoteAvatars(ctx context.Context, db AvatarProfiles, store AvatarStore) {
+	profiles, err := db.ListProfilesWithRemoteAvatar()
+	if err != nil {
+		slog.Warn("Failed to list remote avatars", "error", err)
+		return
+	}
+	for i := range profiles {
+		if ctx.Err() != nil {
+			return
+		}
+		userProfile := &profiles[i]
+		// 旧バージョンでは Google の URL を AvatarURL にだけ保存していた
+		if userProfile.GoogleAvatarURL == "" {
+			userProfile, err = db.SetGoogleAvatarURL(userProfile.ID, userProfile.AvatarURL)
+			if err != nil {
+				slog.Warn("Failed to save Google avatar URL", "user_id", profiles[i].ID, "error", err)
+				continue
+			}
+		}
+		if err := CacheGoogleAvatar(ctx, db, store, userProfile); err != nil {
+			slog.Warn("Failed to cache avatar", "user_id", userProfile.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned by CacheStore.Get when the key does not exist or has expired.
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheStore is a small key-value cache. MemoryCache keeps the values in the process;
+// RedisCache shares them between replicas.
+type CacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores the value. A ttl of 0 keeps it until it is overwritten.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Incr atomically increments the integer stored at key (0 if missing) and returns it.
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+type CacheConfig struct {
+	Backend  string // "memory", "redis" or "none"
+	RedisURL string // redis://[user:password@]host:port/db または rediss://...
+	TTL      time.Duration
+}
+
+// NewCacheStore returns nil for the "none" backend.
+func NewCacheStore(cfg CacheConfig) (CacheStore, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryCache(), nil
+	case "redis":
+		if cfg.RedisURL == "" {
+			return nil, fmt.Errorf("redis cache requires redis_url")
+		}
+		return NewRedisCache(cfg.RedisURL)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %q", cfg.Backend)
+	}
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time // ゼロ値なら期限なし
+}
+
+// memorySweepInterval is how often MemoryCache drops expired entries that are not read
+// again. Sweeping on every write would scan the whole map under the lock.
+const memorySweepInterval = time.Minute
+
+type MemoryCache struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextSweep time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[string]memoryEntry{}}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.expired(entry, time.Now()) {
+		delete(c.entries, key)
+		return nil, ErrCacheMiss
+	}
+	return entry.value, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.sweep(now)
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+func (c *MemoryCache) Incr(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int64
+	if entry, ok := c.entries[key]; ok && !c.expired(entry, time.Now()) {
+		var err error
+		if n, err = strconv.ParseInt(string(entry.value), 10, 64); err != nil {
+			return 0, fmt.Errorf("value of %q is not an integer", key)
+		}
+	}
+	n++
+	c.entries[key] = memoryEntry{value: []byte(strconv.FormatInt(n, 10))}
+	return n, nil
+}
+
+// sweep drops the expired entries, at most once per memorySweepInterval. The caller
+// holds c.mu.
+func (c *MemoryCache) sweep(now time.Time) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+	c.nextSweep = now.Add(memorySweepInterval)
+	for k, entry := range c.entries {
+		if c.expired(entry, now) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+func (c *MemoryCache) expired(entry memoryEntry, now time.Time) bool {
+	return !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt)
+}
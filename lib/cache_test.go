@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheSweepsOnInterval(t *testing.T) {
+	c := NewMemoryCache()
+	ctx := context.Background()
+	if err := c.Set(ctx, "old", []byte("1"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// 直前に掃除したばかりなので、書き込みのたびには全体を走査しない
+	if err := c.Set(ctx, "new", []byte("2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.entries["old"]; !ok {
+		t.Fatal("expired entry was swept before the interval elapsed")
+	}
+
+	c.nextSweep = time.Now()
+	if _, _, err := c.Hit(ctx, "counter", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.entries["old"]; ok {
+		t.Error("expired entry was not swept after the interval")
+	}
+	if _, err := c.Get(ctx, "new"); err != nil {
+		t.Errorf("Get(new) error = %v", err)
+	}
+}
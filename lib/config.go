@@ -0,0 +1,673 @@
+package lib
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"gopkg.in/ini.v1"
+)
+
+// Config is the server configuration. Each setting is read from the INI file, then
+// from the environment variable TENCHI_<NAME>, then from the flag -<name>; later
+// sources win.
+type Config struct {
+	// Listen は "host:port" 形式の待ち受けアドレス
+	Listen string
+	// ShutdownDelay は終了の合図を受けてから /readyz を失敗させたまま待つ時間。
+	// ロードバランサが振り分けをやめるまで新しいリクエストも受け付ける
+	ShutdownDelay time.Duration
+	// ShutdownTimeout は処理中のリクエストとバックグラウンド処理の終了を待つ上限
+	ShutdownTimeout time.Duration
+	// BasePath はアプリを置く URL のパス（"/tenchi" など）。ルートに置く場合は空
+	BasePath string
+	// TrustedProxies は X-Forwarded-For と X-Forwarded-Proto を信用するリバースプロキシ
+	TrustedProxies TrustedProxies
+	Cookie         CookieConfig
+
+	Google    GoogleConfig
+	JWT       JWTConfig
+	Database  DatabaseConfig
+	Retention RetentionConfig
+	Avatar    AvatarConfig
+	Cache     CacheConfig
+	Webhook   WebhookConfig
+	Game      GameConfig
+	Metrics   MetricsConfig
+	Log       LogConfig
+	RateLimit RateLimitConfig
+	Security  SecurityConfig
+
+	// File は読み込んだ設定ファイルのパス。ファイルがなければ空
+	File string
+	// SecretsFile は暗号化した設定ファイルのパス。使っていなければ空
+	SecretsFile string
+
+	values   map[string]configValue
+	problems []string
+	// invalid は値を解釈できなかった設定。Validate で重ねて報告しない
+	invalid map[string]bool
+}
+
+type GoogleConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+type JWTConfig struct {
+	Secret string
+	KeyID  string
+	// PreviousKeys はローテーション前の鍵（kid -> secret）。検証のみに使う
+	PreviousKeys map[string]string
+}
+
+type RetentionConfig struct {
+	Interval time.Duration
+}
+
+type CookieConfig struct {
+	// Secure が false なら HTTP でもログインできる。ローカルでの動作確認用
+	Secure bool
+	// Domain は Cookie の Domain 属性。空ならアクセスしたホストのみ
+	Domain string
+}
+
+type MetricsConfig struct {
+	Enabled bool
+	// Token は /metrics に要求する Authorization: Bearer <Token>。Enabled なら必須
+	Token string
+}
+
+type SecurityConfig struct {
+	// CSP は Content-Security-Policy ヘッダの値。空なら送らない
+	CSP string
+	// HSTSMaxAge は HTTPS のレスポンスに付ける Strict-Transport-Security の max-age。0 なら送らない
+	HSTSMaxAge time.Duration
+	// CORSOrigins は他のオリジンから API を呼び出すことを許すオリジン（https://example.com など）
+	CORSOrigins []string
+	// CSRF はログインセッションでの状態を変えるリクエストに CSRF トークンを要求する
+	CSRF bool
+}
+
+// DefaultCSP allows the map page to load Leaflet from unpkg.com and tiles from
+// OpenStreetMap. Leaflet and the page set inline styles, so those are allowed.
+const DefaultCSP = "default-src 'self'; script-src 'self' https://unpkg.com; " +
+	"style-src 'self' 'unsafe-inline' https://unpkg.com; " +
+	"img-src 'self' data: https://unpkg.com https://*.tile.openstreetmap.org https://www.gravatar.com https://*.googleusercontent.com; " +
+	"connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// GameConfig describes when players may submit their location: within SubmissionWindow before
+// or after every multiple of SubmissionInterval since midnight in Location.
+type GameConfig struct {
+	Location           *time.Location
+	SubmissionInterval time.Duration
+	SubmissionWindow   time.Duration
+}
+
+// InSubmissionWindow reports whether a location sent at t is accepted. Only hours and
+// minutes are compared.
+func (g GameConfig) InSubmissionWindow(t time.Time) bool {
+	t = t.In(g.Location)
+	interval := int(g.SubmissionInterval / time.Minute)
+	window := int(g.SubmissionWindow / time.Minute)
+	offset := (t.Hour()*60 + t.Minute()) % interval
+	return offset <= window || offset >= interval-window
+}
+
+// SubmissionSlot returns the submission window t belongs to, as the HH:MM of the nearest
+// multiple of SubmissionInterval.
+func (g GameConfig) SubmissionSlot(t time.Time) string {
+	t = t.In(g.Location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, g.Location)
+	return midnight.Add(t.Sub(midnight).Round(g.SubmissionInterval)).Format("15:04")
+}
+
+// ConfigError lists every problem found in the configuration.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type setting struct {
+	name    string // フラグ名。環境変数は TENCHI_ + 大文字・アンダースコア
+	section string
+	key     string
+	def     string
+	secret  bool
+	usage   string
+}
+
+// jwtPreviousKeys は INI では [JWTKeys] セクションの kid = secret、環境変数とフラグでは
+// "kid=secret,kid=secret" の形式で指定する
+const jwtPreviousKeys = "jwt-previous-keys"
+
+var settings = []setting{
+	{name: "listen", section: "Server", key: "Listen", def: ":3000", usage: "address to listen on"},
+	{name: "shutdown-delay", section: "Server", key: "ShutdownDelay", def: "0s", usage: "how long /readyz fails before the server stops accepting requests on SIGTERM"},
+	{name: "shutdown-timeout", section: "Server", key: "ShutdownTimeout", def: "30s", usage: "how long to wait for in-flight requests and background jobs on shutdown"},
+	{name: "base-path", section: "Server", key: "BasePath", usage: "URL path the app is served under, e.g. /tenchi (default: the root)"},
+	{name: "trusted-proxies", section: "Server", key: "TrustedProxies", usage: "comma-separated IP addresses or CIDR ranges of reverse proxies whose X-Forwarded-For/-Proto are trusted"},
+	{name: "cookie-secure", section: "Server", key: "CookieSecure", def: "true", usage: "mark cookies Secure (sent over HTTPS only)"},
+	{name: "cookie-domain", section: "Server", key: "CookieDomain", usage: "Domain attribute of the cookies (default: the requested host)"},
+	{name: "google-client-id", section: "Google", key: "ClientID", usage: "Google OAuth client ID"},
+	{name: "google-client-secret", section: "Google", key: "ClientSecret", secret: true, usage: "Google OAuth client secret"},
+	{name: "google-redirect-url", section: "Google", key: "RedirectURL", usage: "Google OAuth redirect URL (https://.../api/v1/callback)"},
+	{name: "jwt-secret", section: "Server", key: "JWTTokenSecret", secret: true, usage: "secret for signing session tokens"},
+	{name: "jwt-key-id", section: "Server", key: "JWTKeyID", usage: "key ID of jwt-secret"},
+	{name: jwtPreviousKeys, section: "JWTKeys", secret: true, usage: "previous keys for verification only (kid=secret,...)"},
+	{name: "database-driver", section: "database", key: "driver", def: DriverPostgres, usage: "postgres or sqlite"},
+	{name: "database-dsn", section: "database", key: "dsn", secret: true, usage: "Postgres connection string or SQLite file (default ./data/main.db)"},
+	{name: "database-auto-migrate", section: "database", key: "auto_migrate", def: "true", usage: "apply pending migrations on startup"},
+	{name: "retention-interval", section: "retention", key: "interval", def: "1h", usage: "how often the retention policy is applied"},
+	{name: "avatar-storage", section: "avatar", key: "storage", def: "local", usage: "local or s3"},
+	{name: "avatar-dir", section: "avatar", key: "dir", def: "./data/avatars", usage: "directory for local avatar storage"},
+	{name: "avatar-s3-endpoint", section: "avatar", key: "s3_endpoint", usage: "S3 endpoint URL"},
+	{name: "avatar-s3-bucket", section: "avatar", key: "s3_bucket", usage: "S3 bucket"},
+	{name: "avatar-s3-region", section: "avatar", key: "s3_region", usage: "S3 region"},
+	{name: "avatar-s3-access-key", section: "avatar", key: "s3_access_key", usage: "S3 access key"},
+	{name: "avatar-s3-secret-key", section: "avatar", key: "s3_secret_key", secret: true, usage: "S3 secret key"},
+	{name: "cache-backend", section: "cache", key: "backend", def: "memory", usage: "memory, redis or none"},
+	{name: "cache-redis-url", section: "cache", key: "redis_url", secret: true, usage: "redis://[user:password@]host:port/db"},
+	{name: "cache-ttl", section: "cache", key: "ttl", def: "5m", usage: "maximum age of cached positions"},
+	{name: "webhook-url", section: "webhook", key: "url", secret: true, usage: "Discord webhook URL for location updates"},
+	{name: "webhook-avatar-url", section: "webhook", key: "avatar_url", usage: "icon shown in Discord"},
+	{name: "game-time-zone", section: "game", key: "time_zone", def: "Local", usage: "time zone of the submission windows (e.g. Asia/Tokyo)"},
+	{name: "game-submission-interval", section: "game", key: "submission_interval", def: "30m", usage: "locations are submitted every interval from midnight"},
+	{name: "game-submission-window", section: "game", key: "submission_window", def: "3m", usage: "how long before and after each interval submissions are accepted"},
+	{name: "metrics-enabled", section: "metrics", key: "enabled", def: "false", usage: "serve Prometheus metrics at /metrics (requires metrics-token)"},
+	{name: "metrics-token", section: "metrics", key: "token", secret: true, usage: "bearer token required to read /metrics"},
+	{name: "log-level", section: "log", key: "level", def: "info", usage: "debug, info, warn or error; debug also logs coordinates, emails and tokens"},
+	{name: "log-format", section: "log", key: "format", def: "json", usage: "json or text"},
+	{name: "security-csp", section: "security", key: "csp", def: DefaultCSP, usage: "Content-Security-Policy header (\"off\" to omit)"},
+	{name: "security-hsts-max-age", section: "security", key: "hsts_max_age", def: "8760h", usage: "max-age of Strict-Transport-Security on HTTPS responses (0 to omit)"},
+	{name: "security-cors-origins", section: "security", key: "cors_origins", usage: "comma-separated origins allowed to call the API from other sites"},
+	{name: "security-csrf", section: "security", key: "csrf", def: "true", usage: "require the X-CSRF-Token header on state-changing requests with the session cookie"},
+	{name: "ratelimit-backend", section: "ratelimit", key: "backend", def: "memory", usage: "memory or redis (shared between instances, uses cache-redis-url)"},
+	{name: "ratelimit-ip", section: "ratelimit", key: "ip", def: "600/1m", usage: "API requests per client IP address (<requests>/<window> or off)"},
+	{name: "ratelimit-user", section: "ratelimit", key: "user", def: "300/1m", usage: "authenticated API requests per user"},
+	{name: "ratelimit-login", section: "ratelimit", key: "login", def: "20/5m", usage: "sign-in attempts (/login and /callback) per client IP address"},
+	{name: "ratelimit-geo", section: "ratelimit", key: "geo", def: "10/1m", usage: "location submissions per user"},
+	{name: "ratelimit-profile", section: "ratelimit", key: "profile", def: "10/10m", usage: "profile, user name and team changes per user"},
+}
+
+// ConfigSetting is the effective value of one setting, for "config check".
+type ConfigSetting struct {
+	Name   string
+	Env    string
+	Value  string // 秘密の値は伏せてある
+	Secret bool
+	Source string // "default", "file", "secrets", "env" または "flag"
+	// Ref は値を file: で参照している場合の参照先
+	Ref string
+}
+
+type configValue struct {
+	value  string
+	source string
+	ref    string // file: で参照していればその値
+}
+
+func settingEnv(name string) string {
+	return "TENCHI_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// LoadConfig reads the configuration and returns the arguments left after the flags
+// (the command). The file is given by -config or TENCHI_CONFIG (default .env) and may
+// be missing if it was not set explicitly. Invalid values are reported by Validate.
+func LoadConfig(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("tenchi-geolocation", flag.ContinueOnError)
+	configFile := fs.String("config", "", "configuration file (env: TENCHI_CONFIG, default .env)")
+	secretsFile := fs.String("secrets", "", "encrypted secrets file, decrypted with "+SecretsKeyEnv+" (env: TENCHI_SECRETS)")
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (env: %s)", s.usage, settingEnv(s.name))
+		if s.def != "" {
+			usage += fmt.Sprintf(" (default %q)", s.def)
+		}
+		flagValues[s.name] = fs.String(s.name, "", usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	path, explicit := *configFile, true
+	if path == "" {
+		path, explicit = os.Getenv("TENCHI_CONFIG"), true
+	}
+	if path == "" {
+		path, explicit = ".env", false
+	}
+	var file *ini.File
+	if _, err := os.Stat(path); err == nil || explicit {
+		if file, err = ini.Load(path); err != nil {
+			return nil, nil, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+	} else {
+		path = ""
+	}
+
+	cfg := &Config{File: path, values: map[string]configValue{}, invalid: map[string]bool{}}
+	for _, s := range settings {
+		if s.def != "" {
+			cfg.values[s.name] = configValue{value: s.def, source: "default"}
+		}
+	}
+	if file != nil {
+		cfg.applyINI(file, "file")
+	}
+
+	secretsPath := *secretsFile
+	if secretsPath == "" {
+		secretsPath = os.Getenv("TENCHI_SECRETS")
+	}
+	if secretsPath != "" {
+		cfg.SecretsFile = secretsPath
+		if secrets, err := loadSecretsFile(secretsPath); err != nil {
+			cfg.problem("secrets", "%v", err)
+		} else {
+			cfg.applyINI(secrets, "secrets")
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(settingEnv(s.name)); ok {
+			cfg.values[s.name] = configValue{value: v, source: "env"}
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if v, ok := flagValues[f.Name]; ok {
+			cfg.values[f.Name] = configValue{value: *v, source: "flag"}
+		}
+	})
+
+	cfg.resolveFileRefs()
+	cfg.parse()
+	return cfg, fs.Args(), nil
+}
+
+// applyINI sets the values found in an INI file (the configuration or secrets file).
+func (c *Config) applyINI(file *ini.File, source string) {
+	for _, s := range settings {
+		if s.name == jwtPreviousKeys {
+			var pairs []string
+			for _, key := range file.Section(s.section).Keys() {
+				pairs = append(pairs, key.Name()+"="+key.String())
+			}
+			if len(pairs) > 0 {
+				c.values[s.name] = configValue{value: strings.Join(pairs, ","), source: source}
+			}
+		} else if file.Section(s.section).HasKey(s.key) {
+			c.values[s.name] = configValue{value: file.Section(s.section).Key(s.key).String(), source: source}
+		}
+	}
+}
+
+func loadSecretsFile(path string) (*ini.File, error) {
+	key, err := SecretsKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := OpenSecrets(key, data)
+	if err != nil {
+		return nil, err
+	}
+	return ini.Load(plaintext)
+}
+
+// resolveFileRefs replaces "file:<path>" values with the content of the file. In
+// jwt-previous-keys each secret of the kid=secret pairs may be a reference.
+func (c *Config) resolveFileRefs() {
+	for name, v := range c.values {
+		if name == jwtPreviousKeys {
+			pairs := strings.Split(v.value, ",")
+			for i, pair := range pairs {
+				kid, secret, ok := strings.Cut(pair, "=")
+				if !ok || !strings.HasPrefix(secret, fileRefPrefix) {
+					continue
+				}
+				resolved, err := ResolveFileRef(secret)
+				if err != nil {
+					c.problem(name, "%v", err)
+					continue
+				}
+				pairs[i] = kid + "=" + resolved
+				v.ref = "file"
+			}
+			v.value = strings.Join(pairs, ",")
+			c.values[name] = v
+			continue
+		}
+		if !strings.HasPrefix(v.value, fileRefPrefix) {
+			continue
+		}
+		v.ref = v.value
+		resolved, err := ResolveFileRef(v.value)
+		if err != nil {
+			c.problem(name, "%v", err)
+		}
+		v.value = resolved
+		c.values[name] = v
+	}
+}
+
+func (c *Config) str(name string) string {
+	return c.values[name].value
+}
+
+func (c *Config) problem(name string, format string, args ...interface{}) {
+	c.problems = append(c.problems, name+": "+fmt.Sprintf(format, args...))
+	c.invalid[name] = true
+}
+
+func (c *Config) duration(name string) time.Duration {
+	d, err := time.ParseDuration(c.str(name))
+	if err != nil {
+		c.problem(name, "invalid duration %q", c.str(name))
+	}
+	return d
+}
+
+func (c *Config) bool(name string) bool {
+	b, err := strconv.ParseBool(c.str(name))
+	if err != nil {
+		c.problem(name, "invalid boolean %q", c.str(name))
+	}
+	return b
+}
+
+func (c *Config) rateLimit(name string) RateLimit {
+	r, err := ParseRateLimit(c.str(name))
+	if err != nil {
+		c.problem(name, "%v", err)
+	}
+	return r
+}
+
+// parse converts the raw values and records the values that cannot be parsed.
+func (c *Config) parse() {
+	c.Listen = c.str("listen")
+	c.ShutdownDelay = c.duration("shutdown-delay")
+	c.ShutdownTimeout = c.duration("shutdown-timeout")
+	c.BasePath = strings.TrimRight(c.str("base-path"), "/")
+	var proxies []string
+	for _, proxy := range strings.Split(c.str("trusted-proxies"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if trusted, err := ParseTrustedProxies(proxies); err != nil {
+		c.problem("trusted-proxies", "%v", err)
+	} else {
+		c.TrustedProxies = trusted
+	}
+	c.Cookie = CookieConfig{
+		Secure: c.bool("cookie-secure"),
+		Domain: c.str("cookie-domain"),
+	}
+	c.Google = GoogleConfig{
+		ClientID:     c.str("google-client-id"),
+		ClientSecret: c.str("google-client-secret"),
+		RedirectURL:  c.str("google-redirect-url"),
+	}
+	c.JWT = JWTConfig{
+		Secret:       c.str("jwt-secret"),
+		KeyID:        c.str("jwt-key-id"),
+		PreviousKeys: map[string]string{},
+	}
+	if previous := c.str(jwtPreviousKeys); previous != "" {
+		for _, pair := range strings.Split(previous, ",") {
+			kid, secret, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(kid) == "" {
+				c.problem(jwtPreviousKeys, "expected kid=secret pairs")
+				break
+			}
+			c.JWT.PreviousKeys[strings.TrimSpace(kid)] = secret
+		}
+	}
+	c.Database = DatabaseConfig{
+		Driver:      c.str("database-driver"),
+		DSN:         c.str("database-dsn"),
+		AutoMigrate: c.bool("database-auto-migrate"),
+	}
+	if c.Database.Driver == DriverSQLite && c.Database.DSN == "" {
+		c.Database.DSN = "./data/main.db"
+	}
+	c.Retention = RetentionConfig{Interval: c.duration("retention-interval")}
+	c.Avatar = AvatarConfig{
+		Storage:     c.str("avatar-storage"),
+		Dir:         c.str("avatar-dir"),
+		S3Endpoint:  c.str("avatar-s3-endpoint"),
+		S3Bucket:    c.str("avatar-s3-bucket"),
+		S3Region:    c.str("avatar-s3-region"),
+		S3AccessKey: c.str("avatar-s3-access-key"),
+		S3SecretKey: c.str("avatar-s3-secret-key"),
+	}
+	c.Cache = CacheConfig{
+		Backend:  c.str("cache-backend"),
+		RedisURL: c.str("cache-redis-url"),
+		TTL:      c.duration("cache-ttl"),
+	}
+	c.Webhook = WebhookConfig{
+		URL:       c.str("webhook-url"),
+		AvatarURL: c.str("webhook-avatar-url"),
+	}
+	c.Game = GameConfig{
+		Location:           time.Local,
+		SubmissionInterval: c.duration("game-submission-interval"),
+		SubmissionWindow:   c.duration("game-submission-window"),
+	}
+	if loc, err := time.LoadLocation(c.str("game-time-zone")); err != nil {
+		c.problem("game-time-zone", "unknown time zone %q", c.str("game-time-zone"))
+	} else {
+		c.Game.Location = loc
+	}
+	c.Metrics = MetricsConfig{
+		Enabled: c.bool("metrics-enabled"),
+		Token:   c.str("metrics-token"),
+	}
+	c.RateLimit = RateLimitConfig{
+		Backend: c.str("ratelimit-backend"),
+		IP:      c.rateLimit("ratelimit-ip"),
+		User:    c.rateLimit("ratelimit-user"),
+		Login:   c.rateLimit("ratelimit-login"),
+		Geo:     c.rateLimit("ratelimit-geo"),
+		Profile: c.rateLimit("ratelimit-profile"),
+	}
+	c.Security = SecurityConfig{
+		CSP:        c.str("security-csp"),
+		HSTSMaxAge: c.duration("security-hsts-max-age"),
+		CSRF:       c.bool("security-csrf"),
+	}
+	if c.Security.CSP == "off" {
+		c.Security.CSP = ""
+	}
+	for _, origin := range strings.Split(c.str("security-cors-origins"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			c.Security.CORSOrigins = append(c.Security.CORSOrigins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	c.Log = LogConfig{Format: c.str("log-format")}
+	if level, err := parseLogLevel(c.str("log-level")); err != nil {
+		c.problem("log-level", "%v", err)
+	} else {
+		c.Log.Level = level
+	}
+}
+
+// Validate returns a *ConfigError listing every problem, or nil.
+func (c *Config) Validate() error {
+	problems := append([]string(nil), c.problems...)
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		add("listen: %q is not a host:port address", c.Listen)
+	}
+	if c.ShutdownDelay < 0 && !c.invalid["shutdown-delay"] {
+		add("shutdown-delay must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 && !c.invalid["shutdown-timeout"] {
+		add("shutdown-timeout must be positive")
+	}
+
+	if c.BasePath != "" {
+		if u, err := url.Parse(c.BasePath); err != nil || !strings.HasPrefix(c.BasePath, "/") || u.Path != c.BasePath || strings.Contains(c.BasePath, "//") {
+			add("base-path: %q is not a path like /tenchi", c.BasePath)
+		}
+	}
+
+	if c.Google.ClientID == "" {
+		add("google-client-id is required")
+	}
+	if c.Google.ClientSecret == "" {
+		add("google-client-secret is required")
+	}
+	if u, err := url.Parse(c.Google.RedirectURL); c.Google.RedirectURL == "" {
+		add("google-redirect-url is required")
+	} else if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("google-redirect-url: %q is not an http(s) URL", c.Google.RedirectURL)
+	}
+
+	if _, err := c.JWTKeySet(); err != nil {
+		add("jwt: %v", err)
+	}
+
+	switch c.Database.Driver {
+	case DriverPostgres:
+		if c.Database.DSN == "" {
+			add("database-dsn is required for postgres")
+		}
+	case DriverSQLite:
+	default:
+		add("database-driver: unknown driver %q", c.Database.Driver)
+	}
+
+	if c.Retention.Interval <= 0 && !c.invalid["retention-interval"] {
+		add("retention-interval must be positive")
+	}
+
+	switch c.Avatar.Storage {
+	case "local":
+		if c.Avatar.Dir == "" {
+			add("avatar-dir is required for local avatar storage")
+		}
+	case "s3":
+		for _, name := range []string{"avatar-s3-endpoint", "avatar-s3-bucket", "avatar-s3-access-key", "avatar-s3-secret-key"} {
+			if c.str(name) == "" {
+				add("%s is required for s3 avatar storage", name)
+			}
+		}
+	default:
+		add("avatar-storage: unknown storage %q", c.Avatar.Storage)
+	}
+
+	switch c.Cache.Backend {
+	case "memory", "none":
+	case "redis":
+		if c.Cache.RedisURL == "" {
+			add("cache-redis-url is required for the redis cache")
+		} else if _, err := redis.ParseURL(c.Cache.RedisURL); err != nil {
+			add("cache-redis-url: %v", err)
+		}
+	default:
+		add("cache-backend: unknown backend %q", c.Cache.Backend)
+	}
+	if c.Cache.TTL <= 0 && !c.invalid["cache-ttl"] {
+		add("cache-ttl must be positive")
+	}
+
+	// 位置情報の送信数などを外部に晒さないよう、トークンなしでは公開しない
+	if c.Metrics.Enabled && c.Metrics.Token == "" {
+		add("metrics-token is required when metrics are enabled")
+	}
+
+	if c.Webhook.URL != "" && !strings.HasPrefix(c.Webhook.URL, "http://") && !strings.HasPrefix(c.Webhook.URL, "https://") {
+		add("webhook-url must start with http:// or https://")
+	}
+
+	interval, window := c.Game.SubmissionInterval, c.Game.SubmissionWindow
+	switch {
+	case c.invalid["game-submission-interval"] || c.invalid["game-submission-window"]:
+	case interval < time.Minute || interval%time.Minute != 0 || (24*time.Hour)%interval != 0:
+		add("game-submission-interval must be whole minutes that divide a day evenly")
+	case window < 0 || window%time.Minute != 0 || 2*window >= interval:
+		add("game-submission-window must be whole minutes and less than half of game-submission-interval")
+	}
+
+	if c.Security.HSTSMaxAge < 0 && !c.invalid["security-hsts-max-age"] {
+		add("security-hsts-max-age must not be negative")
+	}
+	for _, origin := range c.Security.CORSOrigins {
+		// 認証情報付きのリクエストを許すので * は使えない
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			add("security-cors-origins: %q is not an origin like https://example.com", origin)
+		}
+	}
+
+	switch c.RateLimit.Backend {
+	case "memory":
+	case "redis":
+		if c.Cache.RedisURL == "" {
+			add("cache-redis-url is required for the redis rate limit backend")
+		}
+	default:
+		add("ratelimit-backend: unknown backend %q", c.RateLimit.Backend)
+	}
+
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("log-format: unknown format %q", c.Log.Format)
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+func (c *Config) OAuth2() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.Google.ClientID,
+		ClientSecret: c.Google.ClientSecret,
+		RedirectURL:  c.Google.RedirectURL,
+		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
+		Endpoint:     google.Endpoint,
+	}
+}
+
+func (c *Config) JWTKeySet() (*JWTKeySet, error) {
+	return NewJWTKeySet(c.JWT.KeyID, c.JWT.Secret, c.JWT.PreviousKeys)
+}
+
+// Settings returns the effective value and source of every setting, with secrets masked.
+func (c *Config) Settings() []ConfigSetting {
+	var result []ConfigSetting
+	for _, s := range settings {
+		v, ok := c.values[s.name]
+		if !ok {
+			v = configValue{value: "", source: "unset"}
+		}
+		value := v.value
+		if s.secret && value != "" {
+			value = "********"
+		}
+		result = append(result, ConfigSetting{Name: s.name, Env: settingEnv(s.name), Value: value, Secret: s.secret, Source: v.source, Ref: v.ref})
+	}
+	return result
+}
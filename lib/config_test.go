@@ -0,0 +1,235 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearConfigEnv unsets every TENCHI_ variable for the test, so that the environment
+// the tests run in does not leak into the configuration.
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	names := []string{"TENCHI_CONFIG", "TENCHI_SECRETS", SecretsKeyEnv}
+	for _, s := range settings {
+		names = append(names, settingEnv(s.name))
+	}
+	for _, name := range names {
+		// t.Setenv が終了時に元の値へ戻す
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadConfig loads the configuration from an INI file with the given content, the
+// environment variables and the flags.
+func loadConfig(t *testing.T, file string, env map[string]string, args ...string) *Config {
+	t.Helper()
+	clearConfigEnv(t)
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	cfg, rest, err := LoadConfig(append([]string{"-config", writeFile(t, "config.ini", file)}, args...))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("LoadConfig() left %q", rest)
+	}
+	return cfg
+}
+
+func settingSource(cfg *Config, name string) ConfigSetting {
+	for _, s := range cfg.Settings() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return ConfigSetting{}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	const file = "[Server]\nListen = :4000\n"
+	tests := []struct {
+		name       string
+		file       string
+		env        map[string]string
+		args       []string
+		want       string
+		wantSource string
+	}{
+		{"default", "", nil, nil, ":3000", "default"},
+		{"file", file, nil, nil, ":4000", "file"},
+		{"env over file", file, map[string]string{"TENCHI_LISTEN": ":5000"}, nil, ":5000", "env"},
+		{"flag over env", file, map[string]string{"TENCHI_LISTEN": ":5000"}, []string{"-listen", ":6000"}, ":6000", "flag"},
+		{"flag over file", file, nil, []string{"-listen=:6000"}, ":6000", "flag"},
+		{"empty env", file, map[string]string{"TENCHI_LISTEN": ""}, nil, "", "env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadConfig(t, tt.file, tt.env, tt.args...)
+			if cfg.Listen != tt.want {
+				t.Errorf("Listen = %q, want %q", cfg.Listen, tt.want)
+			}
+			if s := settingSource(cfg, "listen"); s.Source != tt.wantSource || s.Env != "TENCHI_LISTEN" {
+				t.Errorf("setting = %+v, want source %q", s, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLoadConfigParsesEachSource(t *testing.T) {
+	cfg := loadConfig(t, `
+[Server]
+BasePath = /tenchi/
+TrustedProxies = 10.0.0.0/8, 192.0.2.1
+
+[JWTKeys]
+old = old-secret
+
+[game]
+time_zone = Asia/Tokyo
+submission_interval = 15m
+
+[ratelimit]
+geo = off
+`, map[string]string{
+		"TENCHI_SECURITY_CORS_ORIGINS": "https://a.example.com/, https://b.example.com",
+		"TENCHI_RATELIMIT_LOGIN":       "5/1m",
+	}, "-security-csp", "off", "-game-submission-window", "2m")
+
+	if cfg.BasePath != "/tenchi" {
+		t.Errorf("BasePath = %q, want the trailing slash removed", cfg.BasePath)
+	}
+	if got := cfg.TrustedProxies.Strings(); strings.Join(got, ",") != "10.0.0.0/8,192.0.2.1/32" {
+		t.Errorf("TrustedProxies = %q", got)
+	}
+	if cfg.JWT.PreviousKeys["old"] != "old-secret" || len(cfg.JWT.PreviousKeys) != 1 {
+		t.Errorf("PreviousKeys = %v", cfg.JWT.PreviousKeys)
+	}
+	if cfg.Game.Location.String() != "Asia/Tokyo" || cfg.Game.SubmissionInterval != 15*time.Minute || cfg.Game.SubmissionWindow != 2*time.Minute {
+		t.Errorf("Game = %+v", cfg.Game)
+	}
+	if cfg.RateLimit.Geo.Enabled() || cfg.RateLimit.Login != (RateLimit{Requests: 5, Window: time.Minute}) {
+		t.Errorf("RateLimit = %+v", cfg.RateLimit)
+	}
+	if strings.Join(cfg.Security.CORSOrigins, ",") != "https://a.example.com,https://b.example.com" {
+		t.Errorf("CORSOrigins = %q", cfg.Security.CORSOrigins)
+	}
+	if cfg.Security.CSP != "" || !cfg.Security.CSRF {
+		t.Errorf("Security = %+v", cfg.Security)
+	}
+	if cfg.Database.Driver != DriverPostgres || !cfg.Database.AutoMigrate {
+		t.Errorf("Database = %+v, want the defaults", cfg.Database)
+	}
+}
+
+func TestLoadConfigMasksSecrets(t *testing.T) {
+	cfg := loadConfig(t, "[Google]\nClientSecret = google-secret\n", nil, "-google-client-id", "client")
+	if s := settingSource(cfg, "google-client-secret"); s.Value != "********" || !s.Secret || s.Source != "file" {
+		t.Errorf("google-client-secret = %+v, want it masked", s)
+	}
+	if s := settingSource(cfg, "google-client-id"); s.Value != "client" || s.Secret {
+		t.Errorf("google-client-id = %+v", s)
+	}
+	if s := settingSource(cfg, "webhook-url"); s.Value != "" || s.Source != "unset" {
+		t.Errorf("webhook-url = %+v, want unset", s)
+	}
+}
+
+// validArgs are the flags of a configuration that passes Validate.
+var validArgs = []string{
+	"-google-client-id", "client",
+	"-google-client-secret", "secret",
+	"-google-redirect-url", "https://example.com/api/v1/callback",
+	"-jwt-secret", "jwt-secret",
+	"-database-driver", "sqlite",
+	"-game-time-zone", "UTC",
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		cfg := loadConfig(t, "", nil, validArgs...)
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Validate() = %v", err)
+		}
+		if cfg.Database.DSN != "./data/main.db" {
+			t.Errorf("DSN = %q, want the SQLite default", cfg.Database.DSN)
+		}
+	})
+
+	t.Run("reports every problem", func(t *testing.T) {
+		cfg := loadConfig(t, "[Server]\nListen = 3000\n", map[string]string{
+			"TENCHI_SHUTDOWN_TIMEOUT": "soon",
+			"TENCHI_DATABASE_DRIVER":  "mysql",
+			"TENCHI_GAME_TIME_ZONE":   "Mars/Olympus",
+		},
+			"-base-path", "tenchi",
+			"-cookie-secure", "maybe",
+			"-trusted-proxies", "proxy.example.com",
+			"-avatar-storage", "s3",
+			"-avatar-s3-bucket", "avatars",
+			"-cache-backend", "memcached",
+			"-metrics-enabled=true",
+			"-ratelimit-geo", "10",
+			"-game-submission-interval", "7m",
+			"-security-cors-origins", "*",
+			"-log-format", "xml",
+		)
+		err := cfg.Validate()
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Fatalf("Validate() = %v, want a *ConfigError", err)
+		}
+		want := []string{
+			"shutdown-timeout: invalid duration",
+			"cookie-secure: invalid boolean",
+			"trusted-proxies:",
+			"ratelimit-geo:",
+			"game-time-zone: unknown time zone",
+			`listen: "3000" is not a host:port address`,
+			`base-path: "tenchi" is not a path`,
+			"google-client-id is required",
+			"google-client-secret is required",
+			"google-redirect-url is required",
+			"jwt: JWT signing secret is empty",
+			`database-driver: unknown driver "mysql"`,
+			"avatar-s3-endpoint is required",
+			"avatar-s3-access-key is required",
+			"avatar-s3-secret-key is required",
+			`cache-backend: unknown backend "memcached"`,
+			"metrics-token is required",
+			"game-submission-interval must be whole minutes",
+			`security-cors-origins: "*"`,
+			`log-format: unknown format "xml"`,
+		}
+		for _, w := range want {
+			found := false
+			for _, p := range configErr.Problems {
+				found = found || strings.Contains(p, w)
+			}
+			if !found {
+				t.Errorf("problems do not include %q", w)
+			}
+		}
+		if len(configErr.Problems) != len(want) {
+			t.Errorf("got %d problems, want %d:\n%v", len(configErr.Problems), len(want), err)
+		}
+		// 解析できなかった値について、範囲のエラーを重ねて報告しない
+		if strings.Contains(err.Error(), "shutdown-timeout must be positive") {
+			t.Errorf("reported shutdown-timeout twice:\n%v", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+type DatabaseConfig struct {
+	// Driver は "postgres" または "sqlite"
+	Driver string
+	// DSN は Postgres なら接続文字列、SQLite ならファイルのパス
+	DSN string
+	// AutoMigrate が false なら起動時にマイグレーションを適用せず、未適用があれば起動しない
+	AutoMigrate bool
+}
+
+// sqlitePragmas are applied unless the DSN sets its own pragmas. Foreign keys are
+// off by default in SQLite, and the busy timeout avoids "database is locked" errors
+// when the retention job writes at the same time as a request.
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+// OpenDatabase opens the configured database. The SQLite driver is pure Go, so the
+// binary can be built without CGO. Constraint violations are returned as
+// gorm.ErrDuplicatedKey and gorm.ErrForeignKeyViolated with either driver.
+func OpenDatabase(cfg *DatabaseConfig) (*gorm.DB, error) {
+	gormConfig := &gorm.Config{TranslateError: true}
+	switch cfg.Driver {
+	case DriverPostgres:
+		return gorm.Open(postgres.Open(cfg.DSN), gormConfig)
+	case DriverSQLite:
+		dsn := cfg.DSN
+		path := strings.TrimPrefix(strings.SplitN(dsn, "?", 2)[0], "file:")
+		if path != "" && !strings.HasPrefix(path, ":memory:") {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return nil, err
+			}
+		}
+		if !strings.Contains(dsn, "_pragma=") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&" + sqlitePragmas
+			} else {
+				dsn += "?" + sqlitePragmas
+			}
+		}
+		return gorm.Open(sqlite.Open(dsn), gormConfig)
+	default:
+		return nil, fmt.Errorf("unknown database driver: %s", cfg.Driver)
+	}
+}
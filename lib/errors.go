@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Stable error codes returned in the "code" field. Clients should branch on these
+// instead of the human readable message.
+const (
+	CodeInvalidRequest         = "invalid_request"
+	CodeValidationFailed       = "validation_failed"
+	CodeAuthenticationRequired = "authentication_required"
+	CodeInvalidToken           = "invalid_token"
+	CodeForbidden              = "forbidden"
+	CodeMissingScope           = "missing_scope"
+	CodeSessionRequired        = "session_required"
+	CodeInvalidCSRFToken       = "invalid_csrf_token"
+	CodeNotFound               = "not_found"
+	CodeConflict               = "conflict"
+	CodeOutsideWindow          = "outside_submission_window"
+	CodePayloadTooLarge        = "payload_too_large"
+	CodeMethodNotAllowed       = "method_not_allowed"
+	CodeRateLimited            = "rate_limited"
+	CodeUpstreamError          = "upstream_error"
+	CodeInternalError          = "internal_error"
+)
+
+// APIError is rendered by ErrorHandler as {"code", "message", "details"}.
+// Err is the underlying cause; it is logged but never sent to the client.
+type APIError struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	Err     error       `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func NewAPIError(status int, code string, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) WithDetails(details interface{}) *APIError {
+	e.Details = details
+	return e
+}
+
+func (e *APIError) WithErr(err error) *APIError {
+	e.Err = err
+	return e
+}
+
+// InvalidRequest is returned when the request body cannot be parsed.
+func InvalidRequest(err error) *APIError {
+	return NewAPIError(fiber.StatusBadRequest, CodeInvalidRequest, "Invalid request data").WithErr(err)
+}
+
+// ValidationError reports which field was rejected and why.
+func ValidationError(field string, err error) *APIError {
+	return NewAPIError(fiber.StatusBadRequest, CodeValidationFailed, "Invalid "+field).
+		WithDetails(fiber.Map{"field": field, "reason": err.Error()})
+}
+
+func NotFound(message string) *APIError {
+	return NewAPIError(fiber.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *APIError {
+	return NewAPIError(fiber.StatusConflict, CodeConflict, message)
+}
+
+func Forbidden(message string) *APIError {
+	return NewAPIError(fiber.StatusForbidden, CodeForbidden, message)
+}
+
+// ErrorHandler is the Fiber error handler. Handlers return errors instead of writing
+// responses; anything that is not an APIError is mapped here so database and other
+// internal errors never reach the client.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	apiErr := toAPIError(err)
+	if apiErr.Status >= fiber.StatusInternalServerError {
+		slog.ErrorContext(c.Context(), "Request failed", "method", c.Method(), "path", c.Path(), "error", err)
+	}
+	return c.Status(apiErr.Status).JSON(apiErr)
+}
+
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotFound("Resource not found")
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		if fiberErr.Code >= fiber.StatusInternalServerError {
+			return NewAPIError(fiberErr.Code, CodeInternalError, "Internal server error")
+		}
+		return NewAPIError(fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message)
+	}
+	return NewAPIError(fiber.StatusInternalServerError, CodeInternalError, "Internal server error")
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeInvalidRequest
+	case fiber.StatusUnauthorized:
+		return CodeAuthenticationRequired
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	return CodeInvalidRequest
+}
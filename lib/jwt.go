@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// LegacyJWTKeyID is used for tokens issued before the kid header was introduced.
+const LegacyJWTKeyID = "default"
+
+const jwtLifetime = 24 * time.Hour
+
+// JWTRefreshInterval is how long the role, team and game in a session JWT are trusted.
+// After that the next request reads them from the database again and renews the token,
+// so a demoted or deleted user loses access within this interval.
+const JWTRefreshInterval = 5 * time.Minute
+
+// Identity is the authenticated caller, stored in c.Locals("identity") by Requirelogin.
+type Identity struct {
+	UserID     string
+	Role       string
+	TeamID     int
+	GameID     int
+	Scopes     []string
+	AuthMethod string // "session" or "token"
+}
+
+// IdentityFromContext returns the caller stored by RequireLogin, or nil. Fiber's
+// c.Context() returns locals from Value.
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value("identity").(*Identity)
+	return identity
+}
+
+type Claims struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role,omitempty"`
+	TeamID int    `json:"team_id,omitempty"`
+	GameID int    `json:"game_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Identity returns the caller described by the claims.
+func (c *Claims) Identity(authMethod string) *Identity {
+	return &Identity{
+		UserID:     c.UserID,
+		Role:       c.Role,
+		TeamID:     c.TeamID,
+		GameID:     c.GameID,
+		Scopes:     ScopesForRole(c.Role),
+		AuthMethod: authMethod,
+	}
+}
+
+// Stale reports whether the claims are older than JWTRefreshInterval and have to be
+// read from the database again. Tokens without iat are always stale.
+func (c *Claims) Stale() bool {
+	return c.IssuedAt == nil || jwt.TimeFunc().Sub(c.IssuedAt.Time) >= JWTRefreshInterval
+}
+
+// JWTKeySet holds the signing key and any previous keys that are still accepted.
+// Rotating the secret only requires moving the old one into Keys under its kid.
+type JWTKeySet struct {
+	CurrentKeyID string
+	Keys         map[string][]byte
+}
+
+func NewJWTKeySet(currentKeyID string, currentSecret string, previous map[string]string) (*JWTKeySet, error) {
+	if currentKeyID == "" {
+		currentKeyID = LegacyJWTKeyID
+	}
+	if currentSecret == "" {
+		return nil, fmt.Errorf("JWT signing secret is empty")
+	}
+	keys := map[string][]byte{currentKeyID: []byte(currentSecret)}
+	for kid, secret := range previous {
+		if kid == currentKeyID {
+			return nil, fmt.Errorf("JWT key id %q is used for both the current and a previous key", kid)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("JWT key %q has an empty secret", kid)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return &JWTKeySet{CurrentKeyID: currentKeyID, Keys: keys}, nil
+}
+
+// GenerateJWT issues a session token for a new login.
+func GenerateJWT(identity *Identity, keys *JWTKeySet) (*string, error) {
+	return signJWT(identity, jwt.TimeFunc().Add(jwtLifetime), keys)
+}
+
+// RenewJWT reissues a session token with the identity read from the database. The
+// session still ends when the original token expires.
+func RenewJWT(identity *Identity, claims *Claims, keys *JWTKeySet) (*string, error) {
+	return signJWT(identity, claims.ExpiresAt.Time, keys)
+}
+
+func signJWT(identity *Identity, expiresAt time.Time, keys *JWTKeySet) (*string, error) {
+	claims := Claims{
+		UserID: identity.UserID,
+		Role:   identity.Role,
+		TeamID: identity.TeamID,
+		GameID: identity.GameID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(jwt.TimeFunc()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = keys.CurrentKeyID
+	signedToken, err := token.SignedString(keys.Keys[keys.CurrentKeyID])
+	if err != nil {
+		return nil, err
+	}
+	return &signedToken, nil
+}
+
+// ParseJWT verifies the signature with the key named by the kid header and checks expiry.
+func ParseJWT(tokenString string, keys *JWTKeySet) (*Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "Unexpected signing method")
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = LegacyJWTKeyID
+		}
+		key, ok := keys.Keys[kid]
+		if !ok {
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "Unknown JWT key id")
+		}
+		return key, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid JWT token")
+	}
+	if claims.UserID == "" {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "User ID not found in JWT claims")
+	}
+	// 古いトークンは exp が無くても通ってしまうので明示的に確認する
+	if claims.ExpiresAt == nil {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "JWT token is expired")
+	}
+	return &claims, nil
+}
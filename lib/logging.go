@@ -0,0 +1,206 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// LocalRequestID is the c.Locals key of the request ID. Fiber's c.Context() returns
+// locals from Value, so the logger finds the ID in the context of service calls.
+const LocalRequestID = "request_id"
+
+// LocalClientIP is the c.Locals key of the client's IP address, for the audit log.
+const LocalClientIP = "client_ip"
+
+// Redacted replaces values that must not be logged or recorded.
+const Redacted = "[REDACTED]"
+
+// sensitiveLogKeys are attribute keys whose values are only logged in debug mode:
+// players' positions and contact details, and credentials.
+var sensitiveLogKeys = map[string]bool{
+	"latitude":          true,
+	"longitude":         true,
+	"email":             true,
+	"phone":             true,
+	"emergency_contact": true,
+	"ip":                true,
+	"token":             true,
+	"authorization":     true,
+	"cookie":            true,
+}
+
+type LogConfig struct {
+	Level slog.Level
+	// Format は json または text
+	Format string
+}
+
+// Debug reports whether debug mode is enabled. Debug mode also logs sensitive values.
+func (c LogConfig) Debug() bool {
+	return c.Level <= slog.LevelDebug
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+	}
+	return l, nil
+}
+
+// NewLogger returns a logger writing to w that adds the request ID, user ID and team ID
+// found in the context and, unless in debug mode, redacts sensitive attributes.
+func NewLogger(cfg LogConfig, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{Handler: handler, redact: !cfg.Debug()})
+}
+
+// redactAttr replaces the value of a sensitive attribute, and of sensitive attributes
+// nested in groups (slog.Group and LogValuers). A group with a sensitive key is
+// replaced as a whole.
+func redactAttr(a slog.Attr) slog.Attr {
+	if sensitiveLogKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return a
+	}
+	members := a.Value.Group()
+	redacted := make([]slog.Attr, len(members))
+	for i, member := range members {
+		redacted[i] = redactAttr(member)
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(redacted...)}
+}
+
+// contextHandler adds the attributes of the current request to every record logged
+// with a context (slog.InfoContext and so on). The handlers' ReplaceAttr is not called
+// for groups, so the attributes are redacted here.
+type contextHandler struct {
+	slog.Handler
+	redact bool
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.redact {
+		redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+		r.Attrs(func(a slog.Attr) bool {
+			redacted.AddAttrs(redactAttr(a))
+			return true
+		})
+		r = redacted
+	}
+	if ctx != nil {
+		if id, ok := ctx.Value(LocalRequestID).(string); ok {
+			r.AddAttrs(slog.String("request_id", id))
+		}
+		if identity := IdentityFromContext(ctx); identity != nil {
+			r.AddAttrs(slog.String("user_id", identity.UserID), slog.Int("team_id", identity.TeamID))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if h.redact {
+		redacted := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redacted[i] = redactAttr(a)
+		}
+		attrs = redacted
+	}
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs), redact: h.redact}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name), redact: h.redact}
+}
+
+// slowQueryThreshold は警告として記録するクエリの実行時間
+const slowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger writes GORM's logs (failed and slow queries) through slog. Outside debug
+// mode the SQL is logged with placeholders, so stored coordinates and emails do not
+// appear in the logs.
+type GormLogger struct {
+	Debug  bool
+	silent bool
+}
+
+func NewGormLogger(cfg LogConfig) *GormLogger {
+	return &GormLogger{Debug: cfg.Debug()}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *l
+	copied.silent = level == gormlogger.Silent
+	return &copied
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if !l.silent {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if !l.silent {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if !l.silent {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	level, msg := slog.LevelDebug, "Query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "Query failed"
+	case elapsed > slowQueryThreshold:
+		level, msg = slog.LevelWarn, "Slow query"
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if level == slog.LevelError {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter drops the bound values from logged SQL outside debug mode.
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.Debug {
+		return sql, params
+	}
+	return sql, nil
+}
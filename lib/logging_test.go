@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// player logs itself as a group, as a LogValuer would.
+type player struct {
+	email string
+}
+
+func (p player) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("id", "player"), slog.String("email", p.email))
+}
+
+func TestLoggerRedactsSensitiveValues(t *testing.T) {
+	secrets := []string{"35.681236", "139.767125", "player@example.com", "090-1234-5678", "tgeo_secret", "198.51.100.7", "Bearer abc"}
+	log := func(logger *slog.Logger) {
+		logger.Info("top level", "latitude", 35.681236, "longitude", 139.767125, "Email", "player@example.com")
+		logger.Info("group", slog.Group("user", slog.String("id", "player"), slog.String("phone", "090-1234-5678"),
+			slog.Group("request", slog.String("ip", "198.51.100.7"))))
+		// キー自体が機密ならグループごと伏せる
+		logger.Info("sensitive group", slog.Group("token", slog.String("value", "tgeo_secret")))
+		logger.Info("log valuer", slog.Any("player", player{email: "player@example.com"}))
+		logger.With(slog.Group("headers", slog.String("authorization", "Bearer abc"))).Info("with")
+		logger.WithGroup("geo").With("latitude", 35.681236).Info("with group", "longitude", 139.767125)
+	}
+
+	for _, format := range []string{"json", "text"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			log(NewLogger(LogConfig{Level: slog.LevelInfo, Format: format}, &buf))
+			out := buf.String()
+			for _, secret := range secrets {
+				if strings.Contains(out, secret) {
+					t.Errorf("log contains %q:\n%s", secret, out)
+				}
+			}
+			if n := strings.Count(out, Redacted); n != 10 {
+				t.Errorf("redacted %d values, want 10:\n%s", n, out)
+			}
+			if !strings.Contains(out, "player") {
+				t.Errorf("log lost the other attributes:\n%s", out)
+			}
+		})
+	}
+
+	t.Run("debug", func(t *testing.T) {
+		var buf bytes.Buffer
+		log(NewLogger(LogConfig{Level: slog.LevelDebug, Format: "json"}, &buf))
+		for _, secret := range secrets {
+			if !strings.Contains(buf.String(), secret) {
+				t.Errorf("debug log does not contain %q:\n%s", secret, buf.String())
+			}
+		}
+	})
+}
+
+func TestLoggerAddsRequestAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(LogConfig{Level: slog.LevelInfo, Format: "json"}, &buf)
+	ctx := context.WithValue(context.Background(), LocalRequestID, "req-1")
+	logger.InfoContext(ctx, "request", "token", "tgeo_secret")
+	if out := buf.String(); !strings.Contains(out, `"request_id":"req-1"`) || strings.Contains(out, "tgeo_secret") {
+		t.Errorf("log = %s", out)
+	}
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics exported at /metrics in the Prometheus exposition format.
+var (
+	HTTPRequestDuration = &HistogramVec{prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tenchi_http_request_duration_seconds",
+		Help:    "Time spent handling HTTP requests by route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})}
+	GeolocationSubmissions = newCounterVec("tenchi_geolocation_submissions_total",
+		"Accepted location submissions by team ID and submission window (HH:MM in the game time zone).",
+		"team", "window")
+	GeolocationRejections = newCounterVec("tenchi_geolocation_rejections_total",
+		"Rejected location submissions by error code.",
+		"reason")
+	RateLimited = newCounterVec("tenchi_rate_limited_total",
+		"Requests rejected by the rate limits by route group.",
+		"group")
+	WebhookDeliveries = newCounterVec("tenchi_webhook_deliveries_total",
+		"Webhook deliveries by result (success or failure).",
+		"result")
+	ActiveSessions = &SessionTracker{
+		desc: prometheus.NewDesc("tenchi_active_sessions",
+			"Users who made an authenticated request in the last 5 minutes by authentication method (per instance).",
+			[]string{"method"}, nil),
+		window: 5 * time.Minute,
+		seen:   map[[2]string]time.Time{},
+	}
+)
+
+// metricsRegistry holds the metrics above and the Go runtime and process metrics.
+var metricsRegistry = prometheus.NewRegistry()
+
+func init() {
+	metricsRegistry.MustRegister(
+		HTTPRequestDuration.vec,
+		GeolocationSubmissions.vec,
+		GeolocationRejections.vec,
+		RateLimited.vec,
+		WebhookDeliveries.vec,
+		ActiveSessions,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MetricsHandler serves the registered metrics, negotiating the format with the scraper.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// labelValues copies the label values. Fiber's strings point into buffers that are
+// reused after the request, and the Prometheus client keeps the values it is given.
+func labelValues(values []string) []string {
+	copied := make([]string, len(values))
+	for i, value := range values {
+		copied[i] = strings.Clone(value)
+	}
+	return copied
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+func newCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)}
+}
+
+// Inc adds one to the series with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.vec.WithLabelValues(labelValues(values)...).Inc()
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	vec *prometheus.HistogramVec
+}
+
+// Observe records one value, e.g. a duration in seconds.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.vec.WithLabelValues(labelValues(values)...).Observe(value)
+}
+
+// SessionTracker counts the distinct users seen within a time window. Sessions are
+// stateless JWTs, so this is the closest measure of how many players are online.
+type SessionTracker struct {
+	desc   *prometheus.Desc
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[[2]string]time.Time // (method, user ID) -> 最後のリクエスト
+}
+
+// Seen records an authenticated request of userID.
+func (t *SessionTracker) Seen(method, userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seen[[2]string{strings.Clone(method), strings.Clone(userID)}] = time.Now()
+}
+
+func (t *SessionTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.desc
+}
+
+// Collect reports the number of users per method and forgets the users that have not
+// been seen within the window.
+func (t *SessionTracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := map[string]int{}
+	cutoff := time.Now().Add(-t.window)
+	for key, last := range t.seen {
+		if last.Before(cutoff) {
+			delete(t.seen, key)
+			continue
+		}
+		counts[key[0]]++
+	}
+	for method, count := range counts {
+		ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, float64(count), method)
+	}
+}
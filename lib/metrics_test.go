@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// resetMetrics clears every series so the output does not depend on other tests.
+func resetMetrics() {
+	for _, c := range []*CounterVec{GeolocationSubmissions, GeolocationRejections, RateLimited, WebhookDeliveries} {
+		c.vec.Reset()
+	}
+	HTTPRequestDuration.vec.Reset()
+	ActiveSessions.mu.Lock()
+	ActiveSessions.seen = map[[2]string]time.Time{}
+	ActiveSessions.mu.Unlock()
+}
+
+// writeMetrics writes the metrics of this package in the text format, without the Go
+// runtime and process metrics, which change from run to run.
+func writeMetrics(t *testing.T, w io.Writer) {
+	t.Helper()
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "tenchi_") {
+			continue
+		}
+		if err := encoder.Encode(family); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMetricsGolden(t *testing.T) {
+	resetMetrics()
+	t.Cleanup(resetMetrics)
+
+	for _, d := range []float64{0.003, 0.04, 0.04, 0.7, 12} {
+		HTTPRequestDuration.Observe(d, "GET", "/api/v1/geo", "200")
+	}
+	HTTPRequestDuration.Observe(0.01, "POST", "/api/v1/geo", "429")
+	GeolocationSubmissions.Inc("1", "13:05")
+	GeolocationSubmissions.Inc("1", "13:05")
+	GeolocationSubmissions.Inc("2", "13:10")
+	GeolocationRejections.Inc("OUT_OF_WINDOW")
+	// ラベル値のエスケープ
+	RateLimited.Inc("quote\" backslash\\ newline\n")
+	RateLimited.Inc("geo")
+	// WebhookDeliveries は系列がないので出力されない
+	ActiveSessions.Seen("session", "a")
+	ActiveSessions.Seen("session", "b")
+	ActiveSessions.Seen("session", "a")
+	ActiveSessions.Seen("api_token", "runner")
+	ActiveSessions.seen[[2]string{"session", "gone"}] = time.Now().Add(-10 * time.Minute)
+
+	var buf bytes.Buffer
+	writeMetrics(t, &buf)
+
+	golden := filepath.Join("testdata", "metrics.golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test ./lib -run TestMetricsGolden -update to create it)", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("metrics output differs from %s:\n%s", golden, buf.String())
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	resetMetrics()
+	t.Cleanup(resetMetrics)
+	RateLimited.Inc("geo")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("GET /metrics = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{`tenchi_rate_limited_total{group="geo"} 1`, "# TYPE go_goroutines gauge"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET /metrics does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxUserNameLength         = 32
+	MaxEmergencyContactLength = 100
+	MaxAvatarSize             = 2 * 1024 * 1024
+	MaxTeamNameLength         = 32
+	MaxTeamIconLength         = 8
+	MaxTeamMottoLength        = 100
+)
+
+var teamColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// NormalizeUserName trims surrounding spaces and checks length and characters.
+func NormalizeUserName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("user name must not be empty")
+	}
+	if utf8.RuneCountInString(name) > MaxUserNameLength {
+		return "", fmt.Errorf("user name must be at most %d characters", MaxUserNameLength)
+	}
+	if err := checkPrintable(name); err != nil {
+		return "", fmt.Errorf("user name %w", err)
+	}
+	return name, nil
+}
+
+// NormalizePhone accepts digits with optional "+", "-", spaces and parentheses.
+// An empty string clears the phone number.
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	if phone == "" {
+		return "", nil
+	}
+	digits := 0
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == '-' || r == ' ' || r == '(' || r == ')':
+		default:
+			return "", fmt.Errorf("phone number contains an invalid character: %q", r)
+		}
+	}
+	if digits < 10 || digits > 15 {
+		return "", fmt.Errorf("phone number must have 10 to 15 digits")
+	}
+	return phone, nil
+}
+
+func NormalizeEmergencyContact(contact string) (string, error) {
+	contact = strings.TrimSpace(contact)
+	if utf8.RuneCountInString(contact) > MaxEmergencyContactLength {
+		return "", fmt.Errorf("emergency contact must be at most %d characters", MaxEmergencyContactLength)
+	}
+	if err := checkPrintable(contact); err != nil {
+		return "", fmt.Errorf("emergency contact %w", err)
+	}
+	return contact, nil
+}
+
+// checkPrintable rejects control and invisible formatting characters.
+func checkPrintable(s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("is not valid UTF-8")
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return fmt.Errorf("contains an invalid character: %U", r)
+		}
+	}
+	return nil
+}
+
+func NormalizeTeamName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("team name must not be empty")
+	}
+	if utf8.RuneCountInString(name) > MaxTeamNameLength {
+		return "", fmt.Errorf("team name must be at most %d characters", MaxTeamNameLength)
+	}
+	if err := checkPrintable(name); err != nil {
+		return "", fmt.Errorf("team name %w", err)
+	}
+	return name, nil
+}
+
+// NormalizeTeamColor accepts "#RRGGBB" and returns it in lower case.
+// An empty string resets the color to the default.
+func NormalizeTeamColor(color string) (string, error) {
+	color = strings.TrimSpace(color)
+	if color == "" {
+		return "", nil
+	}
+	if !teamColorPattern.MatchString(color) {
+		return "", fmt.Errorf("color must be in #RRGGBB format")
+	}
+	return strings.ToLower(color), nil
+}
+
+// NormalizeTeamIcon accepts a single emoji, including ZWJ sequences, skin tone
+// modifiers and flags. An empty string removes the icon.
+func NormalizeTeamIcon(icon string) (string, error) {
+	icon = strings.TrimSpace(icon)
+	if icon == "" {
+		return "", nil
+	}
+	if utf8.RuneCountInString(icon) > MaxTeamIconLength {
+		return "", fmt.Errorf("icon must be a single emoji")
+	}
+	for _, r := range icon {
+		switch {
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Sk, r), unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r):
+		case r == '\u200d': // ZWJ
+		default:
+			return "", fmt.Errorf("icon must be a single emoji")
+		}
+	}
+	return icon, nil
+}
+
+func NormalizeTeamMotto(motto string) (string, error) {
+	motto = strings.TrimSpace(motto)
+	if utf8.RuneCountInString(motto) > MaxTeamMottoLength {
+		return "", fmt.Errorf("motto must be at most %d characters", MaxTeamMottoLength)
+	}
+	if err := checkPrintable(motto); err != nil {
+		return "", fmt.Errorf("motto %w", err)
+	}
+	return motto, nil
+}
@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TrustedProxies are the reverse proxies whose X-Forwarded-For and X-Forwarded-Proto
+// headers are believed. Requests from any other address are taken at face value.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses IP addresses and CIDR ranges such as 10.0.0.0/8.
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, value := range values {
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", value)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// Strings returns the proxies as CIDR ranges, as Fiber's TrustedProxies takes them.
+func (p TrustedProxies) Strings() []string {
+	values := make([]string, len(p))
+	for i, network := range p {
+		values[i] = network.String()
+	}
+	return values
+}
+
+// Contains reports whether ip is a trusted proxy.
+func (p TrustedProxies) Contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent a request received from peer.
+// When the peer is a trusted proxy, X-Forwarded-For is read from the right and the
+// first address that is not a trusted proxy is the client; the addresses to its left
+// were sent by the client and may be forged.
+func (p TrustedProxies) ClientIP(peer string, forwardedFor string) string {
+	if !p.Contains(peer) || forwardedFor == "" {
+		return peer
+	}
+	hops := strings.Split(forwardedFor, ",")
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		client = hop
+		if !p.Contains(hop) {
+			break
+		}
+	}
+	return client
+}
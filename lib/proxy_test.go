@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(proxies.Strings(), ","); got != "10.0.0.0/8,192.0.2.1/32,2001:db8::1/128,fd00::/8" {
+		t.Errorf("Strings() = %q", got)
+	}
+	for _, value := range []string{"proxy.example.com", "10.0.0.0/33", ""} {
+		if _, err := ParseTrustedProxies([]string{value}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) did not fail", value)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		peer         string
+		forwardedFor string
+		want         string
+	}{
+		{"direct client", "203.0.113.5", "", "203.0.113.5"},
+		// 信用しない接続元の X-Forwarded-For は無視する
+		{"untrusted peer", "203.0.113.5", "198.51.100.7", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1", "198.51.100.7", "198.51.100.7"},
+		{"trusted proxy without the header", "10.0.0.1", "", "10.0.0.1"},
+		{"chain of trusted proxies", "10.0.0.1", "198.51.100.7, 10.0.0.2, 10.0.0.3", "198.51.100.7"},
+		// 左端はクライアントが送ったもので、偽装できる
+		{"spoofed left-most hop", "10.0.0.1", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"spoofed trusted address", "10.0.0.1", "10.9.9.9, 198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"garbage hop", "10.0.0.1", "198.51.100.7, not-an-ip", "10.0.0.1"},
+		{"garbage left of the client", "10.0.0.1", "<script>, 198.51.100.7", "198.51.100.7"},
+		{"only trusted proxies", "10.0.0.1", "10.0.0.2, 10.0.0.3", "10.0.0.2"},
+		{"IPv6", "2001:db8::1", "2001:db8::2, 2400:4050::1", "2400:4050::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxies.ClientIP(tt.peer, tt.forwardedFor); got != tt.want {
+				t.Errorf("ClientIP(%q, %q) = %q, want %q", tt.peer, tt.forwardedFor, got, tt.want)
+			}
+		})
+	}
+
+	var none TrustedProxies
+	if got := none.ClientIP("10.0.0.1", "198.51.100.7"); got != "10.0.0.1" {
+		t.Errorf("ClientIP() without trusted proxies = %q, want the peer", got)
+	}
+}
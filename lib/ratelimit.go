@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateCounter counts hits in fixed windows. MemoryCache keeps the counters in the
+// process; RedisCache shares them between replicas.
+type RateCounter interface {
+	// Hit increments the counter at key, opening a window of the given length if none
+	// is open, and returns the count and the time until the window closes.
+	Hit(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
+// RateLimit allows Requests requests per Window. The zero value allows everything.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (r RateLimit) Enabled() bool {
+	return r.Requests > 0 && r.Window > 0
+}
+
+func (r RateLimit) String() string {
+	if !r.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", r.Requests, r.Window)
+}
+
+// ParseRateLimit parses "<requests>/<window>", e.g. "10/1m". "" and "off" disable the limit.
+func ParseRateLimit(value string) (RateLimit, error) {
+	if value == "" || value == "off" {
+		return RateLimit{}, nil
+	}
+	requests, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("expected <requests>/<window>, e.g. 10/1m")
+	}
+	var r RateLimit
+	var err error
+	if r.Requests, err = strconv.Atoi(requests); err != nil || r.Requests <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid number of requests %q", requests)
+	}
+	if r.Window, err = time.ParseDuration(window); err != nil || r.Window <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid window %q", window)
+	}
+	return r, nil
+}
+
+// RateLimitConfig holds the limits of each route group. Login is counted per IP
+// address, the others per user; IP applies to every API request.
+type RateLimitConfig struct {
+	Backend string // "memory" or "redis"
+	IP      RateLimit
+	User    RateLimit
+	Login   RateLimit
+	Geo     RateLimit
+	Profile RateLimit
+}
+
+const rateLimitKeyPrefix = "tenchi-geolocation:ratelimit:"
+
+// RateLimiter checks requests against the limits.
+type RateLimiter struct {
+	counter RateCounter
+}
+
+// NewRateLimiter uses Redis at redisURL for the "redis" backend and the memory otherwise.
+func NewRateLimiter(cfg RateLimitConfig, redisURL string) (*RateLimiter, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return &RateLimiter{counter: NewMemoryCache()}, nil
+	case "redis":
+		redis, err := NewRedisCache(redisURL)
+		if err != nil {
+			return nil, err
+		}
+		return &RateLimiter{counter: redis}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend: %q", cfg.Backend)
+	}
+}
+
+// Allow counts a request of subject (a user ID or IP address) in group. When the limit
+// is exceeded it returns false and how long to wait. If the counter cannot be reached
+// the request is allowed, so a Redis outage does not stop the game.
+func (l *RateLimiter) Allow(ctx context.Context, group string, subject string, limit RateLimit) (bool, time.Duration, error) {
+	if !limit.Enabled() {
+		return true, 0, nil
+	}
+	count, remaining, err := l.counter.Hit(ctx, rateLimitKeyPrefix+group+":"+subject, limit.Window)
+	if err != nil {
+		return true, 0, err
+	}
+	if count > int64(limit.Requests) {
+		return false, remaining, nil
+	}
+	return true, 0, nil
+}
+
+func (c *MemoryCache) Hit(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	// 期限切れのカウンタを溜めないよう、一定間隔で掃除する
+	c.sweep(now)
+	entry, ok := c.entries[key]
+	if !ok || c.expired(entry, now) {
+		entry = memoryEntry{value: []byte("0"), expiresAt: now.Add(window)}
+	}
+	n, err := strconv.ParseInt(string(entry.value), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("value of %q is not an integer", key)
+	}
+	n++
+	entry.value = []byte(strconv.FormatInt(n, 10))
+	c.entries[key] = entry
+	return n, entry.expiresAt.Sub(now), nil
+}
+
+// redisHitScript increments the counter and opens the window in one step, so a key
+// never stays without an expiry if the connection fails in between.
+var redisHitScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	ttl = tonumber(ARGV[1])
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return {count, ttl}`)
+
+func (c *RedisCache) Hit(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	reply, err := redisHitScript.Run(ctx, c.client, []string{key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(reply) != 2 {
+		return 0, 0, fmt.Errorf("redis: unexpected reply to the rate limit script: %v", reply)
+	}
+	return reply[0], time.Duration(reply[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RateLimit
+		wantErr bool
+	}{
+		{"", RateLimit{}, false},
+		{"off", RateLimit{}, false},
+		{"10/1m", RateLimit{Requests: 10, Window: time.Minute}, false},
+		{"1/500ms", RateLimit{Requests: 1, Window: 500 * time.Millisecond}, false},
+		{"10", RateLimit{}, true},
+		{"0/1m", RateLimit{}, true},
+		{"-1/1m", RateLimit{}, true},
+		{"x/1m", RateLimit{}, true},
+		{"10/0s", RateLimit{}, true},
+		{"10/minute", RateLimit{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRateLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRateLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimitConfig{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	limit := RateLimit{Requests: 2, Window: 50 * time.Millisecond}
+
+	for i := 1; i <= 2; i++ {
+		if ok, _, err := limiter.Allow(ctx, "geo", "user:a", limit); !ok || err != nil {
+			t.Fatalf("request %d = %v, %v, want allowed", i, ok, err)
+		}
+	}
+	ok, retryAfter, err := limiter.Allow(ctx, "geo", "user:a", limit)
+	if ok || err != nil {
+		t.Fatalf("request 3 = %v, %v, want limited", ok, err)
+	}
+	if retryAfter <= 0 || retryAfter > limit.Window {
+		t.Errorf("retry after %s, want within the window", retryAfter)
+	}
+
+	// 別の利用者や別のグループは数えない
+	if ok, _, _ := limiter.Allow(ctx, "geo", "user:b", limit); !ok {
+		t.Error("another subject was limited")
+	}
+	if ok, _, _ := limiter.Allow(ctx, "login", "user:a", limit); !ok {
+		t.Error("another group was limited")
+	}
+
+	time.Sleep(limit.Window)
+	if ok, _, _ := limiter.Allow(ctx, "geo", "user:a", limit); !ok {
+		t.Error("still limited after the window closed")
+	}
+
+	// 無効な制限はカウンタを使わない
+	for i := 0; i < 5; i++ {
+		if ok, _, _ := limiter.Allow(ctx, "geo", "user:a", RateLimit{}); !ok {
+			t.Fatal("the zero RateLimit limited a request")
+		}
+	}
+}
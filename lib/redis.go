@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds each command when the URL does not set dial_timeout,
+// read_timeout or write_timeout, so that a stuck server does not hold up requests.
+const redisTimeout = 2 * time.Second
+
+// RedisCache stores values in Redis or a server speaking the same protocol (Valkey,
+// KeyDB, ...).
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache parses redis://[user:password@]host[:port][/db]; rediss:// uses TLS.
+// Options such as ?dial_timeout=5s are passed to the client.
+func NewRedisCache(rawURL string) (*RedisCache, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis_url: %w", err)
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = redisTimeout
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = redisTimeout
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = redisTimeout
+	}
+	// Redis が落ちているときにリクエストを待たせないよう、再試行は 1 回までにする
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 1
+	}
+	if opts.DialerRetries == 0 {
+		opts.DialerRetries = 1
+	}
+	// CLIENT SETINFO を知らない互換サーバもあるので送らない
+	opts.DisableIdentity = true
+	return &RedisCache{client: redis.NewClient(opts)}, nil
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCacheMiss
+	}
+	return value, err
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.client.Incr(ctx, key).Result()
+}
+
+// Ping checks that the server is reachable and the credentials are accepted.
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the connections.
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
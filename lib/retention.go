@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// RetentionApplier is the part of the retention repository the job needs.
+type RetentionApplier interface {
+	ApplyRetention(now time.Time) ([]structs.RetentionRun, error)
+}
+
+// RunRetentionJob applies the per-game retention policy every interval until ctx is done.
+// onChange is called after a pass that changed any locations. A pass that has started is
+// finished before returning.
+func RunRetentionJob(ctx context.Context, retention RetentionApplier, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if runRetention(retention) && onChange != nil {
+			onChange()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runRetention(retention RetentionApplier) bool {
+	runs, err := retention.ApplyRetention(time.Now())
+	changed := false
+	for _, run := range runs {
+		changed = changed || run.Affected > 0
+		slog.Info("Retention policy applied", "mode", run.Mode, "affected", run.Affected,
+			"game_id", run.GameID, "recorded_before", run.RecordedBefore.Format(time.RFC3339))
+	}
+	if err != nil {
+		slog.Error("Failed to apply retention policy", "error", err)
+	}
+	return changed
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3AvatarStore stores avatars in an S3-compatible bucket (AWS S3, MinIO, ...).
+// Requests use path-style URLs.
+type S3AvatarStore struct {
+	client *minio.Client
+	bucket string
+}
+
+const s3KeyPrefix = "avatars/"
+
+// NewS3AvatarStore connects to the bucket at cfg.S3Endpoint, e.g. https://s3.amazonaws.com
+// or http://minio:9000. The bucket must already exist.
+func NewS3AvatarStore(cfg AvatarConfig) (*S3AvatarStore, error) {
+	endpoint, err := url.Parse(cfg.S3Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" || strings.Trim(endpoint.Path, "/") != "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q (expected a URL like https://s3.amazonaws.com)", cfg.S3Endpoint)
+	}
+	region := cfg.S3Region
+	if region == "" {
+		// 指定がなければバケットの場所を問い合わせずに既定のリージョンで署名する
+		region = "us-east-1"
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       region,
+		BucketLookup: minio.BucketLookupPath,
+		// 既定の 10 回では障害時にログインやプロフィールの更新が長く待たされる
+		MaxRetries: 3,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 configuration: %w", err)
+	}
+	return &S3AvatarStore{client: client, bucket: cfg.S3Bucket}, nil
+}
+
+func (s *S3AvatarStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !ValidAvatarKey(key) {
+		return fmt.Errorf("invalid avatar key: %q", key)
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, s3KeyPrefix+key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("s3 put failed: %w", err)
+	}
+	return nil
+}
+
+func (s *S3AvatarStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	if !ValidAvatarKey(key) {
+		return nil, "", ErrAvatarNotFound
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, s3KeyPrefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("s3 get failed: %w", err)
+	}
+	defer object.Close()
+	// GetObject は最初の読み込みまでリクエストを送らないので、存在の確認は Stat で行う
+	info, err := object.Stat()
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+			return nil, "", ErrAvatarNotFound
+		}
+		return nil, "", fmt.Errorf("s3 get failed: %w", err)
+	}
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, "", fmt.Errorf("s3 get failed: %w", err)
+	}
+	return data, info.ContentType, nil
+}
+
+func (s *S3AvatarStore) Delete(ctx context.Context, key string) error {
+	if !ValidAvatarKey(key) {
+		return nil
+	}
+	// S3 は存在しないキーの削除も成功として扱う
+	if err := s.client.RemoveObject(ctx, s.bucket, s3KeyPrefix+key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("s3 delete failed: %w", err)
+	}
+	return nil
+}
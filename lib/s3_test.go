@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testS3Bucket = "tenchi-avatars"
+
+type s3Object struct {
+	data        []byte
+	contentType string
+}
+
+// fakeS3 serves PUT, HEAD, GET and DELETE of objects from a map. It does not check
+// signatures, only that requests are signed with the expected credentials.
+type fakeS3 struct {
+	t        *testing.T
+	mu       sync.Mutex
+	objects  map[string]s3Object
+	requests []string
+	// denied はこの状態のとき 403 を返す
+	denied bool
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3AvatarStore) {
+	t.Helper()
+	f := &fakeS3{t: t, objects: map[string]s3Object{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	store, err := NewS3AvatarStore(AvatarConfig{
+		S3Endpoint:  server.URL,
+		S3Bucket:    testS3Bucket,
+		S3Region:    "ap-northeast-1",
+		S3AccessKey: "access-key",
+		S3SecretKey: "secret-key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, store
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access-key/") ||
+		!strings.Contains(r.Header.Get("Authorization"), "/ap-northeast-1/s3/aws4_request") {
+		f.t.Errorf("%s %s: Authorization = %q", r.Method, r.URL, r.Header.Get("Authorization"))
+	}
+	if f.denied {
+		s3ErrorResponse(w, r, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testS3Bucket+"/")
+	if !ok {
+		s3ErrorResponse(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readS3Payload(r)
+		if err != nil {
+			f.t.Errorf("PUT %s: %v", r.URL, err)
+			s3ErrorResponse(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = s3Object{data: data, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead, http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			s3ErrorResponse(w, r, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3ErrorResponse(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func s3ErrorResponse(w http.ResponseWriter, r *http.Request, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+	}
+}
+
+// readS3Payload reads the body of a PUT, decoding the aws-chunked encoding that
+// signed uploads over plain HTTP use.
+func readS3Payload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data bytes.Buffer
+	body := bufio.NewReader(r.Body)
+	for {
+		header, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk header %q", header)
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, body, size); err != nil {
+			return nil, err
+		}
+		if _, err := body.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+	if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != strconv.Itoa(data.Len()) {
+		return nil, fmt.Errorf("decoded %d bytes, header says %s", data.Len(), decoded)
+	}
+	return data.Bytes(), nil
+}
+
+func TestNewS3AvatarStore(t *testing.T) {
+	for _, endpoint := range []string{"", "s3.amazonaws.com", "ftp://s3.example.com", "https://s3.example.com/prefix"} {
+		if _, err := NewS3AvatarStore(AvatarConfig{S3Endpoint: endpoint, S3Bucket: testS3Bucket}); err == nil {
+			t.Errorf("NewS3AvatarStore(%q) did not fail", endpoint)
+		}
+	}
+	for _, endpoint := range []string{"https://s3.amazonaws.com", "http://minio:9000/"} {
+		if _, err := NewS3AvatarStore(AvatarConfig{S3Endpoint: endpoint, S3Bucket: testS3Bucket}); err != nil {
+			t.Errorf("NewS3AvatarStore(%q) error = %v", endpoint, err)
+		}
+	}
+}
+
+func TestS3AvatarStoreRoundTrip(t *testing.T) {
+	server, store := newFakeS3(t)
+	ctx := context.Background()
+	data := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0, 1, 2}, 1000)...)
+
+	if err := store.Put(ctx, "player", data, "image/png"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if _, ok := server.objects["avatars/player"]; !ok {
+		t.Fatalf("objects = %v, want avatars/player", server.objects)
+	}
+	got, contentType, err := store.Get(ctx, "player")
+	if err != nil || !bytes.Equal(got, data) || contentType != "image/png" {
+		t.Fatalf("Get() = %d bytes, %q, %v", len(got), contentType, err)
+	}
+
+	if err := store.Delete(ctx, "player"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, _, err := store.Get(ctx, "player"); !errors.Is(err, ErrAvatarNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrAvatarNotFound", err)
+	}
+	// 存在しないキーの削除は成功する
+	if err := store.Delete(ctx, "player"); err != nil {
+		t.Errorf("Delete() of a missing avatar error = %v", err)
+	}
+}
+
+func TestS3AvatarStoreInvalidKey(t *testing.T) {
+	server, store := newFakeS3(t)
+	ctx := context.Background()
+	const key = "../users/admin"
+
+	if err := store.Put(ctx, key, []byte("x"), "image/png"); err == nil {
+		t.Error("Put() with an invalid key did not fail")
+	}
+	if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrAvatarNotFound) {
+		t.Errorf("Get() error = %v, want ErrAvatarNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if len(server.requests) != 0 {
+		t.Errorf("sent %q for an invalid key", server.requests)
+	}
+}
+
+func TestS3AvatarStoreErrors(t *testing.T) {
+	server, store := newFakeS3(t)
+	ctx := context.Background()
+	if err := store.Put(ctx, "player", []byte("x"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	server.mu.Lock()
+	server.denied = true
+	server.mu.Unlock()
+
+	if err := store.Put(ctx, "player", []byte("x"), "image/png"); err == nil || !strings.Contains(err.Error(), "s3 put failed") {
+		t.Errorf("Put() error = %v", err)
+	}
+	// 拒否は見つからないのとは区別する
+	if _, _, err := store.Get(ctx, "player"); err == nil || errors.Is(err, ErrAvatarNotFound) {
+		t.Errorf("Get() error = %v, want a failure other than ErrAvatarNotFound", err)
+	}
+	if err := store.Delete(ctx, "player"); err == nil || !strings.Contains(err.Error(), "s3 delete failed") {
+		t.Errorf("Delete() error = %v", err)
+	}
+}
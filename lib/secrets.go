@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 暗号化した設定ファイル（secrets ファイル）の形式:
+//
+//	tenchi-secrets:v1:<base64(nonce || AES-256-GCM で暗号化した INI)>
+//
+// 中身は設定ファイルと同じセクションとキーを持つ INI。鍵は環境変数 TENCHI_SECRETS_KEY
+// （base64 の 32 バイト、または file: 参照）で渡し、リポジトリには置かない。
+const sealedSecretsPrefix = "tenchi-secrets:v1:"
+
+// SecretsKeyEnv holds the key of the secrets file.
+const SecretsKeyEnv = "TENCHI_SECRETS_KEY"
+
+const fileRefPrefix = "file:"
+
+var ErrSecretsKeyMissing = errors.New(SecretsKeyEnv + " is not set")
+
+// ResolveFileRef returns the content of the file for a "file:<path>" value (Docker or
+// Kubernetes secrets) without the trailing newline, and other values unchanged.
+func ResolveFileRef(value string) (string, error) {
+	path, ok := strings.CutPrefix(value, fileRefPrefix)
+	if !ok {
+		return value, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// GenerateSecretsKey returns a new random key for the secrets file.
+func GenerateSecretsKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// SecretsKeyFromEnv reads the key from TENCHI_SECRETS_KEY, following a file: reference.
+func SecretsKeyFromEnv() ([]byte, error) {
+	value := os.Getenv(SecretsKeyEnv)
+	if value == "" {
+		return nil, ErrSecretsKeyMissing
+	}
+	value, err := ResolveFileRef(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", SecretsKeyEnv, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s must be 32 bytes encoded in base64", SecretsKeyEnv)
+	}
+	return key, nil
+}
+
+func secretsAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealSecrets encrypts a plaintext INI file.
+func SealSecrets(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := secretsAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(sealedSecretsPrefix))
+	return []byte(sealedSecretsPrefix + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// OpenSecrets decrypts a file written by SealSecrets.
+func OpenSecrets(key []byte, data []byte) ([]byte, error) {
+	encoded, ok := bytes.CutPrefix(bytes.TrimSpace(data), []byte(sealedSecretsPrefix))
+	if !ok {
+		return nil, fmt.Errorf("not a secrets file (expected %q)", sealedSecretsPrefix)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("secrets file is corrupted: %w", err)
+	}
+	aead, err := secretsAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("secrets file is corrupted")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(sealedSecretsPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets file (wrong key?)")
+	}
+	return plaintext, nil
+}
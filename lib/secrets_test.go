@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func newSecretsKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := GenerateSecretsKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		t.Fatalf("GenerateSecretsKey() = %q, want 32 bytes in base64", encoded)
+	}
+	return key
+}
+
+func TestSealAndOpenSecrets(t *testing.T) {
+	key := newSecretsKey(t)
+	plaintext := []byte("[Google]\nClientSecret = google-secret\n")
+
+	sealed, err := SealSecrets(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, []byte(sealedSecretsPrefix)) || bytes.Contains(sealed, []byte("google-secret")) {
+		t.Fatalf("SealSecrets() = %q", sealed)
+	}
+	got, err := OpenSecrets(key, sealed)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("OpenSecrets() = %q, %v, want %q", got, err, plaintext)
+	}
+
+	// 同じ内容でも nonce が違うので暗号文は毎回変わる
+	again, err := SealSecrets(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("SealSecrets() returned the same output twice")
+	}
+
+	encoded := strings.TrimSpace(strings.TrimPrefix(string(sealed), sealedSecretsPrefix))
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)-1] ^= 1
+	tampered := sealedSecretsPrefix + base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name    string
+		key     []byte
+		data    string
+		wantErr string
+	}{
+		{"wrong key", newSecretsKey(t), string(sealed), "wrong key"},
+		{"tampered", key, tampered, "wrong key"},
+		{"plain INI", key, string(plaintext), "not a secrets file"},
+		{"not base64", key, sealedSecretsPrefix + "!!!", "corrupted"},
+		{"too short", key, sealedSecretsPrefix + base64.StdEncoding.EncodeToString([]byte("short")), "corrupted"},
+		{"short key", key[:16], string(sealed), "wrong key"},
+		{"invalid key size", key[:7], string(sealed), "invalid key size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OpenSecrets(tt.key, []byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("OpenSecrets() = %q, %v, want an error containing %q", got, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSecretsKeyFromEnv(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(newSecretsKey(t))
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"base64", key, ""},
+		{"file reference", "file:" + writeFile(t, "key", key+"\n"), ""},
+		{"unset", "", SecretsKeyEnv + " is not set"},
+		{"missing file", "file:" + t.TempDir() + "/missing", "no such file"},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("short")), "32 bytes"},
+		{"not base64", "not base64", "32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(SecretsKeyEnv, tt.value)
+			got, err := SecretsKeyFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SecretsKeyFromEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || base64.StdEncoding.EncodeToString(got) != key {
+				t.Errorf("SecretsKeyFromEnv() = %x, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestResolveFileRef(t *testing.T) {
+	path := writeFile(t, "secret", "s3cr=t\r\n")
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"file:" + path, "s3cr=t", false},
+		{"plain value", "plain value", false},
+		{"", "", false},
+		// 途中に file: があっても参照ではない
+		{"x-file:" + path, "x-file:" + path, false},
+		{"file:" + path + ".missing", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveFileRef(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveFileRef(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFileRefs(t *testing.T) {
+	jwtSecret := writeFile(t, "jwt", "current-secret\n")
+	oldSecret := writeFile(t, "old", "old-secret\n")
+	olderSecret := writeFile(t, "older", "older-secret")
+
+	cfg := loadConfig(t, "[JWTKeys]\nold = file:"+oldSecret+"\nolder = file:"+olderSecret+"\nplain = plain-secret\n",
+		map[string]string{"TENCHI_JWT_SECRET": "file:" + jwtSecret},
+		"-jwt-key-id", "current")
+
+	if cfg.JWT.Secret != "current-secret" {
+		t.Errorf("JWT.Secret = %q", cfg.JWT.Secret)
+	}
+	want := map[string]string{"old": "old-secret", "older": "older-secret", "plain": "plain-secret"}
+	if len(cfg.JWT.PreviousKeys) != len(want) {
+		t.Errorf("PreviousKeys = %v, want %v", cfg.JWT.PreviousKeys, want)
+	}
+	for kid, secret := range want {
+		if cfg.JWT.PreviousKeys[kid] != secret {
+			t.Errorf("PreviousKeys[%q] = %q, want %q", kid, cfg.JWT.PreviousKeys[kid], secret)
+		}
+	}
+	if _, err := cfg.JWTKeySet(); err != nil {
+		t.Errorf("JWTKeySet() error = %v", err)
+	}
+
+	// config check には参照先を出し、値は伏せる
+	if s := settingSource(cfg, "jwt-secret"); s.Ref != "file:"+jwtSecret || s.Value != "********" || s.Source != "env" {
+		t.Errorf("jwt-secret = %+v", s)
+	}
+	if s := settingSource(cfg, jwtPreviousKeys); s.Ref != "file" || strings.Contains(s.Value, "secret") {
+		t.Errorf("%s = %+v", jwtPreviousKeys, s)
+	}
+
+	t.Run("missing files", func(t *testing.T) {
+		missing := t.TempDir() + "/missing"
+		cfg := loadConfig(t, "[JWTKeys]\nold = file:"+missing+"\n", map[string]string{"TENCHI_JWT_SECRET": "file:" + missing})
+		var problems []string
+		for _, p := range cfg.problems {
+			if strings.Contains(p, missing) {
+				problems = append(problems, p)
+			}
+		}
+		if len(problems) != 2 {
+			t.Fatalf("problems = %q, want one for jwt-secret and one for %s", cfg.problems, jwtPreviousKeys)
+		}
+		for _, name := range []string{"jwt-secret", jwtPreviousKeys} {
+			if !cfg.invalid[name] {
+				t.Errorf("%s is not marked invalid", name)
+			}
+		}
+		if cfg.JWT.Secret != "" {
+			t.Errorf("JWT.Secret = %q, want empty", cfg.JWT.Secret)
+		}
+	})
+}
+
+func TestLoadConfigSecretsFile(t *testing.T) {
+	key := newSecretsKey(t)
+	sealed, err := SealSecrets(key, []byte("[Google]\nClientSecret = from-secrets\n[Server]\nJWTTokenSecret = jwt-from-secrets\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := writeFile(t, "secrets.enc", string(sealed))
+
+	// secrets ファイルは設定ファイルより優先し、環境変数とフラグより弱い
+	cfg := loadConfig(t, "[Google]\nClientSecret = from-file\nClientID = client\n",
+		map[string]string{SecretsKeyEnv: base64.StdEncoding.EncodeToString(key), "TENCHI_JWT_SECRET": "jwt-from-env"},
+		"-secrets", secrets)
+	if cfg.Google.ClientSecret != "from-secrets" || settingSource(cfg, "google-client-secret").Source != "secrets" {
+		t.Errorf("ClientSecret = %q, want the secrets file's", cfg.Google.ClientSecret)
+	}
+	if cfg.Google.ClientID != "client" {
+		t.Errorf("ClientID = %q, want the configuration file's", cfg.Google.ClientID)
+	}
+	if cfg.JWT.Secret != "jwt-from-env" {
+		t.Errorf("JWT.Secret = %q, want the environment's", cfg.JWT.Secret)
+	}
+	if cfg.SecretsFile != secrets {
+		t.Errorf("SecretsFile = %q", cfg.SecretsFile)
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		cfg := loadConfig(t, "", map[string]string{SecretsKeyEnv: base64.StdEncoding.EncodeToString(newSecretsKey(t))}, "-secrets", secrets)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "secrets: failed to decrypt") {
+			t.Errorf("Validate() = %v, want the decryption error", err)
+		}
+		if cfg.Google.ClientSecret != "" {
+			t.Errorf("ClientSecret = %q, want nothing from the secrets file", cfg.Google.ClientSecret)
+		}
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		cfg := loadConfig(t, "", map[string]string{"TENCHI_SECRETS": secrets})
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), ErrSecretsKeyMissing.Error()) {
+			t.Errorf("Validate() = %v, want %v", err, ErrSecretsKeyMissing)
+		}
+	})
+}
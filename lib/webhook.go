@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/m-tsuru/tenchi-geolocation/structs"
 	"gorm.io/gorm"
@@ -15,29 +17,86 @@ type Database struct {
 	*gorm.DB
 }
 
+type WebhookConfig struct {
+	URL string
+	// AvatarURL は Discord に表示するアイコン。空ならウェブフック側の設定が使われる
+	AvatarURL string
+}
+
 type DiscordWebhookContent struct {
-	Username  string `json:"username"`
-	AvatarURL string `json:"avatar_url"`
-	Content   string `json:"content"`
+	Username  string         `json:"username"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Content   string         `json:"content"`
+	Embeds    []DiscordEmbed `json:"embeds,omitempty"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color,omitempty"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// webhookClient は応答しないウェブフックで位置情報の送信とサーバの終了が止まらないよう、
+// 待ち時間に上限を設ける
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// defaultTeamColor は色が設定されていないチームに使う（地図の他チームの色と同じ）
+const defaultTeamColor = 0x27ae60
+
+func teamEmbedColor(team *structs.Team) int {
+	color, err := strconv.ParseInt(strings.TrimPrefix(team.Color, "#"), 16, 32)
+	if err != nil {
+		return defaultTeamColor
+	}
+	return int(color)
 }
 
-func NotifyGeolocationUpdate(userDetail *structs.UserDetail, webhookURL *string, location *structs.Geolocation) error {
-	if webhookURL == nil || *webhookURL == "" {
+// Notify sends the location update to the webhook. It lets a WebhookConfig be used
+// wherever a notifier is expected.
+func (w *WebhookConfig) Notify(userDetail *structs.UserDetail, location *structs.Geolocation) error {
+	return NotifyGeolocationUpdate(userDetail, w, location)
+}
+
+func NotifyGeolocationUpdate(userDetail *structs.UserDetail, webhook *WebhookConfig, location *structs.Geolocation) error {
+	if webhook == nil || webhook.URL == "" {
 		return fmt.Errorf("webhookURL is empty")
 	}
-	if !strings.HasPrefix(*webhookURL, "http://") && !strings.HasPrefix(*webhookURL, "https://") {
+	if !strings.HasPrefix(webhook.URL, "http://") && !strings.HasPrefix(webhook.URL, "https://") {
 		return fmt.Errorf("webhookURL must start with http:// or https://")
 	}
 
+	title := userDetail.Team.Name
+	if userDetail.Team.Icon != "" {
+		title = userDetail.Team.Icon + " " + title
+	}
 	data := DiscordWebhookContent{
 		Username:  "市内鬼ごっこ",
-		AvatarURL: "https://lh3.googleusercontent.com/a/ACg8ocIAjvLfg1jNaC3znxz_Zy1AV6fCJ0aNUath8zBQwvzPhmZzUq0=s96-c",
-		Content: fmt.Sprintf("`%s` の位置情報が ユーザ `%s` によって更新されました。\n位置情報: 緯度 %f, 経度 %f",
+		AvatarURL: webhook.AvatarURL,
+		Content: fmt.Sprintf("`%s` の位置情報が ユーザ `%s` によって更新されました。",
 			userDetail.Team.Name,
 			userDetail.UserProfile.UserName,
-			location.Latitude,
-			location.Longitude,
 		),
+		Embeds: []DiscordEmbed{
+			{
+				Title:       title,
+				Description: userDetail.Team.Motto,
+				Color:       teamEmbedColor(&userDetail.Team),
+				Fields: []DiscordEmbedField{
+					{Name: "更新したユーザ", Value: userDetail.UserProfile.UserName},
+					{Name: "緯度", Value: fmt.Sprintf("%f", location.Latitude), Inline: true},
+					{Name: "経度", Value: fmt.Sprintf("%f", location.Longitude), Inline: true},
+				},
+				Timestamp: location.CreatedAt.Format(time.RFC3339),
+			},
+		},
 	}
 
 	jsonData, err := json.Marshal(data)
@@ -45,15 +104,21 @@ func NotifyGeolocationUpdate(userDetail *structs.UserDetail, webhookURL *string,
 		return fmt.Errorf("failed to marshal json: %w", err)
 	}
 
-	resp, err := http.Post(
-		*webhookURL,
+	resp, err := webhookClient.Post(
+		webhook.URL,
 		"application/json",
 		bytes.NewBuffer(jsonData),
 	)
 	if err != nil {
+		WebhookDeliveries.Inc("failure")
 		return fmt.Errorf("failed to send webhook: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		WebhookDeliveries.Inc("failure")
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	WebhookDeliveries.Inc("success")
 
 	return nil
 }
@@ -1,376 +1,226 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
-	"strconv"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	// 時刻の判定に使うタイムゾーンを、tzdata のないコンテナでも読めるようにする
+	_ "time/tzdata"
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/m-tsuru/tenchi-geolocation/handler"
 	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/router"
+	"github.com/m-tsuru/tenchi-geolocation/service"
 	"github.com/m-tsuru/tenchi-geolocation/structs"
-	// "gorm.io/driver/sqlite"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-func Requirelogin(db *gorm.DB, jwtTokenSecret string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		jwtToken := c.Cookies("jwt")
-		if jwtToken == "" {
-			return c.Status(fiber.StatusUnauthorized).SendString("JWT token is required")
-		}
-		if !lib.CheckNotExpireJWT(jwtToken, jwtTokenSecret) {
-			return c.Status(fiber.StatusUnauthorized).SendString("JWT token is expired")
+func main() {
+	cfg, args, err := lib.LoadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
 		}
-		userID, err := lib.GetUserIDByJWT(jwtToken, jwtTokenSecret)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusUnauthorized).SendString("Invalid JWT token: " + err.Error())
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	// 設定の確認と secrets ファイルの操作は、設定に問題があっても実行できる
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfig(cfg, args[1:]); err != nil {
+			log.Fatal(err)
 		}
-		dbInstance := &structs.Database{DB: db}
-		IsExist, err := dbInstance.GetUserDetailByID(userID)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get user detail: " + err.Error())
+		return
+	}
+	// コンテナのヘルスチェックは設定の検証をせず、サーバに問い合わせるだけ
+	if len(args) > 0 && args[0] == "healthcheck" {
+		if err := runHealthcheck(cfg, args[1:]); err != nil {
+			log.Fatal(err)
 		}
-		if IsExist == nil {
-			return c.Status(fiber.StatusUnauthorized).SendString("JWT Token is invalid")
+		return
+	}
+	if len(args) > 0 && args[0] == "secrets" {
+		if err := runSecrets(args[1:]); err != nil {
+			log.Fatal(err)
 		}
-		return c.Next()
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
 	}
-}
 
-func AllowTimingMiddleware() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		// 許可する時刻（"15:04" 形式）の配列
-		allowedTimes := []string{
-			"00:00",
-			"00:30",
-			"01:00",
-			"01:30",
-			"02:00",
-			"02:30",
-			"03:00",
-			"03:30",
-			"04:00",
-			"04:30",
-			"05:00",
-			"05:30",
-			"06:00",
-			"06:30",
-			"07:00",
-			"07:30",
-			"08:00",
-			"08:30",
-			"09:00",
-			"09:30",
-			"10:00",
-			"10:30",
-			"11:00",
-			"11:30",
-			"12:00",
-			"12:30",
-			"13:00",
-			"13:30",
-			"14:00",
-			"14:30",
-			"15:00",
-			"15:30",
-			"16:00",
-			"16:30",
-			"17:00",
-			"17:30",
-			"18:00",
-			"18:30",
-			"19:00",
-			"19:30",
-			"20:00",
-			"20:30",
-			"21:00",
-			"21:30",
-			"22:00",
-			"22:30",
-			"23:00",
-			"23:30",
-		}
+	db, err := lib.OpenDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
 
-		now := c.Context().Time()
-		for _, t := range allowedTimes {
-			parsed, err := strconv.ParseInt(t[:2], 10, 0)
-			if err != nil {
-				continue // フォーマット不正はスキップ
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			if err := runMigrate(db, args[1:]); err != nil {
+				log.Fatal(err)
 			}
-			hour := int(parsed)
-			minute, err := strconv.ParseInt(t[3:], 10, 0)
-			if err != nil {
-				continue // フォーマット不正はスキップ
+		case "seed":
+			// 空のデータベースにも投入できるよう、先にマイグレーションを適用する
+			if _, err := migrateOnStartup(db, cfg.Database.AutoMigrate); err != nil {
+				log.Fatalf("Failed to migrate database: %v", err)
 			}
-			// 指定時刻の前後2分の範囲
-			startHM := hour*60 + int(minute) - 3
-			endHM := hour*60 + int(minute) + 3
-
-			// 現在時刻の年月日は無視し、時分のみ比較
-			nowHM := now.Hour()*60 + now.Minute()
-
-			if startHM <= nowHM && nowHM <= endHM {
-				return c.Next()
+			if err := runSeed(db, args[1:]); err != nil {
+				log.Fatal(err)
+			}
+		case "check":
+			if err := runCheck(db, args[1:]); err != nil {
+				log.Fatal(err)
 			}
+		default:
+			log.Fatalf("Unknown command: %s", args[0])
 		}
-		return c.Status(fiber.StatusForbidden).SendString("Request not allowed at this time")
+		return
 	}
-}
 
-func main() {
-	oaCfg, svrCfg, dsnCfg, webhookURL, err := lib.LoadConfig()
+	// サーバのログは構造化して出力する。サブコマンドは人が読むので従来どおり
+	slog.SetDefault(lib.NewLogger(cfg.Log, os.Stderr))
+	db.Logger = lib.NewGormLogger(cfg.Log)
+
+	migrator, err := migrateOnStartup(db, cfg.Database.AutoMigrate)
 	if err != nil {
-		// Handle error
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to migrate database", err)
 	}
 
-	db, err := gorm.Open(
-		postgres.Open(*dsnCfg),
-		&gorm.Config{},
-	)
-	if err != nil {
-        log.Fatalf("Failed to open database: %v", err)
-    }
+	repos := repository.New(&structs.Database{DB: db})
 
-	dbInstance := &structs.Database{DB: db}
-	err = dbInstance.AutoMigrateModels()
+	cacheStore, err := lib.NewCacheStore(cfg.Cache)
 	if err != nil {
-		// Handle error
-		log.Fatalf("Failed to auto-migrate models: %v", err)
+		fatal("Failed to set up cache", err)
 	}
-	err = dbInstance.AutoCreateTestData()
-	if err != nil {
-		// Handle error
-		log.Fatalf("Failed to auto-create test data: %v", err)
-	}
-
-	app := fiber.New()
-	app.Static("/", "./web")
-
-	api := app.Group("/api")
-
-	api.Get("/login", func(c *fiber.Ctx) error {
-		authURL := lib.GetGoogleOAuthURL(oaCfg)
-		return c.Redirect(authURL, fiber.StatusFound)
-	})
-
-	api.Get("/callback", func(c *fiber.Ctx) error {
-
-		userCallback, err := lib.LoginOperation(c, oaCfg)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusInternalServerError).SendString("Login operation failed: " + err.Error())
-		}
-
-		dbInstance := &structs.Database{DB: db}
-		id, ok := (*userCallback)["sub"]
-		if !ok {
-			return c.Status(fiber.StatusInternalServerError).SendString("User ID not found in callback")
-		}
-		idStr, ok := id.(string)
-		if !ok {
-			return c.Status(fiber.StatusInternalServerError).SendString("User ID is not a string")
-		}
-		exists, err := dbInstance.CheckUserExistsByID(idStr)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get user by ID")
+	if redis, ok := cacheStore.(*lib.RedisCache); ok {
+		// 起動時に接続できなくても、キャッシュなしで動作は続ける
+		if err := redis.Ping(context.Background()); err != nil {
+			slog.Warn("Redis cache is unavailable", "error", err)
 		}
+	}
+	positions := service.NewPositionCache(cacheStore, cfg.Cache.TTL)
 
-		if !exists {
-			_, err := dbInstance.CreateUser(idStr, (*userCallback)["email"].(string), (*userCallback)["picture"].(string))
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).SendString("Failed to create user: " + err.Error())
-			}
-			// JSON Web Token Generation
-			token, err := lib.GenerateJWT(idStr, svrCfg.JWTTokenSecret)
-			if err != nil {
-				// Handle error
-				return c.Status(fiber.StatusInternalServerError).SendString("Failed to generate JWT: " + err.Error())
-			}
-			c.Cookie(&fiber.Cookie{
-				Name:     "jwt",
-				Value:    *token,
-				HTTPOnly: true,
-				Secure:   true,
-				SameSite: fiber.CookieSameSiteStrictMode,
-			})
-			return c.Redirect("/", fiber.StatusFound)
-		}
-
-		// JSON Web Token Generation
-		token, err := lib.GenerateJWT(idStr, svrCfg.JWTTokenSecret)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to generate JWT: " + err.Error())
-		}
-		c.Cookie(&fiber.Cookie{
-			Name:     "jwt",
-			Value:    *token,
-			HTTPOnly: true,
-			Secure:   true,
-			SameSite: fiber.CookieSameSiteStrictMode,
-		})
-
-		return c.Redirect("/", fiber.StatusFound)
-	})
-
-	api.Post("/logout", func(c *fiber.Ctx) error {
-		c.Cookie(&fiber.Cookie{
-			Name:     "jwt",
-			Value:    "",
-			HTTPOnly: true,
-			Secure:   true,
-			SameSite: fiber.CookieSameSiteStrictMode,
-			Expires:  time.Unix(0, 0), // 1970年
-		})
-		return c.SendStatus(fiber.StatusOK)
-	})
-
-	auth := api.Group("/", Requirelogin(db, svrCfg.JWTTokenSecret))
+	limiter, err := lib.NewRateLimiter(cfg.RateLimit, cfg.Cache.RedisURL)
+	if err != nil {
+		fatal("Failed to set up rate limiting", err)
+	}
 
-	auth.Get("/user/me", func(c *fiber.Ctx) error {
-		jwtToken := c.Cookies("jwt")
-		if jwtToken == "" {
-			return c.Status(fiber.StatusUnauthorized).SendString("JWT token is required")
-		}
-		userID, err := lib.GetUserIDByJWT(jwtToken, svrCfg.JWTTokenSecret)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).SendString("Invalid JWT token: " + err.Error())
-		}
-		dbInstance := &structs.Database{DB: db}
-		userDetail, err := dbInstance.GetUserDetailByID(userID)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get user detail: " + err.Error())
-		}
-		tid := strconv.Itoa(userDetail.Team.ID)
-		teamDetail, err := dbInstance.GetTeamDetailByID(tid)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get team detail: " + err.Error())
-		}
-		return c.JSON(fiber.Map{
-			"user_profile": userDetail.UserProfile,
-			"team":         userDetail.Team,
-			"team_members": teamDetail.Members,
+	// バックグラウンド処理は終了時に止め、実行中の処理が終わるのを待つ
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		lib.RunRetentionJob(workersCtx, repos.Retention, cfg.Retention.Interval, func() {
+			positions.Invalidate(context.Background())
 		})
-	})
+	}()
 
-	auth.Get("/user/:id", func(c *fiber.Ctx) error {
-		userID := c.Params("id")
-		dbInstance := &structs.Database{DB: db}
-		userDetail, err := dbInstance.GetUserDetailByID(userID)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get user detail: " + err.Error())
-		}
-		return c.JSON(userDetail)
-	})
+	avatarStore, err := lib.NewAvatarStore(cfg.Avatar)
+	if err != nil {
+		fatal("Failed to set up avatar storage", err)
+	}
+	// 以前のバージョンで Google の URL を直接参照していたアバターを取り込む
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		lib.CacheRemoteAvatars(workersCtx, repos.Users, avatarStore)
+	}()
+
+	jwtKeys, err := cfg.JWTKeySet()
+	if err != nil {
+		fatal("Invalid JWT key configuration", err)
+	}
 
-	auth.Post("/user/me/name", func(c *fiber.Ctx) error {
-		var req struct {
-			Name string `json:"name"`
-		}
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid request data: " + err.Error())
-		}
-		jwtToken := c.Cookies("jwt")
-		if jwtToken == "" {
-			return c.Status(fiber.StatusUnauthorized).SendString("JWT token is required")
-		}
-		userID, err := lib.GetUserIDByJWT(jwtToken, svrCfg.JWTTokenSecret)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).SendString("Invalid JWT token: " + err.Error())
-		}
-		dbInstance := &structs.Database{DB: db}
-		userDetail, err := dbInstance.ChangeUserName(userID, req.Name)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to change user name: " + err.Error())
-		}
-		return c.JSON(userDetail)
+	health := service.NewHealthService(repos, migrator.Latest())
+	h := handler.New(cfg.OAuth2(), cfg.Cookie, cfg.BasePath, handler.Services{
+		Auth:      service.NewAuthService(repos, jwtKeys, avatarStore, positions),
+		Users:     service.NewUserService(repos, avatarStore, positions),
+		Tokens:    service.NewTokenService(repos),
+		Teams:     service.NewTeamService(repos, positions),
+		Geo:       service.NewGeoService(repos, &cfg.Webhook, positions, cfg.Game),
+		Retention: service.NewRetentionService(repos),
+		Health:    health,
+		Audit:     service.NewAuditService(repos),
 	})
 
-	auth.Get("/team/:id", func(c *fiber.Ctx) error {
-		userID := c.Params("id")
-		dbInstance := &structs.Database{DB: db}
-		teamDetail, err := dbInstance.GetTeamDetailByID(userID)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get team detail: " + err.Error())
-		}
-		return c.JSON(teamDetail)
+	app := fiber.New(fiber.Config{
+		ErrorHandler: lib.ErrorHandler,
+		// JSON のログにバナーを混ぜない
+		DisableStartupMessage: cfg.Log.Format == "json",
+		// X-Forwarded-Proto は信用するプロキシから来たものだけを使う
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies.Strings(),
 	})
+	app.Use(handler.RequestLogger(cfg.TrustedProxies))
+	if cfg.Metrics.Enabled {
+		// 静的ファイルを含むすべてのリクエストを計測する
+		app.Use(handler.HTTPMetrics())
+	}
+	router.Register(app, h, cfg, limiter)
+	if cfg.BasePath != "" {
+		app.Static(cfg.BasePath, "./web")
+	} else {
+		app.Static("/", "./web")
+	}
 
-	auth.Post("/team/:id", func(c *fiber.Ctx) error {
-		teamID := c.Params("id")
-		var req struct {
-			Name string `json:"name"`
-		}
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid request data: " + err.Error())
-		}
-		dbInstance := &structs.Database{DB: db}
-		var team structs.Team
-		if err := dbInstance.First(&team, "id = ?", teamID).Error; err != nil {
-			return c.Status(fiber.StatusNotFound).SendString("Team not found")
-		}
-		team.Name = req.Name
-		if err := dbInstance.Save(&team).Error; err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to update team name: " + err.Error())
-		}
-		return c.JSON(team)
-	})
-
-	auth.Get("/geo", func(c *fiber.Ctx) error {
-		dbInstance := &structs.Database{DB: db}
-		geolocationDetails, err := dbInstance.GetGeolocationLatestAll()
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get geolocation details: " + err.Error())
-		}
-		return c.JSON(geolocationDetails)
-	})
-
-	auth.Post("/geo", AllowTimingMiddleware(), func(c *fiber.Ctx) error {
-		jwtToken := c.Cookies("jwt")
-		if jwtToken == "" {
-			return c.Status(fiber.StatusUnauthorized).SendString("JWT token is required")
-		}
-		userID, err := lib.GetUserIDByJWT(jwtToken, svrCfg.JWTTokenSecret)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusUnauthorized).SendString("Invalid JWT token: " + err.Error())
-		}
-		var requestData struct {
-			Latitude  float64 `json:"latitude"`
-			Longitude float64 `json:"longitude"`
-		}
-		if err := c.BodyParser(&requestData); err != nil {
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid request data: " + err.Error())
-		}
-		dbInstance := &structs.Database{DB: db}
-		geolocation, err := dbInstance.AddGeolocation(userID, requestData.Latitude, requestData.Longitude)
-		if err != nil {
-			// Handle error
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to add geolocation: " + err.Error())
-		}
-		ud, err := dbInstance.GetUserDetailByID(userID)
-		if ud == nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("User detail not found")
-		} else if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to get user detail: " + err.Error())
-		}
-
-		err = lib.NotifyGeolocationUpdate(ud, webhookURL, geolocation)
-		if err != nil {
-			log.Printf("Failed to notify geolocation update: %v", err)
-		}
-		return c.JSON(geolocation)
-	})
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listen(cfg.Listen)
+	}()
+	slog.Info("Server started", "listen", cfg.Listen)
+	select {
+	case err := <-listenErr:
+		fatal("Failed to start server", err)
+	case <-ctx.Done():
+	}
+	// もう一度シグナルを送れば待たずに終了する
+	stop()
+
+	slog.Info("Shutting down")
+	health.Drain()
+	stopWorkers()
+	time.Sleep(cfg.ShutdownDelay)
+	deadline := time.Now().Add(cfg.ShutdownTimeout)
+	if err := app.ShutdownWithTimeout(cfg.ShutdownTimeout); err != nil {
+		slog.Error("Failed to shut down server", "error", err)
+	}
+	if !waitGroupUntil(&workers, deadline) {
+		slog.Warn("Background jobs did not finish in time", "timeout", cfg.ShutdownTimeout.String())
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	slog.Info("Server stopped")
+}
 
-	if err := app.Listen(":3000"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// waitGroupUntil waits for wg and reports whether it finished before the deadline.
+func waitGroupUntil(wg *sync.WaitGroup, deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
 	}
 }
+
+// fatal logs err and exits. It is used once the structured logger is set up.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/migrations"
+)
+
+const migrateUsage = `usage: tenchi-geolocation migrate <command>
+
+commands:
+  up [version]   apply pending migrations (up to version, default: latest)
+  down [steps]   roll back the last migrations (default: 1)
+  status         show the current version and pending migrations`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(db *gorm.DB, args []string) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		target := 0
+		if len(args) > 1 {
+			if target, err = strconv.Atoi(args[1]); err != nil || target < 0 {
+				return fmt.Errorf("invalid version: %s", args[1])
+			}
+		}
+		applied, err := migrator.Up(target)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		applied, err := migrator.Applied()
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			fmt.Printf("%04d_%s\tapplied at %s\n", m.Version, m.Name, m.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+		pending, err := migrator.Check()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("latest supported version: %d, pending: %d\n", migrator.Latest(), pending)
+	default:
+		return fmt.Errorf("%s", migrateUsage)
+	}
+	return nil
+}
+
+// migrateOnStartup refuses to start on a newer schema and applies pending migrations
+// unless auto migration is disabled. The migrator is returned for the readiness probe.
+func migrateOnStartup(db *gorm.DB, autoMigrate bool) (*migrations.Migrator, error) {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := migrator.Check()
+	if err != nil {
+		return nil, err
+	}
+	if pending == 0 {
+		return migrator, nil
+	}
+	if !autoMigrate {
+		return nil, fmt.Errorf("%d pending migrations; run \"tenchi-geolocation migrate up\"", pending)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		return nil, err
+	}
+	return migrator, nil
+}
@@ -0,0 +1,295 @@
+// Package migrations applies the versioned SQL migrations embedded in the binary.
+// Each dialect has its own directory of NNNN_name.up.sql / NNNN_name.down.sql files,
+// and the applied versions are recorded in the schema_version table.
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer version of
+// the server. Running an older binary against it could corrupt data.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+// advisoryLockID serializes migrations when several instances start at once (Postgres only).
+const advisoryLockID = 0x7465_6e63_6869
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New loads the migrations for the database's dialect ("postgres" or "sqlite").
+func New(db *gorm.DB) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database %q", dialect)
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := fileNamePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := files.ReadFile(path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down scripts", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest is the newest version this build knows about.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable(tx *gorm.DB) error {
+	return tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp NOT NULL
+	)`).Error
+}
+
+// Current returns the highest applied version, or 0 for an empty database.
+func (m *Migrator) Current() (int, error) {
+	if err := m.ensureTable(m.db); err != nil {
+		return 0, err
+	}
+	return currentVersion(m.db)
+}
+
+func currentVersion(tx *gorm.DB) (int, error) {
+	var version *int
+	if err := tx.Raw("SELECT MAX(version) FROM schema_version").Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return *version, nil
+}
+
+func (m *Migrator) Applied() ([]AppliedMigration, error) {
+	if err := m.ensureTable(m.db); err != nil {
+		return nil, err
+	}
+	var applied []AppliedMigration
+	err := m.db.Raw("SELECT version, name, applied_at FROM schema_version ORDER BY version").Scan(&applied).Error
+	return applied, err
+}
+
+// Check fails with ErrSchemaTooNew if the database has migrations this build does not know.
+// It returns the number of pending migrations.
+func (m *Migrator) Check() (int, error) {
+	current, err := m.Current()
+	if err != nil {
+		return 0, err
+	}
+	if current > m.Latest() {
+		return 0, fmt.Errorf("%w (database: %d, supported: %d)", ErrSchemaTooNew, current, m.Latest())
+	}
+	pending := 0
+	for _, migration := range m.migrations {
+		if migration.Version > current {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up applies all pending migrations up to and including target. A target of 0 means
+// the latest version.
+func (m *Migrator) Up(target int) ([]Migration, error) {
+	if _, err := m.Check(); err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = m.Latest()
+	}
+	var applied []Migration
+	for _, migration := range m.migrations {
+		if migration.Version > target {
+			break
+		}
+		done, err := m.apply(migration, true)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Down rolls back the given number of most recently applied migrations.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if _, err := m.Check(); err != nil {
+		return nil, err
+	}
+	var reverted []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := m.migrations[i]
+		done, err := m.apply(migration, false)
+		if err != nil {
+			return reverted, fmt.Errorf("rollback of %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			reverted = append(reverted, migration)
+		}
+	}
+	return reverted, nil
+}
+
+// apply runs one migration in its own transaction together with the schema_version
+// update. It reports false if there was nothing to do, e.g. another instance was first.
+func (m *Migrator) apply(migration Migration, up bool) (bool, error) {
+	if m.dialect != "sqlite" {
+		return m.applyWith(m.db, migration, up)
+	}
+	// SQLite は ALTER TABLE で制約を追加できず、テーブルを作り直すことになる。
+	// PRAGMA foreign_keys はトランザクション内では変更できないので、同じ接続で外側から切り替える
+	done := false
+	err := m.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("PRAGMA foreign_keys = ON")
+		var err error
+		done, err = m.applyWith(conn, migration, up)
+		return err
+	})
+	return done, err
+}
+
+func (m *Migrator) applyWith(db *gorm.DB, migration Migration, up bool) (bool, error) {
+	done := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if m.dialect == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", advisoryLockID).Error; err != nil {
+				return err
+			}
+		}
+		if err := m.ensureTable(tx); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Raw("SELECT COUNT(*) FROM schema_version WHERE version = ?", migration.Version).Scan(&count).Error; err != nil {
+			return err
+		}
+		if (count > 0) == up {
+			return nil
+		}
+
+		script := migration.Down
+		if up {
+			script = migration.Up
+		}
+		for _, statement := range splitStatements(script) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		if up {
+			if err := tx.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, time.Now().UTC()).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Exec("DELETE FROM schema_version WHERE version = ?", migration.Version).Error; err != nil {
+			return err
+		}
+		done = true
+		return nil
+	})
+	return done, err
+}
+
+// splitStatements splits a script on semicolons that end a line and drops comments.
+// Statements in the migrations must not contain such semicolons inside literals.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
@@ -0,0 +1,316 @@
+package migrations_test
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/migrations"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := lib.OpenDatabase(&lib.DatabaseConfig{
+		Driver: lib.DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "test.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func newMigrator(t *testing.T, db *gorm.DB) *migrations.Migrator {
+	t.Helper()
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrator
+}
+
+type schemaObject struct {
+	Type string
+	Name string
+	SQL  string
+}
+
+// quotedTableName matches the name in CREATE TABLE, which SQLite writes with double
+// quotes after a table is renamed (when a migration rebuilds it).
+var quotedTableName = regexp.MustCompile(`^CREATE TABLE "(\w+)"`)
+
+// schema returns the tables, indexes and triggers, without schema_version.
+func schema(t *testing.T, db *gorm.DB) map[string]schemaObject {
+	t.Helper()
+	var objects []schemaObject
+	if err := db.Raw(`SELECT type, name, COALESCE(sql, '') AS sql FROM sqlite_master
+		WHERE name NOT IN ('schema_version', 'sqlite_sequence') AND name NOT LIKE 'sqlite_autoindex_%'`).
+		Scan(&objects).Error; err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]schemaObject, len(objects))
+	for _, object := range objects {
+		object.SQL = quotedTableName.ReplaceAllString(object.SQL, "CREATE TABLE `$1`")
+		byName[object.Name] = object
+	}
+	return byName
+}
+
+func diffSchema(t *testing.T, got map[string]schemaObject, want map[string]schemaObject) {
+	t.Helper()
+	for name, object := range want {
+		other, ok := got[name]
+		switch {
+		case !ok:
+			t.Errorf("%s %s is missing", object.Type, name)
+		case other.SQL != object.SQL:
+			t.Errorf("%s %s changed:\n got: %s\nwant: %s", object.Type, name, other.SQL, object.SQL)
+		}
+	}
+	for name, object := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s %s was left behind", object.Type, name)
+		}
+	}
+}
+
+// TestSQLiteUpDown applies the migrations one at a time, and checks that rolling each
+// one back restores the previous schema and that it can be applied again.
+func TestSQLiteUpDown(t *testing.T) {
+	db := openSQLite(t)
+	migrator := newMigrator(t, db)
+	if migrator.Latest() == 0 {
+		t.Fatal("no migrations were loaded")
+	}
+
+	for version := 1; version <= migrator.Latest(); version++ {
+		before := schema(t, db)
+		applied, err := migrator.Up(version)
+		if err != nil {
+			t.Fatalf("Up(%d): %v", version, err)
+		}
+		if len(applied) != 1 || applied[0].Version != version {
+			t.Fatalf("Up(%d) applied %v, want only %d", version, applied, version)
+		}
+		after := schema(t, db)
+
+		reverted, err := migrator.Down(1)
+		if err != nil {
+			t.Fatalf("Down after %d: %v", version, err)
+		}
+		if len(reverted) != 1 || reverted[0].Version != version {
+			t.Fatalf("Down(1) reverted %v, want %d", reverted, version)
+		}
+		t.Run("down "+applied[0].Name, func(t *testing.T) {
+			diffSchema(t, schema(t, db), before)
+		})
+
+		if _, err := migrator.Up(version); err != nil {
+			t.Fatalf("Up(%d) again: %v", version, err)
+		}
+		t.Run("up "+applied[0].Name, func(t *testing.T) {
+			diffSchema(t, schema(t, db), after)
+		})
+	}
+
+	current, err := migrator.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != migrator.Latest() {
+		t.Errorf("Current() = %d, want %d", current, migrator.Latest())
+	}
+	if applied, err := migrator.Up(0); err != nil || len(applied) != 0 {
+		t.Errorf("Up(0) on an up-to-date database = %v, %v, want nothing to do", applied, err)
+	}
+
+	if _, err := migrator.Down(migrator.Latest()); err != nil {
+		t.Fatalf("Down(all): %v", err)
+	}
+	if left := schema(t, db); len(left) != 0 {
+		t.Errorf("rolling back every migration left %d objects: %v", len(left), left)
+	}
+}
+
+func TestSQLiteSchemaTooNew(t *testing.T) {
+	db := openSQLite(t)
+	migrator := newMigrator(t, db)
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'future', CURRENT_TIMESTAMP)",
+		migrator.Latest()+1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Check(); !errors.Is(err, migrations.ErrSchemaTooNew) {
+		t.Errorf("Check() = %v, want ErrSchemaTooNew", err)
+	}
+	if _, err := migrator.Up(0); !errors.Is(err, migrations.ErrSchemaTooNew) {
+		t.Errorf("Up(0) = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestSQLiteRelativeAvatarURLs(t *testing.T) {
+	db := openSQLite(t)
+	migrator := newMigrator(t, db)
+	if _, err := migrator.Up(6); err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []struct{ id, avatarURL string }{
+		{"uploaded", "/api/v1/avatars/uploaded?v=1"},
+		{"google", "https://lh3.googleusercontent.com/a/photo"},
+	} {
+		if err := db.Exec("INSERT INTO users (id, email, is_exist, role) VALUES (?, '', true, 'player')", profile.id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Exec("INSERT INTO user_profiles (id, user_name, team_id, avatar_url) VALUES (?, ?, 9, ?)",
+			profile.id, profile.id, profile.avatarURL).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	avatarURL := func(id string) string {
+		var url string
+		if err := db.Raw("SELECT avatar_url FROM user_profiles WHERE id = ?", id).Scan(&url).Error; err != nil {
+			t.Fatal(err)
+		}
+		return url
+	}
+
+	if _, err := migrator.Up(7); err != nil {
+		t.Fatal(err)
+	}
+	if got := avatarURL("uploaded"); got != "avatars/uploaded?v=1" {
+		t.Errorf("after up: avatar_url = %q, want the key relative to /api/v1", got)
+	}
+	if got := avatarURL("google"); got != "https://lh3.googleusercontent.com/a/photo" {
+		t.Errorf("after up: external avatar_url = %q, want it unchanged", got)
+	}
+
+	if _, err := migrator.Down(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := avatarURL("uploaded"); got != "/api/v1/avatars/uploaded?v=1" {
+		t.Errorf("after down: avatar_url = %q, want the absolute path back", got)
+	}
+}
+
+func TestSQLiteGeolocationGameBackfill(t *testing.T) {
+	db := openSQLite(t)
+	migrator := newMigrator(t, db)
+	if _, err := migrator.Up(7); err != nil {
+		t.Fatal(err)
+	}
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if err := db.Exec(query, args...).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 試合 1 と 2 は同じ時間帯、試合 3 は翌日
+	exec(`INSERT INTO games (id, name, start_at, end_at) VALUES
+		(1, 'a', '2025-07-20 10:00:00+09:00', '2025-07-20 17:00:00+09:00'),
+		(2, 'b', '2025-07-20 10:00:00+09:00', '2025-07-20 17:00:00+09:00'),
+		(3, 'c', '2025-07-21 10:00:00+09:00', '2025-07-21 17:00:00+09:00')`)
+	exec("INSERT INTO teams (id, name, game_id) VALUES (1, 'team of b', 2)")
+	for _, user := range []struct {
+		id     string
+		teamID int
+	}{{"in-team", 1}, {"no-team", 9}} {
+		exec("INSERT INTO users (id, email, is_exist, role) VALUES (?, '', true, 'player')", user.id)
+		exec("INSERT INTO user_profiles (id, user_name, team_id) VALUES (?, ?, ?)", user.id, user.id, user.teamID)
+	}
+	exec(`INSERT INTO geolocations (id, user_id, latitude, longitude, created_at) VALUES
+		(1, 'in-team', 0, 0, '2025-07-20 12:00:00+09:00'),
+		(2, 'in-team', 0, 0, '2025-07-21 12:00:00+09:00'),
+		(3, 'no-team', 0, 0, '2025-07-20 12:00:00+09:00'),
+		(4, 'no-team', 0, 0, '2025-07-22 12:00:00+09:00')`)
+
+	if _, err := migrator.Up(8); err != nil {
+		t.Fatal(err)
+	}
+	var rows []struct {
+		ID     int
+		GameID *int
+	}
+	if err := db.Raw("SELECT id, game_id FROM geolocations ORDER BY id").Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d geolocations, want 4", len(rows))
+	}
+	want := map[int]int{
+		1: 2, // チームの試合
+		2: 3, // チームの試合の期間外だが、期間が重なる試合は 1 つだけ
+		3: 0, // 試合 1 と 2 のどちらか決められない
+		4: 0, // どの試合の期間でもない
+	}
+	for _, row := range rows {
+		got := 0
+		if row.GameID != nil {
+			got = *row.GameID
+		}
+		if got != want[row.ID] {
+			t.Errorf("geolocation %d: game_id = %v, want %d (0 for NULL)", row.ID, got, want[row.ID])
+		}
+	}
+}
+
+func TestSQLiteUserNameUniqueRenamesDuplicates(t *testing.T) {
+	db := openSQLite(t)
+	migrator := newMigrator(t, db)
+	if _, err := migrator.Up(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO teams (id, name) VALUES (1, 'a'), (2, 'b')").Error; err != nil {
+		t.Fatal(err)
+	}
+	profiles := []struct {
+		id, userName string
+		teamID       int
+		want         string
+	}{
+		{"u1", "Taro", 1, "Taro"},
+		{"u2", "taro", 1, "taro (2)"},
+		// 番号を付けた名前が既にあるので ID を付ける
+		{"u3", "TARO", 1, "TARO (u3)"},
+		{"u4", "Taro (3)", 1, "Taro (3)"},
+		// 別のチームなら重複してよい
+		{"u5", "Taro", 2, "Taro"},
+		{"u6", "ユーザ名未登録", 1, "ユーザ名未登録"},
+		{"u7", "ユーザ名未登録", 1, "ユーザ名未登録"},
+	}
+	for i, p := range profiles {
+		if err := db.Exec("INSERT INTO users (id, email, is_exist, role) VALUES (?, '', true, 'player')", p.id).Error; err != nil {
+			t.Fatal(err)
+		}
+		// 登録順で最初のユーザが名前を保つ
+		createdAt := time.Date(2025, 7, 1, 0, i, 0, 0, time.UTC)
+		if err := db.Exec("INSERT INTO user_profiles (id, created_at, user_name, team_id) VALUES (?, ?, ?, ?)",
+			p.id, createdAt, p.userName, p.teamID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := migrator.Up(6); err != nil {
+		t.Fatalf("Up(6) with duplicate user names: %v", err)
+	}
+	for _, p := range profiles {
+		var got string
+		if err := db.Raw("SELECT user_name FROM user_profiles WHERE id = ?", p.id).Scan(&got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got != p.want {
+			t.Errorf("user %s: user_name = %q, want %q", p.id, got, p.want)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "retention_runs";
+DROP TABLE IF EXISTS "games";
+DROP TABLE IF EXISTS "api_tokens";
+DROP TABLE IF EXISTS "geolocations";
+DROP TABLE IF EXISTS "teams";
+DROP TABLE IF EXISTS "user_profiles";
+DROP TABLE IF EXISTS "users";
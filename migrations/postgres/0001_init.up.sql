@@ -0,0 +1,102 @@
+-- 0001: AutoMigrate で作っていたスキーマと同じもの
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" text,
+    "email" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "is_exist" boolean DEFAULT true,
+    "role" text NOT NULL DEFAULT 'player',
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "user_profiles" (
+    "id" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_name" text NOT NULL,
+    "team_id" bigint NOT NULL,
+    "avatar_url" text DEFAULT null,
+    "google_avatar_url" text DEFAULT null,
+    "avatar_source" text NOT NULL DEFAULT 'google',
+    "phone" text DEFAULT null,
+    "emergency_contact" text DEFAULT null,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "teams" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "name" text NOT NULL,
+    "game_id" bigint,
+    "color" text DEFAULT null,
+    "icon" text DEFAULT null,
+    "motto" text DEFAULT null,
+    "captain_id" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_teams_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "geolocations" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" text NOT NULL,
+    "latitude" decimal NOT NULL,
+    "longitude" decimal NOT NULL,
+    "coarsened" boolean NOT NULL DEFAULT false,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" text NOT NULL,
+    "name" text NOT NULL,
+    "token_hash" text NOT NULL,
+    "scopes" text NOT NULL,
+    "expires_at" timestamptz,
+    "last_used_at" timestamptz,
+    "revoked_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_tokens_token_hash" ON "api_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_user_id" ON "api_tokens" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "games" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "name" text NOT NULL,
+    "start_at" timestamptz,
+    "end_at" timestamptz,
+    "retention_days" bigint,
+    "retention_mode" text NOT NULL DEFAULT 'purge',
+    "coarsen_digits" bigint NOT NULL DEFAULT 2,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "retention_runs" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "game_id" bigint NOT NULL,
+    "mode" text NOT NULL,
+    "affected" bigint NOT NULL,
+    "recorded_before" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_retention_runs_game_id" ON "retention_runs" ("game_id");
+
+-- AutoMigrate で作られた古いデータベースには、後から追加したカラムが無いことがある
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "role" text NOT NULL DEFAULT 'player';
+ALTER TABLE "user_profiles" ADD COLUMN IF NOT EXISTS "google_avatar_url" text DEFAULT null;
+ALTER TABLE "user_profiles" ADD COLUMN IF NOT EXISTS "avatar_source" text NOT NULL DEFAULT 'google';
+ALTER TABLE "user_profiles" ADD COLUMN IF NOT EXISTS "phone" text DEFAULT null;
+ALTER TABLE "user_profiles" ADD COLUMN IF NOT EXISTS "emergency_contact" text DEFAULT null;
+ALTER TABLE "teams" ADD COLUMN IF NOT EXISTS "game_id" bigint;
+ALTER TABLE "teams" ADD COLUMN IF NOT EXISTS "color" text DEFAULT null;
+ALTER TABLE "teams" ADD COLUMN IF NOT EXISTS "icon" text DEFAULT null;
+ALTER TABLE "teams" ADD COLUMN IF NOT EXISTS "motto" text DEFAULT null;
+ALTER TABLE "teams" ADD COLUMN IF NOT EXISTS "captain_id" text;
+ALTER TABLE "geolocations" ADD COLUMN IF NOT EXISTS "coarsened" boolean NOT NULL DEFAULT false;
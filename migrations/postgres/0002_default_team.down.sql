@@ -0,0 +1 @@
+DELETE FROM "teams" WHERE "id" = 9 AND NOT EXISTS (SELECT 1 FROM "user_profiles" WHERE "team_id" = 9);
@@ -0,0 +1,6 @@
+-- チーム未所属のユーザが入るチーム（structs.DefaultTeamID）
+INSERT INTO "teams" ("id", "created_at", "updated_at", "name")
+VALUES (9, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'チーム未設定')
+ON CONFLICT DO NOTHING;
+-- ID を指定して挿入したので、シーケンスが既存の ID と重ならないようにする
+SELECT setval(pg_get_serial_sequence('teams', 'id'), GREATEST((SELECT MAX("id") FROM "teams"), 1));
@@ -0,0 +1,9 @@
+ALTER TABLE "retention_runs" DROP CONSTRAINT IF EXISTS "fk_retention_runs_game";
+ALTER TABLE "api_tokens" DROP CONSTRAINT IF EXISTS "fk_api_tokens_user";
+ALTER TABLE "geolocations" DROP CONSTRAINT IF EXISTS "fk_geolocations_user";
+ALTER TABLE "teams" DROP CONSTRAINT IF EXISTS "fk_teams_captain";
+ALTER TABLE "teams" DROP CONSTRAINT IF EXISTS "fk_teams_game";
+DROP INDEX IF EXISTS "idx_user_profiles_team_id";
+ALTER TABLE "user_profiles" DROP CONSTRAINT IF EXISTS "fk_user_profiles_team";
+ALTER TABLE "user_profiles" DROP CONSTRAINT IF EXISTS "fk_user_profiles_user";
+ALTER TABLE "user_profiles" ALTER COLUMN "team_id" DROP DEFAULT;
@@ -0,0 +1,24 @@
+-- 0003: 外部キー制約
+-- 既存のデータに不整合があっても適用できるよう NOT VALID で追加する。新しい書き込みは検査される。
+-- 残っている不整合は tenchi-geolocation check で確認し、直してから check validate で検証する
+ALTER TABLE "user_profiles" ALTER COLUMN "team_id" SET DEFAULT 9;
+ALTER TABLE "user_profiles" ADD CONSTRAINT "fk_user_profiles_user"
+    FOREIGN KEY ("id") REFERENCES "users" ("id") ON DELETE CASCADE NOT VALID;
+-- チームを削除したメンバーは「チーム未設定」に戻す
+ALTER TABLE "user_profiles" ADD CONSTRAINT "fk_user_profiles_team"
+    FOREIGN KEY ("team_id") REFERENCES "teams" ("id") ON DELETE SET DEFAULT NOT VALID;
+CREATE INDEX IF NOT EXISTS "idx_user_profiles_team_id" ON "user_profiles" ("team_id");
+
+ALTER TABLE "teams" ADD CONSTRAINT "fk_teams_game"
+    FOREIGN KEY ("game_id") REFERENCES "games" ("id") ON DELETE SET NULL NOT VALID;
+ALTER TABLE "teams" ADD CONSTRAINT "fk_teams_captain"
+    FOREIGN KEY ("captain_id") REFERENCES "users" ("id") ON DELETE SET NULL NOT VALID;
+
+ALTER TABLE "geolocations" ADD CONSTRAINT "fk_geolocations_user"
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE NOT VALID;
+
+ALTER TABLE "api_tokens" ADD CONSTRAINT "fk_api_tokens_user"
+    FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE NOT VALID;
+
+ALTER TABLE "retention_runs" ADD CONSTRAINT "fk_retention_runs_game"
+    FOREIGN KEY ("game_id") REFERENCES "games" ("id") ON DELETE CASCADE NOT VALID;
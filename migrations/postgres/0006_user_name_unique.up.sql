@@ -0,0 +1,25 @@
+-- 0006: チーム内でユーザ名（大文字小文字は区別しない）を重複させない（structs.UpdateUserProfile）
+-- 初期値の名前と退会済みユーザの名前は重複してよい
+
+-- 既に重複している名前は、最初に登録したユーザ以外に " (2)" のような番号を付けて変える。
+-- 番号を付けた名前が既にある場合は、番号の代わりにユーザ ID を付ける
+CREATE TEMPORARY TABLE "user_name_renames" AS
+SELECT "id", "team_id", "user_name", "user_name" || ' (' || "rank" || ')' AS "new_name" FROM (
+    SELECT "id", "team_id", "user_name",
+        ROW_NUMBER() OVER (PARTITION BY "team_id", LOWER("user_name") ORDER BY "created_at", "id") AS "rank"
+    FROM "user_profiles"
+    WHERE "user_name" NOT IN ('ユーザ名未登録', '退会済みユーザ')
+) "ranked"
+WHERE "rank" > 1;
+UPDATE "user_name_renames" SET "new_name" = "user_name" || ' (' || "id" || ')'
+WHERE EXISTS (
+    SELECT 1 FROM "user_profiles" "p"
+    WHERE "p"."team_id" = "user_name_renames"."team_id" AND LOWER("p"."user_name") = LOWER("user_name_renames"."new_name")
+);
+UPDATE "user_profiles" SET "user_name" = (
+    SELECT "new_name" FROM "user_name_renames" WHERE "user_name_renames"."id" = "user_profiles"."id"
+)
+WHERE "id" IN (SELECT "id" FROM "user_name_renames");
+DROP TABLE "user_name_renames";
+
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_profiles_team_id_user_name" ON "user_profiles" ("team_id", LOWER("user_name")) WHERE "user_name" NOT IN ('ユーザ名未登録', '退会済みユーザ');
@@ -0,0 +1 @@
+UPDATE "user_profiles" SET "avatar_url" = '/api/v1/' || "avatar_url" WHERE "avatar_url" LIKE 'avatars/%';
@@ -0,0 +1,3 @@
+-- 0007: サーバが配信するアバターの URL を /api/v1 からの相対パス（lib.AvatarKey）で保存する
+-- ベースパスや API のバージョンが変わっても保存済みの値を書き換えずに済む
+UPDATE "user_profiles" SET "avatar_url" = SUBSTR("avatar_url", 9) WHERE "avatar_url" LIKE '/api/v1/avatars/%';
@@ -0,0 +1,7 @@
+ALTER TABLE "retention_runs" DROP CONSTRAINT IF EXISTS "fk_retention_runs_game";
+ALTER TABLE "retention_runs" ADD CONSTRAINT "fk_retention_runs_game"
+    FOREIGN KEY ("game_id") REFERENCES "games" ("id") ON DELETE CASCADE NOT VALID;
+
+DROP INDEX IF EXISTS "idx_geolocations_game_id";
+ALTER TABLE "geolocations" DROP CONSTRAINT IF EXISTS "fk_geolocations_game";
+ALTER TABLE "geolocations" DROP COLUMN IF EXISTS "game_id";
@@ -0,0 +1,24 @@
+-- 0008: 位置情報に登録時のチームの試合を記録し、保持期間の処理をその試合の位置情報に限る（structs.ApplyRetention）
+-- 試合を削除しても保持期間の処理の記録（retention_runs）は消さない
+ALTER TABLE "geolocations" ADD COLUMN IF NOT EXISTS "game_id" bigint;
+ALTER TABLE "geolocations" ADD CONSTRAINT "fk_geolocations_game"
+    FOREIGN KEY ("game_id") REFERENCES "games" ("id") ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS "idx_geolocations_game_id" ON "geolocations" ("game_id");
+
+-- 既存の位置情報は、今のチームの試合の期間内ならその試合、そうでなければ期間が重なる試合が 1 つだけのときその試合とみなす。
+-- どちらでもない位置情報は game_id が NULL のまま残り、保持期間の処理の対象にならない
+UPDATE "geolocations" AS g SET "game_id" = gm."id"
+FROM "user_profiles" p
+JOIN "teams" t ON t."id" = p."team_id"
+JOIN "games" gm ON gm."id" = t."game_id"
+WHERE p."id" = g."user_id" AND g."created_at" BETWEEN gm."start_at" AND gm."end_at";
+UPDATE "geolocations" AS g SET "game_id" = (
+    SELECT gm."id" FROM "games" gm WHERE g."created_at" BETWEEN gm."start_at" AND gm."end_at"
+)
+WHERE g."game_id" IS NULL AND (
+    SELECT COUNT(*) FROM "games" gm WHERE g."created_at" BETWEEN gm."start_at" AND gm."end_at"
+) = 1;
+
+ALTER TABLE "retention_runs" DROP CONSTRAINT IF EXISTS "fk_retention_runs_game";
+ALTER TABLE "retention_runs" ADD CONSTRAINT "fk_retention_runs_game"
+    FOREIGN KEY ("game_id") REFERENCES "games" ("id") ON DELETE RESTRICT NOT VALID;
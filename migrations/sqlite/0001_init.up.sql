@@ -0,0 +1,84 @@
+-- 0001: AutoMigrate で作っていたスキーマと同じもの
+CREATE TABLE IF NOT EXISTS `users` (
+    `id` text,
+    `email` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `is_exist` numeric DEFAULT true,
+    `role` text NOT NULL DEFAULT "player",
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `user_profiles` (
+    `id` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_name` text NOT NULL,
+    `team_id` integer NOT NULL,
+    `avatar_url` text DEFAULT null,
+    `google_avatar_url` text DEFAULT null,
+    `avatar_source` text NOT NULL DEFAULT "google",
+    `phone` text DEFAULT null,
+    `emergency_contact` text DEFAULT null,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `teams` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `name` text NOT NULL,
+    `game_id` integer,
+    `color` text DEFAULT null,
+    `icon` text DEFAULT null,
+    `motto` text DEFAULT null,
+    `captain_id` text,
+    CONSTRAINT `uni_teams_name` UNIQUE (`name`)
+);
+
+CREATE TABLE IF NOT EXISTS `geolocations` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `latitude` real NOT NULL,
+    `longitude` real NOT NULL,
+    `coarsened` numeric NOT NULL DEFAULT false
+);
+
+CREATE TABLE IF NOT EXISTS `api_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `name` text NOT NULL,
+    `token_hash` text NOT NULL,
+    `scopes` text NOT NULL,
+    `expires_at` datetime,
+    `last_used_at` datetime,
+    `revoked_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_tokens_token_hash` ON `api_tokens` (`token_hash`);
+CREATE INDEX IF NOT EXISTS `idx_api_tokens_user_id` ON `api_tokens` (`user_id`);
+
+CREATE TABLE IF NOT EXISTS `games` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `name` text NOT NULL,
+    `start_at` datetime,
+    `end_at` datetime,
+    `retention_days` integer,
+    `retention_mode` text NOT NULL DEFAULT "purge",
+    `coarsen_digits` integer NOT NULL DEFAULT 2
+);
+
+CREATE TABLE IF NOT EXISTS `retention_runs` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `game_id` integer NOT NULL,
+    `mode` text NOT NULL,
+    `affected` integer NOT NULL,
+    `recorded_before` datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `idx_retention_runs_game_id` ON `retention_runs` (`game_id`);
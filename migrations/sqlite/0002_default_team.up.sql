@@ -0,0 +1,3 @@
+-- チーム未所属のユーザが入るチーム（structs.DefaultTeamID）
+INSERT OR IGNORE INTO `teams` (`id`, `created_at`, `updated_at`, `name`)
+VALUES (9, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'チーム未設定');
@@ -0,0 +1,81 @@
+CREATE TABLE `retention_runs_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `game_id` integer NOT NULL,
+    `mode` text NOT NULL,
+    `affected` integer NOT NULL,
+    `recorded_before` datetime NOT NULL
+);
+INSERT INTO `retention_runs_new` (`id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before`)
+SELECT `id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before` FROM `retention_runs`;
+DROP TABLE `retention_runs`;
+ALTER TABLE `retention_runs_new` RENAME TO `retention_runs`;
+CREATE INDEX `idx_retention_runs_game_id` ON `retention_runs` (`game_id`);
+
+CREATE TABLE `api_tokens_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `name` text NOT NULL,
+    `token_hash` text NOT NULL,
+    `scopes` text NOT NULL,
+    `expires_at` datetime,
+    `last_used_at` datetime,
+    `revoked_at` datetime
+);
+INSERT INTO `api_tokens_new` (`id`, `created_at`, `updated_at`, `user_id`, `name`, `token_hash`, `scopes`, `expires_at`, `last_used_at`, `revoked_at`)
+SELECT `id`, `created_at`, `updated_at`, `user_id`, `name`, `token_hash`, `scopes`, `expires_at`, `last_used_at`, `revoked_at` FROM `api_tokens`;
+DROP TABLE `api_tokens`;
+ALTER TABLE `api_tokens_new` RENAME TO `api_tokens`;
+CREATE UNIQUE INDEX `idx_api_tokens_token_hash` ON `api_tokens` (`token_hash`);
+CREATE INDEX `idx_api_tokens_user_id` ON `api_tokens` (`user_id`);
+
+CREATE TABLE `geolocations_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `latitude` real NOT NULL,
+    `longitude` real NOT NULL,
+    `coarsened` numeric NOT NULL DEFAULT false
+);
+INSERT INTO `geolocations_new` (`id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened`)
+SELECT `id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened` FROM `geolocations`;
+DROP TABLE `geolocations`;
+ALTER TABLE `geolocations_new` RENAME TO `geolocations`;
+
+CREATE TABLE `user_profiles_new` (
+    `id` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_name` text NOT NULL,
+    `team_id` integer NOT NULL,
+    `avatar_url` text DEFAULT null,
+    `google_avatar_url` text DEFAULT null,
+    `avatar_source` text NOT NULL DEFAULT "google",
+    `phone` text DEFAULT null,
+    `emergency_contact` text DEFAULT null,
+    PRIMARY KEY (`id`)
+);
+INSERT INTO `user_profiles_new` (`id`, `created_at`, `updated_at`, `user_name`, `team_id`, `avatar_url`, `google_avatar_url`, `avatar_source`, `phone`, `emergency_contact`)
+SELECT `id`, `created_at`, `updated_at`, `user_name`, `team_id`, `avatar_url`, `google_avatar_url`, `avatar_source`, `phone`, `emergency_contact` FROM `user_profiles`;
+DROP TABLE `user_profiles`;
+ALTER TABLE `user_profiles_new` RENAME TO `user_profiles`;
+
+CREATE TABLE `teams_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `name` text NOT NULL,
+    `game_id` integer,
+    `color` text DEFAULT null,
+    `icon` text DEFAULT null,
+    `motto` text DEFAULT null,
+    `captain_id` text,
+    CONSTRAINT `uni_teams_name` UNIQUE (`name`)
+);
+INSERT INTO `teams_new` (`id`, `created_at`, `updated_at`, `name`, `game_id`, `color`, `icon`, `motto`, `captain_id`)
+SELECT `id`, `created_at`, `updated_at`, `name`, `game_id`, `color`, `icon`, `motto`, `captain_id` FROM `teams`;
+DROP TABLE `teams`;
+ALTER TABLE `teams_new` RENAME TO `teams`;
@@ -0,0 +1,95 @@
+-- 0003: 外部キー制約
+-- SQLite では制約を後から追加できないので、参照する側のテーブルを作り直す。
+-- 移行中は外部キーの検査を止めるため（migrations.Migrator を参照）、既存の不整合はそのまま残る。
+-- 残っている不整合は tenchi-geolocation check で確認する。
+-- 先に作り直す teams は、まだどのテーブルからも参照されていない
+
+CREATE TABLE `teams_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `name` text NOT NULL,
+    `game_id` integer,
+    `color` text DEFAULT null,
+    `icon` text DEFAULT null,
+    `motto` text DEFAULT null,
+    `captain_id` text,
+    CONSTRAINT `uni_teams_name` UNIQUE (`name`),
+    FOREIGN KEY (`game_id`) REFERENCES `games` (`id`) ON DELETE SET NULL,
+    FOREIGN KEY (`captain_id`) REFERENCES `users` (`id`) ON DELETE SET NULL
+);
+INSERT INTO `teams_new` (`id`, `created_at`, `updated_at`, `name`, `game_id`, `color`, `icon`, `motto`, `captain_id`)
+SELECT `id`, `created_at`, `updated_at`, `name`, `game_id`, `color`, `icon`, `motto`, `captain_id` FROM `teams`;
+DROP TABLE `teams`;
+ALTER TABLE `teams_new` RENAME TO `teams`;
+
+CREATE TABLE `user_profiles_new` (
+    `id` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_name` text NOT NULL,
+    `team_id` integer NOT NULL DEFAULT 9,
+    `avatar_url` text DEFAULT null,
+    `google_avatar_url` text DEFAULT null,
+    `avatar_source` text NOT NULL DEFAULT "google",
+    `phone` text DEFAULT null,
+    `emergency_contact` text DEFAULT null,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`team_id`) REFERENCES `teams` (`id`) ON DELETE SET DEFAULT
+);
+INSERT INTO `user_profiles_new` (`id`, `created_at`, `updated_at`, `user_name`, `team_id`, `avatar_url`, `google_avatar_url`, `avatar_source`, `phone`, `emergency_contact`)
+SELECT `id`, `created_at`, `updated_at`, `user_name`, `team_id`, `avatar_url`, `google_avatar_url`, `avatar_source`, `phone`, `emergency_contact` FROM `user_profiles`;
+DROP TABLE `user_profiles`;
+ALTER TABLE `user_profiles_new` RENAME TO `user_profiles`;
+CREATE INDEX `idx_user_profiles_team_id` ON `user_profiles` (`team_id`);
+
+CREATE TABLE `geolocations_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `latitude` real NOT NULL,
+    `longitude` real NOT NULL,
+    `coarsened` numeric NOT NULL DEFAULT false,
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+INSERT INTO `geolocations_new` (`id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened`)
+SELECT `id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened` FROM `geolocations`;
+DROP TABLE `geolocations`;
+ALTER TABLE `geolocations_new` RENAME TO `geolocations`;
+
+CREATE TABLE `api_tokens_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `name` text NOT NULL,
+    `token_hash` text NOT NULL,
+    `scopes` text NOT NULL,
+    `expires_at` datetime,
+    `last_used_at` datetime,
+    `revoked_at` datetime,
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+INSERT INTO `api_tokens_new` (`id`, `created_at`, `updated_at`, `user_id`, `name`, `token_hash`, `scopes`, `expires_at`, `last_used_at`, `revoked_at`)
+SELECT `id`, `created_at`, `updated_at`, `user_id`, `name`, `token_hash`, `scopes`, `expires_at`, `last_used_at`, `revoked_at` FROM `api_tokens`;
+DROP TABLE `api_tokens`;
+ALTER TABLE `api_tokens_new` RENAME TO `api_tokens`;
+CREATE UNIQUE INDEX `idx_api_tokens_token_hash` ON `api_tokens` (`token_hash`);
+CREATE INDEX `idx_api_tokens_user_id` ON `api_tokens` (`user_id`);
+
+CREATE TABLE `retention_runs_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `game_id` integer NOT NULL,
+    `mode` text NOT NULL,
+    `affected` integer NOT NULL,
+    `recorded_before` datetime NOT NULL,
+    FOREIGN KEY (`game_id`) REFERENCES `games` (`id`) ON DELETE CASCADE
+);
+INSERT INTO `retention_runs_new` (`id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before`)
+SELECT `id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before` FROM `retention_runs`;
+DROP TABLE `retention_runs`;
+ALTER TABLE `retention_runs_new` RENAME TO `retention_runs`;
+CREATE INDEX `idx_retention_runs_game_id` ON `retention_runs` (`game_id`);
@@ -0,0 +1,2 @@
+-- 0004: 各ユーザの最新の位置情報を引くためのインデックス（structs.GetGeolocationLatestAll）
+CREATE INDEX IF NOT EXISTS `idx_geolocations_user_id_created_at` ON `geolocations` (`user_id`, `created_at`);
@@ -0,0 +1,19 @@
+-- 0005: 誰が何をしたかの記録（structs.AuditLog）。追記のみで、更新と削除はトリガで拒否する
+CREATE TABLE IF NOT EXISTS `audit_logs` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime NOT NULL,
+    `actor_id` text NOT NULL,
+    `action` text NOT NULL,
+    `target_type` text NOT NULL,
+    `target_id` text NOT NULL,
+    `before` text NOT NULL DEFAULT '',
+    `after` text NOT NULL DEFAULT '',
+    `ip` text NOT NULL DEFAULT '',
+    `request_id` text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS `idx_audit_logs_created_at` ON `audit_logs` (`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_audit_logs_actor_id` ON `audit_logs` (`actor_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_logs_target` ON `audit_logs` (`target_type`, `target_id`);
+-- ユーザを削除しても記録は残すので外部キーは付けない
+CREATE TRIGGER IF NOT EXISTS `audit_logs_no_update` BEFORE UPDATE ON `audit_logs` BEGIN SELECT RAISE(ABORT, 'audit_logs is append-only'); END;
+CREATE TRIGGER IF NOT EXISTS `audit_logs_no_delete` BEFORE DELETE ON `audit_logs` BEGIN SELECT RAISE(ABORT, 'audit_logs is append-only'); END;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS `idx_user_profiles_team_id_user_name`;
@@ -0,0 +1,30 @@
+CREATE TABLE `retention_runs_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `game_id` integer NOT NULL,
+    `mode` text NOT NULL,
+    `affected` integer NOT NULL,
+    `recorded_before` datetime NOT NULL,
+    FOREIGN KEY (`game_id`) REFERENCES `games` (`id`) ON DELETE CASCADE
+);
+INSERT INTO `retention_runs_new` (`id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before`)
+SELECT `id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before` FROM `retention_runs`;
+DROP TABLE `retention_runs`;
+ALTER TABLE `retention_runs_new` RENAME TO `retention_runs`;
+CREATE INDEX `idx_retention_runs_game_id` ON `retention_runs` (`game_id`);
+
+CREATE TABLE `geolocations_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `latitude` real NOT NULL,
+    `longitude` real NOT NULL,
+    `coarsened` numeric NOT NULL DEFAULT false,
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+INSERT INTO `geolocations_new` (`id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened`)
+SELECT `id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened` FROM `geolocations`;
+DROP TABLE `geolocations`;
+ALTER TABLE `geolocations_new` RENAME TO `geolocations`;
+CREATE INDEX `idx_geolocations_user_id_created_at` ON `geolocations` (`user_id`, `created_at`);
@@ -0,0 +1,54 @@
+-- 0008: 位置情報に登録時のチームの試合を記録し、保持期間の処理をその試合の位置情報に限る（structs.ApplyRetention）
+-- 試合を削除しても保持期間の処理の記録（retention_runs）は消さない
+
+CREATE TABLE `geolocations_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `user_id` text NOT NULL,
+    `game_id` integer,
+    `latitude` real NOT NULL,
+    `longitude` real NOT NULL,
+    `coarsened` numeric NOT NULL DEFAULT false,
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`game_id`) REFERENCES `games` (`id`) ON DELETE SET NULL
+);
+INSERT INTO `geolocations_new` (`id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened`)
+SELECT `id`, `created_at`, `updated_at`, `user_id`, `latitude`, `longitude`, `coarsened` FROM `geolocations`;
+DROP TABLE `geolocations`;
+ALTER TABLE `geolocations_new` RENAME TO `geolocations`;
+CREATE INDEX `idx_geolocations_user_id_created_at` ON `geolocations` (`user_id`, `created_at`);
+CREATE INDEX `idx_geolocations_game_id` ON `geolocations` (`game_id`);
+
+-- 既存の位置情報は、今のチームの試合の期間内ならその試合、そうでなければ期間が重なる試合が 1 つだけのときその試合とみなす。
+-- どちらでもない位置情報は game_id が NULL のまま残り、保持期間の処理の対象にならない
+UPDATE `geolocations` SET `game_id` = (
+    SELECT `games`.`id` FROM `user_profiles`
+    JOIN `teams` ON `teams`.`id` = `user_profiles`.`team_id`
+    JOIN `games` ON `games`.`id` = `teams`.`game_id`
+    WHERE `user_profiles`.`id` = `geolocations`.`user_id`
+        AND `geolocations`.`created_at` BETWEEN `games`.`start_at` AND `games`.`end_at`
+);
+UPDATE `geolocations` SET `game_id` = (
+    SELECT `games`.`id` FROM `games`
+    WHERE `geolocations`.`created_at` BETWEEN `games`.`start_at` AND `games`.`end_at`
+)
+WHERE `game_id` IS NULL AND (
+    SELECT COUNT(*) FROM `games`
+    WHERE `geolocations`.`created_at` BETWEEN `games`.`start_at` AND `games`.`end_at`
+) = 1;
+
+CREATE TABLE `retention_runs_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `game_id` integer NOT NULL,
+    `mode` text NOT NULL,
+    `affected` integer NOT NULL,
+    `recorded_before` datetime NOT NULL,
+    FOREIGN KEY (`game_id`) REFERENCES `games` (`id`) ON DELETE RESTRICT
+);
+INSERT INTO `retention_runs_new` (`id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before`)
+SELECT `id`, `created_at`, `game_id`, `mode`, `affected`, `recorded_before` FROM `retention_runs`;
+DROP TABLE `retention_runs`;
+ALTER TABLE `retention_runs_new` RENAME TO `retention_runs`;
+CREATE INDEX `idx_retention_runs_game_id` ON `retention_runs` (`game_id`);
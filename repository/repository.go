@@ -0,0 +1,93 @@
+// Package repository declares the data access the services depend on. The methods
+// are implemented by *structs.Database; tests and other backends can provide their own.
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+type UserRepository interface {
+	CheckUserExistsByID(userID string) (bool, error)
+	GetUserByID(userID string) (*structs.User, error)
+	GetUserDetailByID(userID string) (*structs.UserDetail, error)
+	CreateUser(userID string, email string, picture string) (*structs.User, error)
+	DeleteUser(userID string, purgeLocations bool) error
+	ExportUserData(userID string) (*structs.UserExport, error)
+	UpdateUserProfile(userID string, update structs.ProfileUpdate) (*structs.UserProfile, error)
+	ChangeUserName(userID string, newUserName string) (*structs.UserProfile, error)
+	SetGoogleAvatarURL(userID string, pictureURL string) (*structs.UserProfile, error)
+	ListProfilesWithRemoteAvatar() ([]structs.UserProfile, error)
+	ListContacts(teamID int) ([]structs.UserProfile, error)
+}
+
+type TeamRepository interface {
+	GetTeamByID(teamID string) (*structs.Team, error)
+	GetTeamDetailByID(teamID string) (*structs.TeamDetail, error)
+	UpdateTeam(teamID string, update structs.TeamUpdate) (*structs.Team, error)
+}
+
+type GeoRepository interface {
+	GetGeolocationLatestAll() (*[]structs.GeolocationDetail, error)
+	AddGeolocation(userID string, gameID *int, latitude float64, longitude float64) (*structs.Geolocation, error)
+}
+
+type APITokenRepository interface {
+	CreateAPIToken(userID string, name string, tokenHash string, scopes []string, expiresAt *time.Time) (*structs.APIToken, error)
+	GetActiveAPITokenByHash(tokenHash string) (*structs.APIToken, error)
+	ListAPITokensByUserID(userID string) ([]structs.APIToken, error)
+	RevokeAPIToken(userID string, tokenID string) (*structs.APIToken, error)
+	TouchAPIToken(tokenID int) error
+}
+
+type RetentionRepository interface {
+	ApplyRetention(now time.Time) ([]structs.RetentionRun, error)
+	ListRetentionRuns(limit int) ([]structs.RetentionRun, error)
+}
+
+type AuditRepository interface {
+	AddAuditLog(entry *structs.AuditLog) error
+	ListAuditLogs(filter structs.AuditLogFilter) ([]structs.AuditLog, error)
+}
+
+// HealthRepository answers the readiness probe.
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (int, error)
+}
+
+var (
+	_ UserRepository      = (*structs.Database)(nil)
+	_ TeamRepository      = (*structs.Database)(nil)
+	_ GeoRepository       = (*structs.Database)(nil)
+	_ APITokenRepository  = (*structs.Database)(nil)
+	_ RetentionRepository = (*structs.Database)(nil)
+	_ AuditRepository     = (*structs.Database)(nil)
+	_ HealthRepository    = (*structs.Database)(nil)
+)
+
+// Repositories bundles the repositories passed to the services.
+type Repositories struct {
+	Users     UserRepository
+	Teams     TeamRepository
+	Geo       GeoRepository
+	APITokens APITokenRepository
+	Retention RetentionRepository
+	Audit     AuditRepository
+	Health    HealthRepository
+}
+
+// New returns repositories backed by the database.
+func New(db *structs.Database) *Repositories {
+	return &Repositories{
+		Users:     db,
+		Teams:     db,
+		Geo:       db,
+		APITokens: db,
+		Retention: db,
+		Audit:     db,
+		Health:    db,
+	}
+}
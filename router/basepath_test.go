@@ -0,0 +1,75 @@
+package router_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+func TestBasePath(t *testing.T) {
+	const base = "/tenchi"
+	s := newTestServer(t, func(cfg *lib.Config) {
+		cfg.BasePath = base
+		cfg.Security.CSRF = true
+	})
+	s.repo.mu.Lock()
+	player := s.repo.profiles["player"]
+	player.AvatarURL = "avatars/player?v=1"
+	s.repo.profiles["player"] = player
+	s.repo.mu.Unlock()
+
+	tests := []struct {
+		path   string
+		auth   credentials
+		status int
+		want   string
+	}{
+		{base + "/healthz", nil, fiber.StatusOK, `"status":"ok"`},
+		{base + "/metrics", bearer(testMetricsToken), fiber.StatusOK, "# TYPE"},
+		{base + "/api/openapi.json", nil, fiber.StatusOK, `"url":"` + base + `/api/v1"`},
+		// アバターの URL はベースパスを含めて返す
+		{base + "/api/v1/user/me", session("player"), fiber.StatusOK, `"avatar_url":"` + base + `/api/v1/avatars/player?v=1"`},
+		{base + "/api/user/me", session("player"), fiber.StatusOK, `"AvatarURL":"` + base + `/api/avatars/player?v=1"`},
+		{base + "/api/v1/avatars/player", session("runner"), fiber.StatusOK, ""},
+		// ベースパスの外には何もない
+		{"/healthz", nil, fiber.StatusNotFound, ""},
+		{"/api/v1/user/me", session("player"), fiber.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, body := s.do(t, "GET", tt.path, nil, tt.auth)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("GET %s = %d, want %d: %s", tt.path, resp.StatusCode, tt.status, body)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("GET %s body does not contain %s: %s", tt.path, tt.want, body)
+			}
+		})
+	}
+
+	t.Run("redirects the base path to its directory", func(t *testing.T) {
+		resp, _ := s.do(t, "GET", base, nil, nil)
+		if resp.StatusCode != fiber.StatusMovedPermanently || resp.Header.Get(fiber.HeaderLocation) != base+"/" {
+			t.Errorf("GET %s = %d to %q, want a redirect to %s/", base, resp.StatusCode, resp.Header.Get(fiber.HeaderLocation), base)
+		}
+	})
+
+	t.Run("deprecated paths link to the versioned ones", func(t *testing.T) {
+		resp, _ := s.do(t, "GET", base+"/api/team/1", nil, session("player"))
+		if link := resp.Header.Get(fiber.HeaderLink); !strings.Contains(link, "<"+base+"/api/v1/team/1>") {
+			t.Errorf("Link = %q, want %s/api/v1/team/1", link, base)
+		}
+	})
+
+	t.Run("cookies are scoped to the base path", func(t *testing.T) {
+		resp, _ := s.do(t, "GET", base+"/healthz", nil, nil)
+		for _, c := range resp.Cookies() {
+			if c.Name == "csrf_token" && c.Path != base+"/" {
+				t.Errorf("csrf_token path = %q, want %s/", c.Path, base)
+			}
+		}
+	})
+}
@@ -0,0 +1,519 @@
+package router_test
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// memoryRepository keeps the data of the repository interfaces in maps, following the
+// behaviour of *structs.Database closely enough for the handlers: missing records are
+// gorm.ErrRecordNotFound and deleted users are hidden.
+type memoryRepository struct {
+	mu            sync.Mutex
+	users         map[string]structs.User
+	profiles      map[string]structs.UserProfile
+	teams         map[int]structs.Team
+	geolocations  []structs.Geolocation
+	tokens        []structs.APIToken
+	retentionRuns []structs.RetentionRun
+	auditLogs     []structs.AuditLog
+	schemaVersion int
+}
+
+var _ interface {
+	repository.UserRepository
+	repository.TeamRepository
+	repository.GeoRepository
+	repository.APITokenRepository
+	repository.RetentionRepository
+	repository.AuditRepository
+	repository.HealthRepository
+} = (*memoryRepository)(nil)
+
+func newMemoryRepository(schemaVersion int) *memoryRepository {
+	return &memoryRepository{
+		users:         map[string]structs.User{},
+		profiles:      map[string]structs.UserProfile{},
+		teams:         map[int]structs.Team{structs.DefaultTeamID: {ID: structs.DefaultTeamID, Name: "チーム未設定"}},
+		schemaVersion: schemaVersion,
+	}
+}
+
+func (m *memoryRepository) repositories() *repository.Repositories {
+	return &repository.Repositories{
+		Users:     m,
+		Teams:     m,
+		Geo:       m,
+		APITokens: m,
+		Retention: m,
+		Audit:     m,
+		Health:    m,
+	}
+}
+
+// addTeam and addUser set up the fixtures of a test.
+func (m *memoryRepository) addTeam(team structs.Team) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.teams[team.ID] = team
+}
+
+func (m *memoryRepository) addUser(userID string, role string, userName string, teamID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[userID] = structs.User{ID: userID, Email: userID + "@example.com", Role: role, IsExist: true}
+	m.profiles[userID] = structs.UserProfile{ID: userID, UserName: userName, TeamID: teamID, AvatarSource: structs.AvatarSourceGoogle}
+}
+
+func (m *memoryRepository) active(userID string) bool {
+	return m.users[userID].IsExist
+}
+
+func (m *memoryRepository) members(teamID int) []structs.UserProfile {
+	members := []structs.UserProfile{}
+	for _, profile := range m.profiles {
+		if profile.TeamID == teamID && m.active(profile.ID) {
+			members = append(members, profile)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+func (m *memoryRepository) CheckUserExistsByID(userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active(userID), nil
+}
+
+func (m *memoryRepository) GetUserByID(userID string) (*structs.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active(userID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	user := m.users[userID]
+	return &user, nil
+}
+
+func (m *memoryRepository) GetUserDetailByID(userID string) (*structs.UserDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.userDetail(userID)
+}
+
+func (m *memoryRepository) userDetail(userID string) (*structs.UserDetail, error) {
+	profile, ok := m.profiles[userID]
+	if !ok || !m.active(userID) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	team, ok := m.teams[profile.TeamID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &structs.UserDetail{UserProfile: profile, Team: team}, nil
+}
+
+func (m *memoryRepository) CreateUser(userID string, email string, picture string) (*structs.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user := structs.User{ID: userID, Email: email, Role: lib.RolePlayer, IsExist: true}
+	if previous, ok := m.users[userID]; ok {
+		user.Role = previous.Role
+	}
+	m.users[userID] = user
+	m.profiles[userID] = structs.UserProfile{
+		ID:              userID,
+		UserName:        structs.DefaultUserName,
+		TeamID:          structs.DefaultTeamID,
+		GoogleAvatarURL: picture,
+		AvatarSource:    structs.AvatarSourceGoogle,
+	}
+	return &user, nil
+}
+
+func (m *memoryRepository) DeleteUser(userID string, purgeLocations bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active(userID) {
+		return gorm.ErrRecordNotFound
+	}
+	user := m.users[userID]
+	user.IsExist, user.Email = false, ""
+	m.users[userID] = user
+
+	profile := m.profiles[userID]
+	profile.UserName = structs.DeletedUserName
+	profile.AvatarURL, profile.GoogleAvatarURL, profile.Phone, profile.EmergencyContact = "", "", "", ""
+	m.profiles[userID] = profile
+
+	for id, team := range m.teams {
+		if team.CaptainID != nil && *team.CaptainID == userID {
+			team.CaptainID = nil
+			m.teams[id] = team
+		}
+	}
+	now := time.Now()
+	for i := range m.tokens {
+		if m.tokens[i].UserID == userID && m.tokens[i].RevokedAt == nil {
+			m.tokens[i].RevokedAt = &now
+		}
+	}
+	if purgeLocations {
+		m.geolocations = slices.DeleteFunc(m.geolocations, func(g structs.Geolocation) bool { return g.UserID == userID })
+	}
+	return nil
+}
+
+func (m *memoryRepository) ExportUserData(userID string) (*structs.UserExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	detail, err := m.userDetail(userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &structs.UserExport{
+		ExportedAt:   time.Now(),
+		User:         m.users[userID],
+		UserProfile:  detail.UserProfile,
+		Contact:      detail.UserProfile.Contact(),
+		Team:         detail.Team,
+		Geolocations: []structs.Geolocation{},
+		APITokens:    []structs.APIToken{},
+	}
+	for _, g := range m.geolocations {
+		if g.UserID == userID {
+			export.Geolocations = append(export.Geolocations, g)
+		}
+	}
+	for _, token := range m.tokens {
+		if token.UserID == userID {
+			export.APITokens = append(export.APITokens, token)
+		}
+	}
+	return export, nil
+}
+
+func (m *memoryRepository) UpdateUserProfile(userID string, update structs.ProfileUpdate) (*structs.UserProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile, ok := m.profiles[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if update.UserName != nil {
+		for _, other := range m.members(profile.TeamID) {
+			if other.ID != userID && strings.EqualFold(other.UserName, *update.UserName) {
+				return nil, structs.ErrUserNameTaken
+			}
+		}
+		profile.UserName = *update.UserName
+	}
+	if update.AvatarURL != nil {
+		profile.AvatarURL = *update.AvatarURL
+	}
+	if update.AvatarSource != nil {
+		profile.AvatarSource = *update.AvatarSource
+	}
+	if update.Phone != nil {
+		profile.Phone = *update.Phone
+	}
+	if update.EmergencyContact != nil {
+		profile.EmergencyContact = *update.EmergencyContact
+	}
+	profile.UpdatedAt = time.Now()
+	m.profiles[userID] = profile
+	return &profile, nil
+}
+
+func (m *memoryRepository) ChangeUserName(userID string, newUserName string) (*structs.UserProfile, error) {
+	return m.UpdateUserProfile(userID, structs.ProfileUpdate{UserName: &newUserName})
+}
+
+func (m *memoryRepository) SetGoogleAvatarURL(userID string, pictureURL string) (*structs.UserProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile, ok := m.profiles[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	profile.GoogleAvatarURL = pictureURL
+	m.profiles[userID] = profile
+	return &profile, nil
+}
+
+func (m *memoryRepository) ListProfilesWithRemoteAvatar() ([]structs.UserProfile, error) {
+	return nil, nil
+}
+
+func (m *memoryRepository) ListContacts(teamID int) ([]structs.UserProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profiles := []structs.UserProfile{}
+	for _, profile := range m.profiles {
+		if m.active(profile.ID) && (teamID == 0 || profile.TeamID == teamID) {
+			profiles = append(profiles, profile)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].TeamID != profiles[j].TeamID {
+			return profiles[i].TeamID < profiles[j].TeamID
+		}
+		return profiles[i].UserName < profiles[j].UserName
+	})
+	return profiles, nil
+}
+
+func (m *memoryRepository) team(teamID string) (structs.Team, error) {
+	id, err := strconv.Atoi(teamID)
+	if err != nil {
+		return structs.Team{}, gorm.ErrRecordNotFound
+	}
+	team, ok := m.teams[id]
+	if !ok {
+		return structs.Team{}, gorm.ErrRecordNotFound
+	}
+	return team, nil
+}
+
+func (m *memoryRepository) GetTeamByID(teamID string) (*structs.Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	team, err := m.team(teamID)
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (m *memoryRepository) GetTeamDetailByID(teamID string) (*structs.TeamDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	team, err := m.team(teamID)
+	if err != nil {
+		return nil, err
+	}
+	return &structs.TeamDetail{Team: team, Members: m.members(team.ID)}, nil
+}
+
+func (m *memoryRepository) UpdateTeam(teamID string, update structs.TeamUpdate) (*structs.Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	team, err := m.team(teamID)
+	if err != nil {
+		return nil, err
+	}
+	if update.Name != nil {
+		for _, other := range m.teams {
+			if other.ID != team.ID && other.Name == *update.Name {
+				return nil, structs.ErrTeamNameTaken
+			}
+		}
+		team.Name = *update.Name
+	}
+	if update.Color != nil {
+		team.Color = *update.Color
+	}
+	if update.Icon != nil {
+		team.Icon = *update.Icon
+	}
+	if update.Motto != nil {
+		team.Motto = *update.Motto
+	}
+	if update.CaptainID != nil {
+		if *update.CaptainID == "" {
+			team.CaptainID = nil
+		} else {
+			if profile, ok := m.profiles[*update.CaptainID]; !ok || profile.TeamID != team.ID || !m.active(profile.ID) {
+				return nil, structs.ErrCaptainNotMember
+			}
+			captainID := *update.CaptainID
+			team.CaptainID = &captainID
+		}
+	}
+	team.UpdatedAt = time.Now()
+	m.teams[team.ID] = team
+	return &team, nil
+}
+
+func (m *memoryRepository) GetGeolocationLatestAll() (*[]structs.GeolocationDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latest := map[int]structs.Geolocation{}
+	for _, g := range m.geolocations {
+		profile, ok := m.profiles[g.UserID]
+		if !ok || !m.active(g.UserID) {
+			continue
+		}
+		if previous, ok := latest[profile.TeamID]; !ok || !g.CreatedAt.Before(previous.CreatedAt) {
+			latest[profile.TeamID] = g
+		}
+	}
+	details := []structs.GeolocationDetail{}
+	for teamID, g := range latest {
+		team, ok := m.teams[teamID]
+		if !ok {
+			continue
+		}
+		// データベースと同じく、連絡先は読み込まない
+		members := m.members(teamID)
+		for i := range members {
+			members[i].Phone, members[i].EmergencyContact = "", ""
+		}
+		details = append(details, structs.GeolocationDetail{
+			TeamDetail:  structs.TeamDetail{Team: team, Members: members},
+			Geolocation: g,
+		})
+	}
+	sort.Slice(details, func(i, j int) bool {
+		return details[i].TeamDetail.Team.ID < details[j].TeamDetail.Team.ID
+	})
+	return &details, nil
+}
+
+func (m *memoryRepository) AddGeolocation(userID string, gameID *int, latitude float64, longitude float64) (*structs.Geolocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	geolocation := structs.Geolocation{
+		ID:        len(m.geolocations) + 1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    userID,
+		GameID:    gameID,
+		Latitude:  latitude,
+		Longitude: longitude,
+	}
+	m.geolocations = append(m.geolocations, geolocation)
+	return &geolocation, nil
+}
+
+func (m *memoryRepository) CreateAPIToken(userID string, name string, tokenHash string, scopes []string, expiresAt *time.Time) (*structs.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	token := structs.APIToken{
+		ID:        len(m.tokens) + 1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    userID,
+		Name:      name,
+		TokenHash: tokenHash,
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	m.tokens = append(m.tokens, token)
+	return &token, nil
+}
+
+func (m *memoryRepository) GetActiveAPITokenByHash(tokenHash string) (*structs.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash && token.RevokedAt == nil &&
+			(token.ExpiresAt == nil || token.ExpiresAt.After(time.Now())) {
+			return &token, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryRepository) ListAPITokensByUserID(userID string) ([]structs.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokens := []structs.APIToken{}
+	for i := len(m.tokens) - 1; i >= 0; i-- {
+		if m.tokens[i].UserID == userID {
+			tokens = append(tokens, m.tokens[i])
+		}
+	}
+	return tokens, nil
+}
+
+func (m *memoryRepository) RevokeAPIToken(userID string, tokenID string) (*structs.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.tokens {
+		if strconv.Itoa(m.tokens[i].ID) == tokenID && m.tokens[i].UserID == userID {
+			if m.tokens[i].RevokedAt == nil {
+				now := time.Now()
+				m.tokens[i].RevokedAt = &now
+			}
+			token := m.tokens[i]
+			return &token, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryRepository) TouchAPIToken(tokenID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for i := range m.tokens {
+		if m.tokens[i].ID == tokenID {
+			m.tokens[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) ApplyRetention(now time.Time) ([]structs.RetentionRun, error) {
+	return nil, nil
+}
+
+func (m *memoryRepository) ListRetentionRuns(limit int) ([]structs.RetentionRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runs := slices.Clone(m.retentionRuns)
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (m *memoryRepository) AddAuditLog(entry *structs.AuditLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = len(m.auditLogs) + 1
+	entry.CreatedAt = time.Now()
+	m.auditLogs = append(m.auditLogs, *entry)
+	return nil
+}
+
+func (m *memoryRepository) ListAuditLogs(filter structs.AuditLogFilter) ([]structs.AuditLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	logs := []structs.AuditLog{}
+	for i := len(m.auditLogs) - 1; i >= 0 && len(logs) < filter.Limit; i-- {
+		entry := m.auditLogs[i]
+		if filter.ActorID != "" && entry.ActorID != filter.ActorID ||
+			filter.Action != "" && entry.Action != filter.Action ||
+			filter.TargetType != "" && entry.TargetType != filter.TargetType ||
+			filter.TargetID != "" && entry.TargetID != filter.TargetID ||
+			filter.BeforeID != 0 && entry.ID >= filter.BeforeID {
+			continue
+		}
+		logs = append(logs, entry)
+	}
+	return logs, nil
+}
+
+func (m *memoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryRepository) SchemaVersion(ctx context.Context) (int, error) {
+	return m.schemaVersion, nil
+}
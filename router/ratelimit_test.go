@@ -0,0 +1,76 @@
+package router_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+// checkRateLimited checks a 429 response and its Retry-After header.
+func checkRateLimited(t *testing.T, resp *http.Response, body []byte, window time.Duration) {
+	t.Helper()
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429: %s", resp.StatusCode, body)
+	}
+	if code := errorCode(body); code != lib.CodeRateLimited {
+		t.Errorf("code = %q, want %q", code, lib.CodeRateLimited)
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	if err != nil || seconds < 1 || seconds > int(window.Seconds()) {
+		t.Errorf("Retry-After = %q, want 1 to %d seconds", resp.Header.Get(fiber.HeaderRetryAfter), int(window.Seconds()))
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	const window = time.Minute
+	s := newTestServer(t, func(cfg *lib.Config) {
+		proxies, err := lib.ParseTrustedProxies([]string{"0.0.0.0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// app.Test の接続元は 0.0.0.0 なので、X-Forwarded-For で利用者の IP アドレスを変えられる
+		cfg.TrustedProxies = proxies
+		cfg.RateLimit.User = lib.RateLimit{Requests: 2, Window: window}
+		cfg.RateLimit.Login = lib.RateLimit{Requests: 1, Window: window}
+	})
+	from := func(ip string) credentials { return header(fiber.HeaderXForwardedFor, ip) }
+
+	t.Run("per user", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if resp, body := s.do(t, "GET", "/api/v1/user/me", nil, all(session("player"), from("192.0.2.1"))); resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("request %d = %d: %s", i+1, resp.StatusCode, body)
+			}
+		}
+		// IP アドレスを変えても同じ利用者なら制限される
+		resp, body := s.do(t, "GET", "/api/v1/user/me", nil, all(session("player"), from("192.0.2.2")))
+		checkRateLimited(t, resp, body, window)
+		// API トークンでも同じ利用者として数える
+		resp, body = s.do(t, "GET", "/api/v1/user/me", nil, all(apiToken("player", lib.ScopeGeoRead), from("192.0.2.3")))
+		checkRateLimited(t, resp, body, window)
+
+		// 同じ IP アドレスの別の利用者は制限されない
+		if resp, body := s.do(t, "GET", "/api/v1/user/me", nil, all(session("captain"), from("192.0.2.1"))); resp.StatusCode != fiber.StatusOK {
+			t.Errorf("another user = %d: %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("per IP address", func(t *testing.T) {
+		if resp, body := s.do(t, "GET", "/api/v1/login", nil, from("198.51.100.1")); resp.StatusCode != fiber.StatusFound {
+			t.Fatalf("first login = %d: %s", resp.StatusCode, body)
+		}
+		resp, body := s.do(t, "GET", "/api/v1/login", nil, from("198.51.100.1"))
+		checkRateLimited(t, resp, body, window)
+		// 旧パスも同じカウンタ
+		resp, body = s.do(t, "GET", "/api/login", nil, from("198.51.100.1"))
+		checkRateLimited(t, resp, body, window)
+
+		if resp, body := s.do(t, "GET", "/api/v1/login", nil, from("198.51.100.2")); resp.StatusCode != fiber.StatusFound {
+			t.Errorf("login from another address = %d: %s", resp.StatusCode, body)
+		}
+	})
+}
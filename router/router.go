@@ -0,0 +1,254 @@
+// Package router wires the handlers to their paths and documents every route in the
+// OpenAPI document served at /api/openapi.json.
+package router
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/api"
+	"github.com/m-tsuru/tenchi-geolocation/handler"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+// Register installs the security middleware and mounts all API routes on app, and
+// returns their OpenAPI document. Serve the static files after calling it, so that
+// they get the same headers and the CSRF cookie.
+func Register(app *fiber.App, h *handler.Handler, cfg *lib.Config, limiter *lib.RateLimiter) *api.Document {
+	base := cfg.BasePath
+
+	app.Use(handler.SecurityHeaders(cfg.Security))
+	if cfg.Security.CSRF {
+		// 静的ファイルにも適用して、地図のページを開いた時点で CSRF トークンの Cookie を渡す
+		app.Use(handler.CSRF(cfg.Cookie, base))
+	}
+	if base != "" {
+		app.Use(handler.RedirectToBasePath(base))
+	}
+
+	// ロードバランサや Kubernetes のプローブ、Prometheus 用。API の外に置く
+	app.Get(base+"/healthz", h.Healthz)
+	app.Get(base+"/readyz", h.Readyz)
+	if cfg.Metrics.Enabled {
+		app.Get(base+"/metrics", handler.RequireMetricsToken(cfg.Metrics.Token), handler.Metrics)
+	}
+
+	if len(cfg.Security.CORSOrigins) > 0 {
+		app.Use(base+"/api", handler.CORS(cfg.Security.CORSOrigins))
+	}
+	// プローブとメトリクスは制限しない
+	app.Use(base+"/api", handler.RateLimit(limiter, "ip", cfg.RateLimit.IP))
+	loginLimit := handler.RateLimit(limiter, "login", cfg.RateLimit.Login)
+	profileLimit := handler.RateLimit(limiter, "profile", cfg.RateLimit.Profile)
+
+	doc := api.NewDocument("tenchi-geolocation API", "1.0.0", base+"/api/v1")
+	r := api.NewRouter(app, base+"/api", doc, handler.RequireScope, handler.RequireSession())
+
+	r.Get("/login", api.Operation{
+		ID:      "login",
+		Summary: "Redirect to Google login",
+		Tags:    []string{"auth"},
+		Status:  fiber.StatusFound,
+	}, loginLimit, h.Login)
+
+	r.Get("/callback", api.Operation{
+		ID:      "loginCallback",
+		Summary: "Google OAuth callback; sets the session cookie",
+		Tags:    []string{"auth"},
+		Query: []api.Param{
+			{Name: "code", Type: "string"},
+			{Name: "state", Type: "string"},
+		},
+		Status: fiber.StatusFound,
+	}, loginLimit, h.Callback)
+
+	r.Post("/logout", api.Operation{
+		ID:      "logout",
+		Summary: "Clear the session cookie",
+		Tags:    []string{"auth"},
+	}, h.Logout)
+
+	auth := r.Secured(h.RequireLogin(), handler.RateLimit(limiter, "user", cfg.RateLimit.User))
+
+	auth.Get("/user/me", api.Operation{
+		ID:       "getMe",
+		Summary:  "Get the logged-in user, their contact details and team",
+		Tags:     []string{"users"},
+		Scope:    lib.ScopeGeoRead,
+		Response: api.Me{},
+	}, h.GetMe)
+
+	auth.Patch("/user/me", api.Operation{
+		ID:          "updateMe",
+		Summary:     "Update the logged-in user's profile",
+		Description: "Only the fields that are sent are changed. Send multipart/form-data with an \"avatar\" file to upload an avatar image.",
+		Tags:        []string{"users"},
+		Scope:       lib.ScopeGeoWrite,
+		Request:     api.ProfileUpdateRequest{},
+		RequestContentTypes: []string{
+			fiber.MIMEApplicationJSON,
+			fiber.MIMEMultipartForm,
+		},
+		Response: api.Profile{},
+	}, profileLimit, h.UpdateMe)
+
+	auth.Delete("/user/me", api.Operation{
+		ID:      "deleteMe",
+		Summary: "Delete the logged-in user's account",
+		Tags:    []string{"users"},
+		Session: true,
+		Query: []api.Param{
+			{Name: "purge_locations", Type: "boolean", Description: "Also delete the location history"},
+		},
+		Status: fiber.StatusNoContent,
+	}, h.DeleteMe)
+
+	auth.Get("/user/me/export", api.Operation{
+		ID:       "exportMe",
+		Summary:  "Download all data stored about the logged-in user",
+		Tags:     []string{"users"},
+		Session:  true,
+		Response: api.Export{},
+	}, h.ExportMe)
+
+	auth.Get("/user/me/tokens", api.Operation{
+		ID:       "listAPITokens",
+		Summary:  "List the logged-in user's API tokens",
+		Tags:     []string{"tokens"},
+		Session:  true,
+		Response: []api.APIToken{},
+	}, h.ListAPITokens)
+
+	auth.Post("/user/me/tokens", api.Operation{
+		ID:          "createAPIToken",
+		Summary:     "Issue an API token",
+		Description: "The plain token is only returned in this response.",
+		Tags:        []string{"tokens"},
+		Session:     true,
+		Request:     api.CreateAPITokenRequest{},
+		Response:    api.CreatedAPIToken{},
+		Status:      fiber.StatusCreated,
+	}, h.CreateAPIToken)
+
+	auth.Delete("/user/me/tokens/:id", api.Operation{
+		ID:       "revokeAPIToken",
+		Summary:  "Revoke an API token",
+		Tags:     []string{"tokens"},
+		Session:  true,
+		Response: api.APIToken{},
+	}, h.RevokeAPIToken)
+
+	auth.Get("/user/:id", api.Operation{
+		ID:       "getUser",
+		Summary:  "Get a user and their team",
+		Tags:     []string{"users"},
+		Scope:    lib.ScopeGeoRead,
+		Response: api.UserDetail{},
+	}, h.GetUser)
+
+	auth.Post("/user/me/name", api.Operation{
+		ID:          "changeUserName",
+		Summary:     "Change the logged-in user's name",
+		Description: "Same as PATCH /user/me with user_name.",
+		Tags:        []string{"users"},
+		Scope:       lib.ScopeGeoWrite,
+		Request:     api.UserNameRequest{},
+		Response:    api.User{},
+	}, profileLimit, h.ChangeUserName)
+
+	auth.Get("/avatars/:id", api.Operation{
+		ID:                  "getAvatar",
+		Summary:             "Get a user's avatar image",
+		Tags:                []string{"users"},
+		Scope:               lib.ScopeGeoRead,
+		ResponseContentType: "image/png",
+	}, h.GetAvatar)
+
+	auth.Get("/team/:id", api.Operation{
+		ID:       "getTeam",
+		Summary:  "Get a team and its members",
+		Tags:     []string{"teams"},
+		Scope:    lib.ScopeGeoRead,
+		Response: api.TeamDetail{},
+	}, h.GetTeam)
+
+	auth.Post("/team/:id", api.Operation{
+		ID:          "updateTeam",
+		Summary:     "Update a team's settings",
+		Description: "Only the captain and admins can edit a team. Teams without a captain and the default team can only be edited by admins.",
+		Tags:        []string{"teams"},
+		Scope:       lib.ScopeGeoWrite,
+		Request:     api.TeamUpdateRequest{},
+		Response:    api.Team{},
+	}, profileLimit, h.UpdateTeam)
+
+	auth.Get("/admin/retention/runs", api.Operation{
+		ID:      "listRetentionRuns",
+		Summary: "List recent location retention runs",
+		Tags:    []string{"admin"},
+		Scope:   lib.ScopeAdmin,
+		Query: []api.Param{
+			{Name: "limit", Type: "integer", Description: "Maximum number of runs (default 100)"},
+		},
+		Response: []api.RetentionRun{},
+	}, h.ListRetentionRuns)
+
+	auth.Get("/admin/contacts", api.Operation{
+		ID:          "listContacts",
+		Summary:     "List the players' phone numbers and emergency contacts",
+		Description: "Only for the organizers. Every request is recorded in the audit log as contacts.view.",
+		Tags:        []string{"admin"},
+		Scope:       lib.ScopeAdmin,
+		Query: []api.Param{
+			{Name: "team_id", Type: "integer", Description: "Only the members of this team"},
+		},
+		Response: []api.Profile{},
+	}, h.ListContacts)
+
+	auth.Get("/admin/audit", api.Operation{
+		ID:          "listAuditLogs",
+		Summary:     "List audit log entries, newest first",
+		Description: "Records who changed teams, profiles, accounts and API tokens and who submitted locations. Page with before_id set to the last ID of the previous page.",
+		Tags:        []string{"admin"},
+		Scope:       lib.ScopeAdmin,
+		Query: []api.Param{
+			{Name: "actor_id", Type: "string", Description: "User who performed the action"},
+			{Name: "action", Type: "string", Description: "e.g. team.update, user.update, geolocation.create"},
+			{Name: "target_type", Type: "string", Description: "team, user, geolocation or api_token"},
+			{Name: "target_id", Type: "string"},
+			{Name: "since", Type: "string", Description: "RFC 3339 time (inclusive)"},
+			{Name: "until", Type: "string", Description: "RFC 3339 time (exclusive)"},
+			{Name: "before_id", Type: "integer", Description: "Only entries with a smaller ID"},
+			{Name: "limit", Type: "integer", Description: "Maximum number of entries (default 100, at most 500)"},
+		},
+		Response: []api.AuditLog{},
+	}, h.ListAuditLogs)
+
+	auth.Get("/geo", api.Operation{
+		ID:       "listTeamPositions",
+		Summary:  "Get the latest location of every team",
+		Tags:     []string{"geolocations"},
+		Scope:    lib.ScopeGeoRead,
+		Response: []api.TeamPosition{},
+	}, h.ListTeamPositions)
+
+	auth.Post("/geo", api.Operation{
+		ID:      "addGeolocation",
+		Summary: "Submit the logged-in user's location",
+		Description: fmt.Sprintf("Only accepted within %d minutes before or after every %d minutes from midnight (%s); otherwise outside_submission_window is returned.",
+			int(cfg.Game.SubmissionWindow.Minutes()), int(cfg.Game.SubmissionInterval.Minutes()), cfg.Game.Location),
+		Tags:     []string{"geolocations"},
+		Scope:    lib.ScopeGeoWrite,
+		Request:  api.GeolocationRequest{},
+		Response: api.Geolocation{},
+	}, handler.GeolocationRejections(), handler.RateLimit(limiter, "geo", cfg.RateLimit.Geo), handler.AllowTimingMiddleware(cfg.Game), h.AddGeolocation)
+
+	// ルートをすべて登録してから生成する
+	spec := doc.Spec()
+	app.Get(base+"/api/openapi.json", func(c *fiber.Ctx) error {
+		return c.JSON(spec)
+	})
+
+	return doc
+}
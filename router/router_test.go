@@ -0,0 +1,598 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/m-tsuru/tenchi-geolocation/handler"
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/router"
+	"github.com/m-tsuru/tenchi-geolocation/service"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+const (
+	testSchemaVersion = 7
+	testMetricsToken  = "metrics-token"
+)
+
+// pngHeader is enough of a PNG for the content type to be detected.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+type testServer struct {
+	app     *fiber.App
+	repo    *memoryRepository
+	keys    *lib.JWTKeySet
+	avatars lib.AvatarStore
+}
+
+// newTestServer registers the routes as main does, with the services of the service
+// package on top of an in-memory repository. The fixtures are:
+//
+//	team 1 "鬼"        captain (leader), player
+//	team 2 "逃走"      runner (no leader)
+//	team 9 チーム未設定 admin
+//
+// configure changes the configuration before the routes are registered.
+func newTestServer(t *testing.T, configure ...func(cfg *lib.Config)) *testServer {
+	t.Helper()
+	repo := newMemoryRepository(testSchemaVersion)
+	captainID := "captain"
+	repo.addTeam(structs.Team{ID: 1, Name: "鬼", CaptainID: &captainID})
+	repo.addTeam(structs.Team{ID: 2, Name: "逃走"})
+	repo.addUser("admin", lib.RoleAdmin, "管理者", structs.DefaultTeamID)
+	repo.addUser("captain", lib.RolePlayer, "リーダー", 1)
+	repo.addUser("player", lib.RolePlayer, "プレイヤー", 1)
+	repo.addUser("runner", lib.RolePlayer, "ランナー", 2)
+
+	keys, err := lib.NewJWTKeySet("test", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	avatars := &lib.LocalAvatarStore{Dir: t.TempDir()}
+	if err := avatars.Put(context.Background(), "player", pngHeader, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	positions := service.NewPositionCache(lib.NewMemoryCache(), time.Minute)
+	cfg := &lib.Config{
+		Google: lib.GoogleConfig{ClientID: "client", RedirectURL: "http://localhost/api/v1/callback"},
+		// 1 分ごとに前後 1 分なので、いつでも送信できる
+		Game:    lib.GameConfig{Location: time.UTC, SubmissionInterval: time.Minute, SubmissionWindow: time.Minute},
+		Metrics: lib.MetricsConfig{Enabled: true, Token: testMetricsToken},
+	}
+	for _, f := range configure {
+		f(cfg)
+	}
+	limiter, err := lib.NewRateLimiter(cfg.RateLimit, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repos := repo.repositories()
+	h := handler.New(cfg.OAuth2(), cfg.Cookie, cfg.BasePath, handler.Services{
+		Auth:      service.NewAuthService(repos, keys, avatars, positions),
+		Users:     service.NewUserService(repos, avatars, positions),
+		Tokens:    service.NewTokenService(repos),
+		Teams:     service.NewTeamService(repos, positions),
+		Geo:       service.NewGeoService(repos, &lib.WebhookConfig{}, positions, cfg.Game),
+		Retention: service.NewRetentionService(repos),
+		Health:    service.NewHealthService(repos, testSchemaVersion),
+		Audit:     service.NewAuditService(repos),
+	})
+	app := fiber.New(fiber.Config{ErrorHandler: lib.ErrorHandler})
+	app.Use(handler.RequestLogger(cfg.TrustedProxies))
+	router.Register(app, h, cfg, limiter)
+	return &testServer{app: app, repo: repo, keys: keys, avatars: avatars}
+}
+
+// credentials authenticate a request: a login session, an API token or nothing.
+type credentials func(t *testing.T, s *testServer, req *http.Request)
+
+func session(userID string) credentials {
+	return func(t *testing.T, s *testServer, req *http.Request) {
+		t.Helper()
+		// SignIn と同じく、ログインした時点のロールとチームをクレームに入れる
+		user, err := s.repo.GetUserByID(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		detail, err := s.repo.GetUserDetailByID(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := lib.GenerateJWT(&lib.Identity{UserID: userID, Role: user.Role, TeamID: detail.Team.ID}, s.keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "jwt", Value: *token})
+	}
+}
+
+// staleSession is a login session whose claims are older than lib.JWTRefreshInterval,
+// so they are read from the database again. It claims the admin role, which the
+// server must not trust.
+func staleSession(userID string) credentials {
+	return func(t *testing.T, s *testServer, req *http.Request) {
+		t.Helper()
+		jwt.TimeFunc = func() time.Time { return time.Now().Add(-lib.JWTRefreshInterval) }
+		defer func() { jwt.TimeFunc = time.Now }()
+		token, err := lib.GenerateJWT(&lib.Identity{UserID: userID, Role: lib.RoleAdmin}, s.keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "jwt", Value: *token})
+	}
+}
+
+func apiToken(userID string, scopes ...string) credentials {
+	return func(t *testing.T, s *testServer, req *http.Request) {
+		t.Helper()
+		token, tokenHash, err := lib.GenerateAPIToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.repo.CreateAPIToken(userID, "test", tokenHash, scopes, nil); err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+}
+
+func bearer(token string) credentials {
+	return func(t *testing.T, s *testServer, req *http.Request) {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+}
+
+func (s *testServer) do(t *testing.T, method string, path string, body interface{}, auth credentials) (*http.Response, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if auth != nil {
+		auth(t, s, req)
+	}
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// errorCode returns the code of an error response.
+func errorCode(body []byte) string {
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	return apiErr.Code
+}
+
+type routeTest struct {
+	name   string
+	method string
+	// route is the registered path, for checking that every route is tested
+	route  string
+	path   string
+	auth   credentials
+	body   interface{}
+	status int
+	code   string // 失敗する場合のエラーコード
+	check  func(t *testing.T, resp *http.Response, body []byte)
+}
+
+func jsonContains(want ...string) func(t *testing.T, resp *http.Response, body []byte) {
+	return func(t *testing.T, resp *http.Response, body []byte) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(string(body), w) {
+				t.Errorf("body does not contain %s: %s", w, body)
+			}
+		}
+	}
+}
+
+// routeTests run in order against one server, so later tests see the changes made
+// by earlier ones.
+var routeTests = []routeTest{
+	{
+		name: "login redirects to Google", method: "GET", route: "/login", path: "/login",
+		status: fiber.StatusFound,
+		check: func(t *testing.T, resp *http.Response, body []byte) {
+			if location := resp.Header.Get(fiber.HeaderLocation); !strings.HasPrefix(location, "https://accounts.google.com/") {
+				t.Errorf("Location = %q, want Google", location)
+			}
+		},
+	},
+	{
+		name: "callback without code", method: "GET", route: "/callback", path: "/callback",
+		status: fiber.StatusBadRequest, code: lib.CodeInvalidRequest,
+	},
+	{
+		name: "logout", method: "POST", route: "/logout", path: "/logout",
+		status: fiber.StatusOK,
+	},
+
+	{
+		name: "me without login", method: "GET", route: "/user/me", path: "/user/me",
+		status: fiber.StatusUnauthorized, code: lib.CodeAuthenticationRequired,
+	},
+	{
+		name: "me", method: "GET", route: "/user/me", path: "/user/me", auth: session("player"),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"role":"player"`, `"name":"鬼"`, `"id":"captain"`),
+	},
+	{
+		name: "me with a stale session", method: "GET", route: "/user/me", path: "/user/me", auth: staleSession("player"),
+		status: fiber.StatusOK,
+		check: func(t *testing.T, resp *http.Response, body []byte) {
+			if !strings.Contains(string(body), `"role":"player"`) {
+				t.Errorf("role was not read from the database: %s", body)
+			}
+			if !slices.ContainsFunc(resp.Cookies(), func(c *http.Cookie) bool { return c.Name == "jwt" && c.Value != "" }) {
+				t.Errorf("session cookie was not renewed: %v", resp.Header.Values("Set-Cookie"))
+			}
+		},
+	},
+	{
+		name: "me with a read token", method: "GET", route: "/user/me", path: "/user/me", auth: apiToken("player", lib.ScopeGeoRead),
+		status: fiber.StatusOK,
+	},
+	{
+		name: "me with an unknown token", method: "GET", route: "/user/me", path: "/user/me", auth: bearer("tgeo_unknown"),
+		status: fiber.StatusUnauthorized,
+	},
+	{
+		name: "update profile", method: "PATCH", route: "/user/me", path: "/user/me", auth: session("player"),
+		body:   fiber.Map{"user_name": "プレイヤー2", "phone": "090-1234-5678"},
+		status: fiber.StatusOK,
+		check:  jsonContains(`"user_name":"プレイヤー2"`, `"phone":"090-1234-5678"`),
+	},
+	{
+		name: "update profile with a name used in the team", method: "PATCH", route: "/user/me", path: "/user/me", auth: session("player"),
+		body:   fiber.Map{"user_name": "リーダー"},
+		status: fiber.StatusConflict, code: lib.CodeConflict,
+	},
+	{
+		name: "update profile with a read token", method: "PATCH", route: "/user/me", path: "/user/me", auth: apiToken("player", lib.ScopeGeoRead),
+		body:   fiber.Map{"phone": "090-0000-0000"},
+		status: fiber.StatusForbidden, code: lib.CodeMissingScope,
+	},
+	{
+		name: "change user name", method: "POST", route: "/user/me/name", path: "/user/me/name", auth: session("player"),
+		body:   fiber.Map{"name": "プレイヤー3"},
+		status: fiber.StatusOK,
+		check:  jsonContains(`"user_name":"プレイヤー3"`),
+	},
+	{
+		name: "export", method: "GET", route: "/user/me/export", path: "/user/me/export", auth: session("player"),
+		status: fiber.StatusOK,
+		check: func(t *testing.T, resp *http.Response, body []byte) {
+			if disposition := resp.Header.Get(fiber.HeaderContentDisposition); !strings.Contains(disposition, "attachment") {
+				t.Errorf("Content-Disposition = %q, want an attachment", disposition)
+			}
+		},
+	},
+	{
+		name: "export with a token", method: "GET", route: "/user/me/export", path: "/user/me/export", auth: apiToken("player", lib.ScopeGeoRead),
+		status: fiber.StatusForbidden, code: lib.CodeSessionRequired,
+	},
+	{
+		name: "create token", method: "POST", route: "/user/me/tokens", path: "/user/me/tokens", auth: session("player"),
+		body:   fiber.Map{"name": "bot", "scopes": []string{lib.ScopeGeoRead}},
+		status: fiber.StatusCreated,
+		check:  jsonContains(`"token":"tgeo_`, `"name":"bot"`),
+	},
+	{
+		name: "create token with a scope the user lacks", method: "POST", route: "/user/me/tokens", path: "/user/me/tokens", auth: session("player"),
+		body:   fiber.Map{"name": "bot", "scopes": []string{lib.ScopeAdmin}},
+		status: fiber.StatusForbidden,
+	},
+	{
+		name: "list tokens", method: "GET", route: "/user/me/tokens", path: "/user/me/tokens", auth: session("player"),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"name":"bot"`),
+	},
+	{
+		// トークン 1 は "me with a read token" で作られた player のもの
+		name: "revoke token", method: "DELETE", route: "/user/me/tokens/:id", path: "/user/me/tokens/1", auth: session("player"),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"id":1`, `"revoked_at":"`),
+	},
+	{
+		name: "revoke another user's token", method: "DELETE", route: "/user/me/tokens/:id", path: "/user/me/tokens/1", auth: session("runner"),
+		status: fiber.StatusNotFound, code: lib.CodeNotFound,
+	},
+	{
+		name: "get user", method: "GET", route: "/user/:id", path: "/user/captain", auth: session("runner"),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"user_name":"リーダー"`),
+	},
+	{
+		name: "get unknown user", method: "GET", route: "/user/:id", path: "/user/nobody", auth: session("runner"),
+		status: fiber.StatusNotFound, code: lib.CodeNotFound,
+	},
+	{
+		name: "get avatar", method: "GET", route: "/avatars/:id", path: "/avatars/player", auth: session("runner"),
+		status: fiber.StatusOK,
+		check: func(t *testing.T, resp *http.Response, body []byte) {
+			if contentType := resp.Header.Get(fiber.HeaderContentType); contentType != "image/png" {
+				t.Errorf("Content-Type = %q, want image/png", contentType)
+			}
+		},
+	},
+	{
+		name: "get missing avatar", method: "GET", route: "/avatars/:id", path: "/avatars/runner", auth: session("runner"),
+		status: fiber.StatusNotFound, code: lib.CodeNotFound,
+	},
+	{
+		name: "get team", method: "GET", route: "/team/:id", path: "/team/1", auth: session("runner"),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"name":"鬼"`, `"id":"player"`),
+	},
+	{
+		name: "get unknown team", method: "GET", route: "/team/:id", path: "/team/99", auth: session("runner"),
+		status: fiber.StatusNotFound, code: lib.CodeNotFound,
+	},
+	{
+		name: "captain updates the team", method: "POST", route: "/team/:id", path: "/team/1", auth: session("captain"),
+		body:   fiber.Map{"motto": "全員捕まえる", "color": "#e74c3c"},
+		status: fiber.StatusOK,
+		check:  jsonContains(`"motto":"全員捕まえる"`, `"color":"#e74c3c"`),
+	},
+	{
+		name: "member cannot update the team", method: "POST", route: "/team/:id", path: "/team/1", auth: session("player"),
+		body:   fiber.Map{"motto": "x"},
+		status: fiber.StatusForbidden,
+	},
+	{
+		name: "team without a leader is admin-only", method: "POST", route: "/team/:id", path: "/team/2", auth: session("runner"),
+		body:   fiber.Map{"captain_id": "runner"},
+		status: fiber.StatusForbidden,
+	},
+	{
+		name: "admin appoints a leader", method: "POST", route: "/team/:id", path: "/team/2", auth: session("admin"),
+		body:   fiber.Map{"captain_id": "runner"},
+		status: fiber.StatusOK,
+		check:  jsonContains(`"captain_id":"runner"`),
+	},
+	{
+		name: "add location", method: "POST", route: "/geo", path: "/geo", auth: session("runner"),
+		body:   fiber.Map{"latitude": 34.39, "longitude": 132.45},
+		status: fiber.StatusOK,
+		check:  jsonContains(`"latitude":34.39`, `"user_id":"runner"`),
+	},
+	{
+		name: "add location out of range", method: "POST", route: "/geo", path: "/geo", auth: session("runner"),
+		body:   fiber.Map{"latitude": 91, "longitude": 0},
+		status: fiber.StatusBadRequest, code: lib.CodeValidationFailed,
+	},
+	{
+		name: "add location with a read token", method: "POST", route: "/geo", path: "/geo", auth: apiToken("runner", lib.ScopeGeoRead),
+		body:   fiber.Map{"latitude": 34.39, "longitude": 132.45},
+		status: fiber.StatusForbidden, code: lib.CodeMissingScope,
+	},
+	{
+		name: "team positions", method: "GET", route: "/geo", path: "/geo", auth: apiToken("player", lib.ScopeGeoRead),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"name":"逃走"`, `"latitude":34.39`),
+	},
+	{
+		name: "retention runs", method: "GET", route: "/admin/retention/runs", path: "/admin/retention/runs", auth: session("admin"),
+		status: fiber.StatusOK,
+	},
+	{
+		name: "retention runs as a player", method: "GET", route: "/admin/retention/runs", path: "/admin/retention/runs", auth: session("player"),
+		status: fiber.StatusForbidden, code: lib.CodeMissingScope,
+	},
+	{
+		name: "contacts", method: "GET", route: "/admin/contacts", path: "/admin/contacts?team_id=1", auth: session("admin"),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"phone":"090-1234-5678"`),
+	},
+	{
+		name: "contacts as a player", method: "GET", route: "/admin/contacts", path: "/admin/contacts", auth: session("player"),
+		status: fiber.StatusForbidden, code: lib.CodeMissingScope,
+	},
+	{
+		name: "audit logs", method: "GET", route: "/admin/audit", path: "/admin/audit?action=contacts.view", auth: session("admin"),
+		status: fiber.StatusOK,
+		check:  jsonContains(`"action":"contacts.view"`, `"actor_id":"admin"`),
+	},
+	{
+		name: "audit logs with a bad time", method: "GET", route: "/admin/audit", path: "/admin/audit?since=yesterday", auth: session("admin"),
+		status: fiber.StatusBadRequest, code: lib.CodeValidationFailed,
+	},
+	{
+		name: "delete account with a token", method: "DELETE", route: "/user/me", path: "/user/me", auth: apiToken("runner", lib.ScopeGeoRead, lib.ScopeGeoWrite),
+		status: fiber.StatusForbidden, code: lib.CodeSessionRequired,
+	},
+	{
+		name: "delete account", method: "DELETE", route: "/user/me", path: "/user/me?purge_locations=true", auth: session("runner"),
+		status: fiber.StatusNoContent,
+	},
+	{
+		name: "deleted user's session", method: "GET", route: "/user/me", path: "/user/me", auth: staleSession("runner"),
+		status: fiber.StatusUnauthorized,
+	},
+	{
+		name: "positions after the only member of a team left", method: "GET", route: "/geo", path: "/geo", auth: session("player"),
+		status: fiber.StatusOK,
+		check: func(t *testing.T, resp *http.Response, body []byte) {
+			if strings.Contains(string(body), "逃走") {
+				t.Errorf("deleted user's team is still on the map: %s", body)
+			}
+		},
+	},
+}
+
+func TestRoutes(t *testing.T) {
+	s := newTestServer(t)
+	for _, tt := range routeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := s.do(t, tt.method, "/api/v1"+tt.path, tt.body, tt.auth)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, resp.StatusCode, tt.status, body)
+			}
+			if tt.code != "" {
+				if code := errorCode(body); code != tt.code {
+					t.Errorf("code = %q, want %q", code, tt.code)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, resp, body)
+			}
+		})
+	}
+}
+
+// TestRoutesCovered fails when a route is added without a test in routeTests.
+func TestRoutesCovered(t *testing.T) {
+	s := newTestServer(t)
+	tested := map[string]bool{}
+	for _, tt := range routeTests {
+		tested[tt.method+" /api/v1"+tt.route] = true
+	}
+	for _, route := range s.app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || !strings.HasPrefix(route.Path, "/api/v1/") {
+			continue
+		}
+		if !tested[route.Method+" "+route.Path] {
+			t.Errorf("%s %s has no test in routeTests", route.Method, route.Path)
+		}
+	}
+}
+
+func TestDeprecatedRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.repo.mu.Lock()
+	player := s.repo.profiles["player"]
+	player.AvatarURL = "avatars/player?v=1"
+	s.repo.profiles["player"] = player
+	s.repo.mu.Unlock()
+
+	// 古いパスは /api/v1 より前のレスポンスの形（構造体そのままのキー）を保つ
+	tests := []struct {
+		method, path string
+		body         interface{}
+		want         []string
+		notWant      []string
+	}{
+		{"GET", "/user/me", nil,
+			[]string{`"user_profile":{"ID":"player"`, `"UserName":"プレイヤー"`, `"AvatarURL":"/api/avatars/player?v=1"`, `"team":{"ID":1,`, `"team_members":[`},
+			[]string{`"role"`}},
+		{"GET", "/user/captain", nil, []string{`"UserProfile":{"ID":"captain"`, `"Team":{"ID":1,`}, nil},
+		{"GET", "/team/1", nil, []string{`"Team":{"ID":1,"CreatedAt":`, `"Members":[{"ID":"captain"`}, nil},
+		{"GET", "/geo", nil, []string{`[`}, []string{`"team":`}},
+		{"POST", "/user/me/name", map[string]string{"name": "プレイヤー2"}, []string{`"ID":"player"`, `"UserName":"プレイヤー2"`}, nil},
+		{"PATCH", "/user/me", map[string]string{"phone": "090-1111-2222"}, []string{`"user_profile":{"ID":"player"`, `"contact":{"phone":"090-1111-2222"`}, nil},
+		{"POST", "/user/me/tokens", map[string]interface{}{"name": "bot", "scopes": []string{"geo:read"}}, []string{`"token":"tgeo_`, `"api_token":{"ID":`, `"Scopes":"geo:read"`}, nil},
+		{"GET", "/user/me/tokens", nil, []string{`"Name":"bot"`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			resp, body := s.do(t, tt.method, "/api"+tt.path, tt.body, session("player"))
+			if resp.StatusCode >= 300 {
+				t.Fatalf("%s /api%s = %d: %s", tt.method, tt.path, resp.StatusCode, body)
+			}
+			if resp.Header.Get("Deprecation") != "true" {
+				t.Errorf("Deprecation = %q, want true", resp.Header.Get("Deprecation"))
+			}
+			if link := resp.Header.Get(fiber.HeaderLink); !strings.Contains(link, "</api/v1"+tt.path+">") {
+				t.Errorf("Link = %q, want the /api/v1 path", link)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(body), w) {
+					t.Errorf("body does not contain %s: %s", w, body)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(string(body), w) {
+					t.Errorf("body contains %s: %s", w, body)
+				}
+			}
+		})
+	}
+
+	// /api/v1 は新しい形のまま
+	_, body := s.do(t, "GET", "/api/v1/user/me", nil, session("player"))
+	if !strings.Contains(string(body), `"user_profile":{"id":"player"`) || !strings.Contains(string(body), `"avatar_url":"/api/v1/avatars/player?v=1"`) {
+		t.Errorf("/api/v1/user/me = %s, want the v1 shape", body)
+	}
+}
+
+func TestProbesAndDocuments(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		path   string
+		auth   credentials
+		status int
+		want   string
+	}{
+		{"/healthz", nil, fiber.StatusOK, `"status":"ok"`},
+		{"/readyz", nil, fiber.StatusOK, `"status":"ok"`},
+		{"/metrics", nil, fiber.StatusUnauthorized, ""},
+		{"/metrics", bearer(testMetricsToken), fiber.StatusOK, "# TYPE"},
+		{"/api/openapi.json", nil, fiber.StatusOK, `"openapi":"3.0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, body := s.do(t, "GET", tt.path, nil, tt.auth)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("GET %s = %d, want %d: %s", tt.path, resp.StatusCode, tt.status, body)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("GET %s body does not contain %s: %s", tt.path, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestDeleteAccountRemovesPersonalData(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.avatars.Put(context.Background(), "runner", pngHeader, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := s.do(t, "DELETE", "/api/v1/user/me", nil, session("runner")); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("DELETE /user/me = %d: %s", resp.StatusCode, body)
+	}
+
+	if resp, _ := s.do(t, "GET", "/api/v1/avatars/runner", nil, session("player")); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("avatar of the deleted user = %d, want 404", resp.StatusCode)
+	}
+	logs, err := s.repo.ListAuditLogs(structs.AuditLogFilter{Action: structs.AuditUserDelete, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("user.delete audit logs = %+v, want one", logs)
+	}
+	if entry := logs[0].Before + logs[0].After; strings.Contains(entry, "ランナー") || !strings.Contains(logs[0].Before, `"team_id":2`) {
+		t.Errorf("audit log = %s / %s, want the team ID without the user name", logs[0].Before, logs[0].After)
+	}
+}
@@ -0,0 +1,176 @@
+package router_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+const testCSRFToken = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// all applies several credentials to one request.
+func all(creds ...credentials) credentials {
+	return func(t *testing.T, s *testServer, req *http.Request) {
+		t.Helper()
+		for _, c := range creds {
+			c(t, s, req)
+		}
+	}
+}
+
+func header(key, value string) credentials {
+	return func(t *testing.T, s *testServer, req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// csrfCookie sends the csrf_token cookie that the server set on an earlier response.
+func csrfCookie(token string) credentials {
+	return func(t *testing.T, s *testServer, req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: token})
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t, func(cfg *lib.Config) { cfg.Security.CSRF = true })
+	rename := map[string]string{"name": "プレイヤー2"}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		auth   credentials
+		status int
+	}{
+		{"cookie session without a token", "POST", "/api/v1/user/me/name", rename,
+			session("player"), fiber.StatusForbidden},
+		{"token header without the cookie", "POST", "/api/v1/user/me/name", rename,
+			all(session("player"), header("X-CSRF-Token", testCSRFToken)), fiber.StatusForbidden},
+		{"token that does not match the cookie", "POST", "/api/v1/user/me/name", rename,
+			all(session("player"), csrfCookie(testCSRFToken), header("X-CSRF-Token", strings.Repeat("f", 64))), fiber.StatusForbidden},
+		{"matching token", "POST", "/api/v1/user/me/name", rename,
+			all(session("player"), csrfCookie(testCSRFToken), header("X-CSRF-Token", testCSRFToken)), fiber.StatusOK},
+		{"DELETE is checked too", "DELETE", "/api/v1/user/me/tokens/1", nil,
+			session("player"), fiber.StatusForbidden},
+		// ブラウザが勝手に付けることはないので、Cookie と一緒でも検査しない
+		{"API token", "POST", "/api/v1/geo", map[string]float64{"latitude": 35.0, "longitude": 139.0},
+			all(session("player"), apiToken("player", lib.ScopeGeoWrite)), fiber.StatusOK},
+		{"no session cookie", "POST", "/api/v1/logout", nil, nil, fiber.StatusOK},
+		{"GET is not checked", "GET", "/api/v1/user/me", nil, session("player"), fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := s.do(t, tt.method, tt.path, tt.body, tt.auth)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, resp.StatusCode, tt.status, body)
+			}
+			if tt.status == fiber.StatusForbidden && errorCode(body) != lib.CodeInvalidCSRFToken {
+				t.Errorf("code = %q, want %q", errorCode(body), lib.CodeInvalidCSRFToken)
+			}
+		})
+	}
+
+	t.Run("sets the cookie when it is missing", func(t *testing.T) {
+		resp, _ := s.do(t, "GET", "/healthz", nil, nil)
+		var cookie *http.Cookie
+		for _, c := range resp.Cookies() {
+			if c.Name == "csrf_token" {
+				cookie = c
+			}
+		}
+		if cookie == nil || len(cookie.Value) != 64 || cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+			t.Fatalf("csrf_token cookie = %+v, want a readable SameSite=Strict token", cookie)
+		}
+
+		resp, _ = s.do(t, "GET", "/healthz", nil, csrfCookie(testCSRFToken))
+		for _, c := range resp.Cookies() {
+			if c.Name == "csrf_token" {
+				t.Errorf("replaced a valid csrf_token cookie with %q", c.Value)
+			}
+		}
+	})
+}
+
+func TestCORS(t *testing.T) {
+	const allowed = "https://app.example.com"
+	s := newTestServer(t, func(cfg *lib.Config) { cfg.Security.CORSOrigins = []string{allowed} })
+
+	preflight := func(origin string) credentials {
+		return all(header(fiber.HeaderOrigin, origin), header(fiber.HeaderAccessControlRequestMethod, "POST"),
+			header(fiber.HeaderAccessControlRequestHeaders, "content-type, x-csrf-token"))
+	}
+
+	t.Run("preflight from an allowed origin", func(t *testing.T) {
+		resp, _ := s.do(t, "OPTIONS", "/api/v1/geo", nil, preflight(allowed))
+		if resp.StatusCode != fiber.StatusNoContent {
+			t.Fatalf("status = %d, want 204", resp.StatusCode)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != allowed {
+			t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, allowed)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials); got != "true" {
+			t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowMethods); !strings.Contains(got, "POST") {
+			t.Errorf("Access-Control-Allow-Methods = %q, want POST", got)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowHeaders); !strings.Contains(got, "X-CSRF-Token") {
+			t.Errorf("Access-Control-Allow-Headers = %q, want X-CSRF-Token", got)
+		}
+	})
+
+	t.Run("preflight from another origin", func(t *testing.T) {
+		resp, _ := s.do(t, "OPTIONS", "/api/v1/geo", nil, preflight("https://evil.example.com"))
+		for _, h := range []string{fiber.HeaderAccessControlAllowOrigin, fiber.HeaderAccessControlAllowMethods, fiber.HeaderAccessControlAllowCredentials} {
+			if got := resp.Header.Get(h); got != "" {
+				t.Errorf("%s = %q, want none", h, got)
+			}
+		}
+	})
+
+	t.Run("request from an allowed origin", func(t *testing.T) {
+		resp, _ := s.do(t, "GET", "/api/v1/geo", nil, all(session("player"), header(fiber.HeaderOrigin, allowed)))
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != allowed {
+			t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, allowed)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlExposeHeaders); !strings.Contains(got, fiber.HeaderRetryAfter) {
+			t.Errorf("Access-Control-Expose-Headers = %q, want Retry-After", got)
+		}
+		if got := resp.Header.Get(fiber.HeaderVary); !strings.Contains(got, fiber.HeaderOrigin) {
+			t.Errorf("Vary = %q, want Origin", got)
+		}
+	})
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	const csp = "default-src 'self'"
+	s := newTestServer(t, func(cfg *lib.Config) {
+		cfg.Security.CSP = csp
+		cfg.Security.HSTSMaxAge = 24 * time.Hour
+	})
+
+	resp, _ := s.do(t, "GET", "/healthz", nil, nil)
+	want := map[string]string{
+		fiber.HeaderContentSecurityPolicy:   csp,
+		fiber.HeaderXContentTypeOptions:     "nosniff",
+		fiber.HeaderXFrameOptions:           "DENY",
+		fiber.HeaderStrictTransportSecurity: "",
+	}
+	for h, v := range want {
+		if got := resp.Header.Get(h); got != v {
+			t.Errorf("%s = %q, want %q", h, got, v)
+		}
+	}
+
+	// HSTS は HTTPS のときだけ
+	resp, _ = s.do(t, "GET", "/healthz", nil, header(fiber.HeaderXForwardedProto, "https"))
+	if got := resp.Header.Get(fiber.HeaderStrictTransportSecurity); got != "max-age=86400; includeSubDomains" {
+		t.Errorf("Strict-Transport-Security over HTTPS = %q", got)
+	}
+}
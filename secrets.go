@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/ini.v1"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+const secretsUsage = `usage: tenchi-geolocation secrets <command>
+
+commands:
+  keygen              print a new key for ` + lib.SecretsKeyEnv + `
+  seal <plain> <out>  encrypt an INI file with the same sections as .env
+  open <file>         print the decrypted content of a secrets file`
+
+// runSecrets implements the "secrets" subcommand. The key is read from
+// TENCHI_SECRETS_KEY so that it never appears in the process list.
+func runSecrets(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", secretsUsage)
+	}
+	switch {
+	case args[0] == "keygen" && len(args) == 1:
+		key, err := lib.GenerateSecretsKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+	case args[0] == "seal" && len(args) == 3:
+		key, err := lib.SecretsKeyFromEnv()
+		if err != nil {
+			return err
+		}
+		plaintext, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		// 起動時に読めないファイルを暗号化しないよう、先に INI として解釈できるか確かめる
+		if _, err := ini.Load(plaintext); err != nil {
+			return fmt.Errorf("%s is not a valid INI file: %w", args[1], err)
+		}
+		sealed, err := lib.SealSecrets(key, plaintext)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[2], sealed, 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s; delete %s once it is no longer needed\n", args[2], args[1])
+	case args[0] == "open" && len(args) == 2:
+		key, err := lib.SecretsKeyFromEnv()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		plaintext, err := lib.OpenSecrets(key, data)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(plaintext)
+	default:
+		return fmt.Errorf("%s", secretsUsage)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+const seedUsage = `usage: tenchi-geolocation seed <fixture.yaml|fixture.json>`
+
+// runSeed implements the "seed" subcommand. It loads teams, users, games and
+// locations from a fixture file; the server itself never writes test data.
+func runSeed(db *gorm.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%s", seedUsage)
+	}
+	fixture, err := loadFixture(args[0])
+	if err != nil {
+		return err
+	}
+	if err := validateFixture(fixture); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	dbInstance := &structs.Database{DB: db}
+	result, err := dbInstance.Seed(fixture)
+	if err != nil {
+		return fmt.Errorf("failed to seed: %w", err)
+	}
+	fmt.Printf("seeded %d games, %d teams, %d users, %d geolocations\n",
+		result.Games, result.Teams, result.Users, result.Geolocations)
+	return nil
+}
+
+func loadFixture(path string) (*structs.Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture structs.Fixture
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &fixture)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &fixture)
+	default:
+		return nil, fmt.Errorf("fixture must be a .yaml, .yml or .json file: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// validateFixture applies the same rules as the API and normalizes the values in place.
+func validateFixture(fixture *structs.Fixture) error {
+	for i := range fixture.Games {
+		g := &fixture.Games[i]
+		if g.ID <= 0 || g.Name == "" {
+			return fmt.Errorf("games[%d]: id and name are required", i)
+		}
+		switch g.RetentionMode {
+		case "", structs.RetentionModePurge, structs.RetentionModeCoarsen:
+		default:
+			return fmt.Errorf("games[%d]: unknown retention_mode %q", i, g.RetentionMode)
+		}
+	}
+	for i := range fixture.Teams {
+		t := &fixture.Teams[i]
+		if t.ID <= 0 {
+			return fmt.Errorf("teams[%d]: id is required", i)
+		}
+		var err error
+		if t.Name, err = lib.NormalizeTeamName(t.Name); err != nil {
+			return fmt.Errorf("teams[%d]: %w", i, err)
+		}
+		if t.Color, err = lib.NormalizeTeamColor(t.Color); err != nil {
+			return fmt.Errorf("teams[%d]: %w", i, err)
+		}
+		if t.Icon, err = lib.NormalizeTeamIcon(t.Icon); err != nil {
+			return fmt.Errorf("teams[%d]: %w", i, err)
+		}
+		if t.Motto, err = lib.NormalizeTeamMotto(t.Motto); err != nil {
+			return fmt.Errorf("teams[%d]: %w", i, err)
+		}
+	}
+	for i := range fixture.Users {
+		u := &fixture.Users[i]
+		if u.ID == "" {
+			return fmt.Errorf("users[%d]: id is required", i)
+		}
+		switch u.Role {
+		case "", lib.RolePlayer, lib.RoleAdmin:
+		default:
+			return fmt.Errorf("users[%d]: unknown role %q", i, u.Role)
+		}
+		var err error
+		if u.UserName != "" {
+			if u.UserName, err = lib.NormalizeUserName(u.UserName); err != nil {
+				return fmt.Errorf("users[%d]: %w", i, err)
+			}
+		}
+		if u.Phone, err = lib.NormalizePhone(u.Phone); err != nil {
+			return fmt.Errorf("users[%d]: %w", i, err)
+		}
+		if u.EmergencyContact, err = lib.NormalizeEmergencyContact(u.EmergencyContact); err != nil {
+			return fmt.Errorf("users[%d]: %w", i, err)
+		}
+	}
+	for i, g := range fixture.Geolocations {
+		if g.UserID == "" {
+			return fmt.Errorf("geolocations[%d]: user_id is required", i)
+		}
+		if g.Latitude < -90 || g.Latitude > 90 || g.Longitude < -180 || g.Longitude > 180 {
+			return fmt.Errorf("geolocations[%d]: coordinates are out of range", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/migrations"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func migratedSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := lib.OpenDatabase(&lib.DatabaseConfig{
+		Driver: lib.DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "test.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func count(t *testing.T, db *gorm.DB, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRunSeedExample(t *testing.T) {
+	const path = "fixtures/example.yaml"
+	fixture, err := loadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := migratedSQLite(t)
+
+	// 2 回投入しても重複しない
+	for range 2 {
+		if err := runSeed(db, []string{path}); err != nil {
+			t.Fatalf("runSeed() error = %v", err)
+		}
+	}
+
+	if n := count(t, db, &structs.Game{}); n != int64(len(fixture.Games)) {
+		t.Errorf("games = %d, want %d", n, len(fixture.Games))
+	}
+	// チーム未設定は 0002_default_team が作る
+	if n := count(t, db, &structs.Team{}); n != int64(len(fixture.Teams)+1) {
+		t.Errorf("teams = %d, want %d and the default team", n, len(fixture.Teams))
+	}
+	if n := count(t, db, &structs.User{}); n != int64(len(fixture.Users)) {
+		t.Errorf("users = %d, want %d", n, len(fixture.Users))
+	}
+	if n := count(t, db, &structs.Geolocation{}); n != int64(len(fixture.Geolocations)) {
+		t.Errorf("geolocations = %d, want %d", n, len(fixture.Geolocations))
+	}
+
+	database := &structs.Database{DB: db}
+	team, err := database.GetTeamByID("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.CaptainID == nil || *team.CaptainID != "dev-oni-1" {
+		t.Errorf("captain of team 1 = %v, want dev-oni-1", team.CaptainID)
+	}
+	admin, err := database.GetUserDetailByID("dev-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Team.ID != structs.DefaultTeamID || admin.UserProfile.UserName != "運営" {
+		t.Errorf("dev-admin = %+v, want 運営 in the default team", admin.UserProfile)
+	}
+	user, err := database.GetUserByID("dev-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != lib.RoleAdmin {
+		t.Errorf("dev-admin role = %q, want admin", user.Role)
+	}
+}
+
+func TestValidateFixture(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture structs.Fixture
+		want    string // エラーに含まれる文字列。空なら成功
+	}{
+		{"empty", structs.Fixture{}, ""},
+		{"game without name", structs.Fixture{Games: []structs.GameFixture{{ID: 1}}}, "games[0]"},
+		{"unknown retention mode", structs.Fixture{Games: []structs.GameFixture{{ID: 1, Name: "g", RetentionMode: "shred"}}}, "retention_mode"},
+		{"team without id", structs.Fixture{Teams: []structs.TeamFixture{{Name: "赤組"}}}, "teams[0]"},
+		{"bad team color", structs.Fixture{Teams: []structs.TeamFixture{{ID: 1, Name: "赤組", Color: "red"}}}, "teams[0]"},
+		{"user without id", structs.Fixture{Users: []structs.UserFixture{{UserName: "x"}}}, "users[0]"},
+		{"unknown role", structs.Fixture{Users: []structs.UserFixture{{ID: "u", Role: "root"}}}, "role"},
+		{"location out of range", structs.Fixture{Geolocations: []structs.GeolocationFixture{{UserID: "u", Latitude: 91}}}, "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFixture(&tt.fixture)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("validateFixture() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validateFixture() = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSeedRejectsUnknownFormat(t *testing.T) {
+	db := migratedSQLite(t)
+	if err := runSeed(db, []string{"fixtures/example.toml"}); err == nil {
+		t.Error("runSeed() with a .toml file succeeded")
+	}
+	if n := count(t, db, &structs.User{}); n != 0 {
+		t.Errorf("users = %d after a failed seed, want 0", n)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// maxAuditLogs bounds one page of GET /admin/audit.
+const maxAuditLogs = 500
+
+type AuditService struct {
+	audit repository.AuditRepository
+}
+
+func NewAuditService(repos *repository.Repositories) *AuditService {
+	return &AuditService{audit: repos.Audit}
+}
+
+func (s *AuditService) List(filter structs.AuditLogFilter) ([]structs.AuditLog, error) {
+	if filter.Limit <= 0 || filter.Limit > maxAuditLogs {
+		filter.Limit = maxAuditLogs
+	}
+	logs, err := s.audit.ListAuditLogs(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit logs: %w", err)
+	}
+	return logs, nil
+}
+
+// auditChanges holds the changed fields of a record, before or after the change.
+type auditChanges map[string]interface{}
+
+// recordAudit appends an entry for an action that has already been done. The actor,
+// IP address and request ID come from the request context. A failure is logged but
+// does not undo the action.
+func recordAudit(ctx context.Context, audit repository.AuditRepository, action string, targetType string, targetID string, before auditChanges, after auditChanges) {
+	entry := &structs.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     encodeAuditChanges(before),
+		After:      encodeAuditChanges(after),
+	}
+	if identity := lib.IdentityFromContext(ctx); identity != nil {
+		entry.ActorID = identity.UserID
+	}
+	entry.IP, _ = ctx.Value(lib.LocalClientIP).(string)
+	entry.RequestID, _ = ctx.Value(lib.LocalRequestID).(string)
+	if err := audit.AddAuditLog(entry); err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit log", "action", action, "target_id", targetID, "error", err)
+	}
+}
+
+func encodeAuditChanges(changes auditChanges) string {
+	if len(changes) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,145 @@
+// Package service holds the application logic behind the HTTP handlers. Services
+// only depend on the repository interfaces and return *lib.APIError for errors the
+// client should see.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+)
+
+const (
+	AuthMethodSession = "session"
+	AuthMethodToken   = "token"
+)
+
+type AuthService struct {
+	users     repository.UserRepository
+	tokens    repository.APITokenRepository
+	jwtKeys   *lib.JWTKeySet
+	avatars   lib.AvatarStore
+	positions *PositionCache
+}
+
+func NewAuthService(repos *repository.Repositories, jwtKeys *lib.JWTKeySet, avatars lib.AvatarStore, positions *PositionCache) *AuthService {
+	return &AuthService{
+		users:     repos.Users,
+		tokens:    repos.APITokens,
+		jwtKeys:   jwtKeys,
+		avatars:   avatars,
+		positions: positions,
+	}
+}
+
+// SignIn creates the user on first login, refreshes their Google avatar and issues a
+// session JWT.
+func (s *AuthService) SignIn(ctx context.Context, userID string, email string, picture string) (string, error) {
+	exists, err := s.users.CheckUserExistsByID(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	if !exists {
+		if _, err := s.users.CreateUser(userID, email, picture); err != nil {
+			return "", fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+	if err := lib.SyncGoogleAvatar(ctx, s.users, s.avatars, userID, picture); err != nil {
+		slog.WarnContext(ctx, "Failed to cache Google avatar", "user_id", userID, "error", err)
+	}
+	// 新しいメンバーやアバターの変更を地図に反映する
+	s.positions.Invalidate(ctx)
+
+	identity, err := s.loadIdentity(userID, AuthMethodSession)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user detail: %w", err)
+	}
+	token, err := lib.GenerateJWT(identity, s.jwtKeys)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate JWT: %w", err)
+	}
+	slog.InfoContext(ctx, "User signed in", "user_id", userID, "email", email, "new_user", !exists)
+	return *token, nil
+}
+
+// AuthenticateToken resolves an API token sent as "Authorization: Bearer".
+func (s *AuthService) AuthenticateToken(bearer string) (*lib.Identity, error) {
+	token, err := s.tokens.GetActiveAPITokenByHash(lib.HashAPIToken(bearer))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, lib.NewAPIError(fiber.StatusUnauthorized, lib.CodeInvalidToken, "API token is invalid")
+		}
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	identity, err := s.loadIdentity(token.UserID, AuthMethodToken)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, lib.NewAPIError(fiber.StatusUnauthorized, lib.CodeInvalidToken, "API token is invalid")
+		}
+		return nil, fmt.Errorf("failed to get user detail: %w", err)
+	}
+	// 発行後に権限を外されたユーザのトークンが、そのスコープを使い続けないようにする
+	identity.Scopes = lib.TokenScopes(lib.ParseScopes(token.Scopes), identity.Role)
+	if err := s.tokens.TouchAPIToken(token.ID); err != nil {
+		slog.Warn("Failed to update API token usage", "token_id", token.ID, "error", err)
+	}
+	return identity, nil
+}
+
+// AuthenticateSession resolves the session JWT from the cookie. The claims are trusted
+// for lib.JWTRefreshInterval after they were issued. Older claims are read from the
+// database again, and the renewed token is returned to be set as the cookie (otherwise
+// renewed is empty).
+func (s *AuthService) AuthenticateSession(jwtToken string) (identity *lib.Identity, renewed string, err error) {
+	claims, err := lib.ParseJWT(jwtToken, s.jwtKeys)
+	if err != nil {
+		return nil, "", lib.NewAPIError(fiber.StatusUnauthorized, lib.CodeInvalidToken, "JWT token is invalid or expired").WithErr(err)
+	}
+	if !claims.Stale() {
+		return claims.Identity(AuthMethodSession), "", nil
+	}
+
+	// 退会・降格したユーザのセッションを JWT の期限まで使わせないよう、古いクレームは DB で確かめる
+	identity, err = s.loadIdentity(claims.UserID, AuthMethodSession)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", lib.NewAPIError(fiber.StatusUnauthorized, lib.CodeInvalidToken, "JWT token is invalid")
+		}
+		return nil, "", fmt.Errorf("failed to get user detail: %w", err)
+	}
+	token, err := lib.RenewJWT(identity, claims, s.jwtKeys)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to renew JWT: %w", err)
+	}
+	return identity, *token, nil
+}
+
+// loadIdentity builds the caller's identity from the database. Deleted users are not found.
+func (s *AuthService) loadIdentity(userID string, authMethod string) (*lib.Identity, error) {
+	user, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	userDetail, err := s.users.GetUserDetailByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	identity := &lib.Identity{
+		UserID:     user.ID,
+		Role:       user.Role,
+		TeamID:     userDetail.Team.ID,
+		Scopes:     lib.ScopesForRole(user.Role),
+		AuthMethod: authMethod,
+	}
+	if userDetail.Team.GameID != nil {
+		identity.GameID = *userDetail.Team.GameID
+	}
+	return identity, nil
+}
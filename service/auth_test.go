@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// stubUsers answers the lookups AuthService makes. Other methods panic.
+type stubUsers struct {
+	repository.UserRepository
+	users map[string]structs.User
+}
+
+func (s *stubUsers) GetUserByID(userID string) (*structs.User, error) {
+	user, ok := s.users[userID]
+	if !ok || !user.IsExist {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (s *stubUsers) GetUserDetailByID(userID string) (*structs.UserDetail, error) {
+	if _, err := s.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	return &structs.UserDetail{
+		UserProfile: structs.UserProfile{ID: userID},
+		Team:        structs.Team{ID: 2},
+	}, nil
+}
+
+type stubTokens struct {
+	repository.APITokenRepository
+	tokens map[string]structs.APIToken // key は平文のトークン
+}
+
+func (s *stubTokens) GetActiveAPITokenByHash(tokenHash string) (*structs.APIToken, error) {
+	for token, apiToken := range s.tokens {
+		if lib.HashAPIToken(token) == tokenHash {
+			return &apiToken, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (s *stubTokens) TouchAPIToken(tokenID int) error {
+	return nil
+}
+
+func TestAuthenticateTokenScopes(t *testing.T) {
+	users := &stubUsers{users: map[string]structs.User{
+		"admin":   {ID: "admin", Role: lib.RoleAdmin, IsExist: true},
+		"demoted": {ID: "demoted", Role: lib.RolePlayer, IsExist: true},
+	}}
+	tokens := &stubTokens{tokens: map[string]structs.APIToken{
+		"tgeo_admin":   {ID: 1, UserID: "admin", Scopes: "geo:read,admin"},
+		"tgeo_demoted": {ID: 2, UserID: "demoted", Scopes: "geo:read,geo:write,admin"},
+		"tgeo_read":    {ID: 3, UserID: "demoted", Scopes: "geo:read"},
+	}}
+	s := &AuthService{users: users, tokens: tokens}
+
+	tests := []struct {
+		token string
+		want  []string
+	}{
+		{"tgeo_admin", []string{lib.ScopeGeoRead, lib.ScopeAdmin}},
+		// admin を外されたユーザのトークンからは admin スコープが消える
+		{"tgeo_demoted", []string{lib.ScopeGeoRead, lib.ScopeGeoWrite}},
+		{"tgeo_read", []string{lib.ScopeGeoRead}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			identity, err := s.AuthenticateToken(tt.token)
+			if err != nil {
+				t.Fatalf("AuthenticateToken() error = %v", err)
+			}
+			if !slices.Equal(identity.Scopes, tt.want) {
+				t.Errorf("Scopes = %v, want %v", identity.Scopes, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateSession(t *testing.T) {
+	keys, err := lib.NewJWTKeySet("test", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &stubUsers{users: map[string]structs.User{
+		"demoted": {ID: "demoted", Role: lib.RolePlayer, IsExist: true},
+		"deleted": {ID: "deleted", Role: lib.RolePlayer, IsExist: false},
+	}}
+	s := &AuthService{users: users, jwtKeys: keys}
+	login := time.Now().Add(-time.Hour)
+	// どちらもログインした時点では管理者だった
+	session := func(userID string, issuedAt time.Time) string {
+		t.Helper()
+		jwt.TimeFunc = func() time.Time { return issuedAt }
+		defer func() { jwt.TimeFunc = time.Now }()
+		token, err := lib.GenerateJWT(&lib.Identity{UserID: userID, Role: lib.RoleAdmin, TeamID: 1}, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *token
+	}
+
+	t.Run("fresh claims are trusted", func(t *testing.T) {
+		identity, renewed, err := s.AuthenticateSession(session("deleted", time.Now()))
+		if err != nil {
+			t.Fatalf("AuthenticateSession() error = %v", err)
+		}
+		if identity.Role != lib.RoleAdmin || identity.TeamID != 1 || !lib.HasScope(identity.Scopes, lib.ScopeAdmin) || renewed != "" {
+			t.Errorf("identity = %+v, renewed = %q, want the claims without a renewal", identity, renewed)
+		}
+	})
+
+	t.Run("stale claims are read again", func(t *testing.T) {
+		identity, renewed, err := s.AuthenticateSession(session("demoted", login))
+		if err != nil {
+			t.Fatalf("AuthenticateSession() error = %v", err)
+		}
+		if identity.Role != lib.RolePlayer || lib.HasScope(identity.Scopes, lib.ScopeAdmin) || identity.TeamID != 2 {
+			t.Errorf("identity = %+v, want a player of team 2 from the database", identity)
+		}
+		claims, err := lib.ParseJWT(renewed, keys)
+		if err != nil {
+			t.Fatalf("renewed token: %v", err)
+		}
+		if claims.Role != lib.RolePlayer || claims.Stale() {
+			t.Errorf("renewed claims = %+v, want fresh player claims", claims)
+		}
+		// セッションはログインから jwtLifetime で終わる
+		if want := login.Add(24 * time.Hour).Unix(); claims.ExpiresAt.Unix() != want {
+			t.Errorf("renewed token expires at %v, want %v", claims.ExpiresAt.Time, time.Unix(want, 0))
+		}
+	})
+
+	t.Run("stale claims of a deleted user", func(t *testing.T) {
+		_, _, err := s.AuthenticateSession(session("deleted", login))
+		var apiErr *lib.APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != fiber.StatusUnauthorized {
+			t.Errorf("AuthenticateSession() error = %v, want 401", err)
+		}
+	})
+}
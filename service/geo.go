@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// Notifier announces new locations, e.g. to a Discord webhook (*lib.WebhookConfig).
+type Notifier interface {
+	Notify(userDetail *structs.UserDetail, location *structs.Geolocation) error
+}
+
+type GeoService struct {
+	geo       repository.GeoRepository
+	users     repository.UserRepository
+	audit     repository.AuditRepository
+	notifier  Notifier
+	positions *PositionCache
+	game      lib.GameConfig
+}
+
+func NewGeoService(repos *repository.Repositories, notifier Notifier, positions *PositionCache, game lib.GameConfig) *GeoService {
+	return &GeoService{
+		geo:       repos.Geo,
+		users:     repos.Users,
+		audit:     repos.Audit,
+		notifier:  notifier,
+		positions: positions,
+		game:      game,
+	}
+}
+
+func (s *GeoService) Latest(ctx context.Context) ([]structs.GeolocationDetail, error) {
+	return s.positions.Get(ctx, func() ([]structs.GeolocationDetail, error) {
+		geolocationDetails, err := s.geo.GetGeolocationLatestAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get geolocation details: %w", err)
+		}
+		return *geolocationDetails, nil
+	})
+}
+
+// GeolocationInput is an unvalidated location submission. Both coordinates are required.
+type GeolocationInput struct {
+	Latitude  *float64
+	Longitude *float64
+}
+
+func (in GeolocationInput) validate() error {
+	if err := validateCoordinate(in.Latitude, 90); err != nil {
+		return lib.ValidationError("latitude", err)
+	}
+	if err := validateCoordinate(in.Longitude, 180); err != nil {
+		return lib.ValidationError("longitude", err)
+	}
+	return nil
+}
+
+func validateCoordinate(value *float64, limit float64) error {
+	switch {
+	case value == nil:
+		return errors.New("is required")
+	case math.IsNaN(*value) || math.IsInf(*value, 0):
+		return errors.New("must be a finite number")
+	case *value < -limit || *value > limit:
+		return fmt.Errorf("must be between %g and %g", -limit, limit)
+	}
+	return nil
+}
+
+func (s *GeoService) Add(ctx context.Context, userID string, input GeolocationInput) (*structs.Geolocation, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+	// 退会済みユーザの位置情報を登録しないよう、先にユーザを確認する
+	ud, err := s.users.GetUserDetailByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user detail: %w", err)
+	}
+	geolocation, err := s.geo.AddGeolocation(userID, ud.Team.GameID, *input.Latitude, *input.Longitude)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add geolocation: %w", err)
+	}
+	s.positions.Record(ctx, ud.Team.ID, geolocation)
+	slog.InfoContext(ctx, "Geolocation submitted", "geolocation_id", geolocation.ID,
+		"latitude", geolocation.Latitude, "longitude", geolocation.Longitude)
+	// 座標は保持期間の処理で消えるので、監査ログには残さない
+	recordAudit(ctx, s.audit, structs.AuditGeolocationCreate, "geolocation", strconv.Itoa(geolocation.ID),
+		nil, auditChanges{"team_id": ud.Team.ID})
+	lib.GeolocationSubmissions.Inc(strconv.Itoa(ud.Team.ID), s.game.SubmissionSlot(geolocation.CreatedAt))
+
+	if err := s.notifier.Notify(ud, geolocation); err != nil {
+		slog.WarnContext(ctx, "Failed to notify geolocation update", "error", err)
+	}
+	return geolocation, nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestGeolocationInputValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input GeolocationInput
+		field string
+	}{
+		{"valid", GeolocationInput{float(35.6812), float(139.7671)}, ""},
+		{"zero", GeolocationInput{float(0), float(0)}, ""},
+		{"bounds", GeolocationInput{float(-90), float(180)}, ""},
+		{"empty", GeolocationInput{}, "latitude"},
+		{"missing longitude", GeolocationInput{Latitude: float(35)}, "longitude"},
+		{"latitude too large", GeolocationInput{float(90.0001), float(0)}, "latitude"},
+		{"latitude too small", GeolocationInput{float(-91), float(0)}, "latitude"},
+		{"longitude out of range", GeolocationInput{float(0), float(-180.5)}, "longitude"},
+		{"NaN", GeolocationInput{float(math.NaN()), float(0)}, "latitude"},
+		{"infinity", GeolocationInput{float(0), float(math.Inf(1))}, "longitude"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			var apiErr *lib.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("validate() = %v, want *lib.APIError", err)
+			}
+			if apiErr.Code != lib.CodeValidationFailed {
+				t.Errorf("code = %q, want %q", apiErr.Code, lib.CodeValidationFailed)
+			}
+			if field := apiErr.Details.(fiber.Map)["field"]; field != tt.field {
+				t.Errorf("field = %v, want %q", field, tt.field)
+			}
+		})
+	}
+}
+
+func TestGeoServiceAddRejectsBeforeLookup(t *testing.T) {
+	// リポジトリは nil なので、検証より先に触ると panic する
+	s := &GeoService{}
+	_, err := s.Add(context.Background(), "user", GeolocationInput{Latitude: float(100), Longitude: float(0)})
+	var apiErr *lib.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != lib.CodeValidationFailed {
+		t.Fatalf("Add() = %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+)
+
+// readyTimeout bounds each readiness probe so that a hung database fails the probe
+// instead of piling up requests.
+const readyTimeout = 2 * time.Second
+
+// HealthService answers the liveness (/healthz) and readiness (/readyz) probes.
+type HealthService struct {
+	health repository.HealthRepository
+	// latestMigration は起動時に読み込んだマイグレーションの最新バージョン
+	latestMigration int
+	draining        atomic.Bool
+}
+
+// HealthCheck is the result of one readiness check. Err is safe to show to clients;
+// the underlying cause is only logged.
+type HealthCheck struct {
+	Name string
+	Err  error
+}
+
+// NewHealthService takes the newest migration this build knows about, which is loaded
+// once at startup; the probes only read the applied version.
+func NewHealthService(repos *repository.Repositories, latestMigration int) *HealthService {
+	return &HealthService{health: repos.Health, latestMigration: latestMigration}
+}
+
+// Drain makes the instance report itself as not ready, so that load balancers stop
+// sending it new requests before it shuts down.
+func (s *HealthService) Drain() {
+	s.draining.Store(true)
+}
+
+// Ready runs every readiness check. The instance is ready when none of them failed.
+func (s *HealthService) Ready(ctx context.Context) []HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	checks := []HealthCheck{{Name: "shutdown"}}
+	if s.draining.Load() {
+		checks[0].Err = errors.New("shutting down")
+	}
+
+	database := HealthCheck{Name: "database"}
+	if err := s.health.Ping(ctx); err != nil {
+		slog.WarnContext(ctx, "Readiness check failed", "check", "database", "error", err)
+		database.Err = errors.New("unreachable")
+	}
+	checks = append(checks, database)
+
+	// データベースに届かなければマイグレーションも確かめられない
+	schema := HealthCheck{Name: "migrations"}
+	if database.Err != nil {
+		schema.Err = errors.New("unknown")
+	} else {
+		schema.Err = s.checkMigrations(ctx)
+	}
+	return append(checks, schema)
+}
+
+func (s *HealthService) checkMigrations(ctx context.Context) error {
+	version, err := s.health.SchemaVersion(ctx)
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "Readiness check failed", "check", "migrations", "error", err)
+		return errors.New("unavailable")
+	case version > s.latestMigration:
+		return fmt.Errorf("database schema is newer than this build supports (database: %d, supported: %d)", version, s.latestMigration)
+	case version < s.latestMigration:
+		return fmt.Errorf("%d pending migrations", s.latestMigration-version)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type stubHealth struct {
+	pingErr error
+	version int
+}
+
+func (s *stubHealth) Ping(ctx context.Context) error {
+	return s.pingErr
+}
+
+func (s *stubHealth) SchemaVersion(ctx context.Context) (int, error) {
+	return s.version, nil
+}
+
+func TestHealthServiceReady(t *testing.T) {
+	tests := []struct {
+		name   string
+		health stubHealth
+		failed map[string]string
+	}{
+		{"ready", stubHealth{version: 6}, map[string]string{}},
+		{"pending", stubHealth{version: 4}, map[string]string{"migrations": "2 pending migrations"}},
+		{"too new", stubHealth{version: 7}, map[string]string{"migrations": "database schema is newer than this build supports (database: 7, supported: 6)"}},
+		{"unreachable", stubHealth{pingErr: errors.New("connection refused")}, map[string]string{"database": "unreachable", "migrations": "unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &HealthService{health: &tt.health, latestMigration: 6}
+			for _, check := range s.Ready(context.Background()) {
+				want, shouldFail := tt.failed[check.Name]
+				switch {
+				case shouldFail && (check.Err == nil || check.Err.Error() != want):
+					t.Errorf("%s: error = %v, want %q", check.Name, check.Err, want)
+				case !shouldFail && check.Err != nil:
+					t.Errorf("%s: error = %v, want ok", check.Name, check.Err)
+				}
+			}
+		})
+	}
+}
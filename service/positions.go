@@ -0,0 +1,145 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+const (
+	positionsGenerationKey = "tenchi-geolocation:positions:generation"
+	positionsKeyPrefix     = "tenchi-geolocation:positions:"
+)
+
+// PositionCache keeps the latest position of every team (GET /geo) out of the database.
+//
+// The view is stored under a key that includes a generation number. Changes to teams
+// or members increment the generation, so a view loaded before the change can never be
+// read afterwards even if it is written late. A new location is applied to the previous
+// view instead of discarding it. The TTL bounds how long changes made outside the
+// server (seed, manual edits) stay invisible.
+//
+// A nil *PositionCache always reads from the database.
+type PositionCache struct {
+	store lib.CacheStore
+	ttl   time.Duration
+}
+
+func NewPositionCache(store lib.CacheStore, ttl time.Duration) *PositionCache {
+	if store == nil {
+		return nil
+	}
+	return &PositionCache{store: store, ttl: ttl}
+}
+
+// Get returns the cached view or stores the result of load. Cache failures are logged
+// and fall back to load.
+func (p *PositionCache) Get(ctx context.Context, load func() ([]structs.GeolocationDetail, error)) ([]structs.GeolocationDetail, error) {
+	if p == nil {
+		return load()
+	}
+	generation, err := p.generation(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read position cache", "error", err)
+		return load()
+	}
+	if details, err := p.read(ctx, generation); err == nil {
+		return details, nil
+	} else if !errors.Is(err, lib.ErrCacheMiss) {
+		slog.WarnContext(ctx, "Failed to read position cache", "error", err)
+	}
+
+	details, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.write(ctx, generation, details); err != nil {
+		slog.WarnContext(ctx, "Failed to write position cache", "error", err)
+	}
+	return details, nil
+}
+
+// Invalidate discards the view after a change to teams or their members.
+func (p *PositionCache) Invalidate(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	if _, err := p.store.Incr(ctx, positionsGenerationKey); err != nil {
+		slog.WarnContext(ctx, "Failed to invalidate position cache", "error", err)
+	}
+}
+
+// Record applies a new location of a member of teamID to the cached view.
+func (p *PositionCache) Record(ctx context.Context, teamID int, geolocation *structs.Geolocation) {
+	if p == nil {
+		return
+	}
+	generation, err := p.store.Incr(ctx, positionsGenerationKey)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to invalidate position cache", "error", err)
+		return
+	}
+	details, err := p.read(ctx, generation-1)
+	if err != nil {
+		if !errors.Is(err, lib.ErrCacheMiss) {
+			slog.WarnContext(ctx, "Failed to read position cache", "error", err)
+		}
+		return
+	}
+	for i := range details {
+		if details[i].TeamDetail.Team.ID != teamID {
+			continue
+		}
+		if geolocation.CreatedAt.Before(details[i].Geolocation.CreatedAt) {
+			return
+		}
+		details[i].Geolocation = *geolocation
+		if err := p.write(ctx, generation, details); err != nil {
+			slog.WarnContext(ctx, "Failed to write position cache", "error", err)
+		}
+		return
+	}
+	// チームの最初の位置情報はメンバーの情報がないので、次の読み込みで作り直す
+}
+
+func (p *PositionCache) generation(ctx context.Context) (int64, error) {
+	data, err := p.store.Get(ctx, positionsGenerationKey)
+	if errors.Is(err, lib.ErrCacheMiss) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var generation int64
+	if _, err := fmt.Sscan(string(data), &generation); err != nil {
+		return 0, fmt.Errorf("invalid cache generation %q", data)
+	}
+	return generation, nil
+}
+
+func (p *PositionCache) read(ctx context.Context, generation int64) ([]structs.GeolocationDetail, error) {
+	data, err := p.store.Get(ctx, fmt.Sprintf("%s%d", positionsKeyPrefix, generation))
+	if err != nil {
+		return nil, err
+	}
+	var details []structs.GeolocationDetail
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&details); err != nil {
+		return nil, fmt.Errorf("failed to decode cached positions: %w", err)
+	}
+	return details, nil
+}
+
+func (p *PositionCache) write(ctx context.Context, generation int64, details []structs.GeolocationDetail) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(details); err != nil {
+		return err
+	}
+	return p.store.Set(ctx, fmt.Sprintf("%s%d", positionsKeyPrefix, generation), buf.Bytes(), p.ttl)
+}
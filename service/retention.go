@@ -0,0 +1,24 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+type RetentionService struct {
+	retention repository.RetentionRepository
+}
+
+func NewRetentionService(repos *repository.Repositories) *RetentionService {
+	return &RetentionService{retention: repos.Retention}
+}
+
+func (s *RetentionService) ListRuns(limit int) ([]structs.RetentionRun, error) {
+	runs, err := s.retention.ListRetentionRuns(limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+type TeamService struct {
+	teams     repository.TeamRepository
+	audit     repository.AuditRepository
+	positions *PositionCache
+}
+
+func NewTeamService(repos *repository.Repositories, positions *PositionCache) *TeamService {
+	return &TeamService{teams: repos.Teams, audit: repos.Audit, positions: positions}
+}
+
+// TeamInput is an unvalidated team update. Nil fields are left as they are.
+type TeamInput struct {
+	Name      *string
+	Color     *string
+	Icon      *string
+	Motto     *string
+	CaptainID *string
+}
+
+func (s *TeamService) Get(teamID string) (*structs.TeamDetail, error) {
+	teamDetail, err := s.teams.GetTeamDetailByID(teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get team detail: %w", err)
+	}
+	return teamDetail, nil
+}
+
+func (s *TeamService) Update(ctx context.Context, identity *lib.Identity, teamID string, input TeamInput) (*structs.Team, error) {
+	var update structs.TeamUpdate
+	if input.Name != nil {
+		name, err := lib.NormalizeTeamName(*input.Name)
+		if err != nil {
+			return nil, lib.ValidationError("name", err)
+		}
+		update.Name = &name
+	}
+	if input.Color != nil {
+		color, err := lib.NormalizeTeamColor(*input.Color)
+		if err != nil {
+			return nil, lib.ValidationError("color", err)
+		}
+		update.Color = &color
+	}
+	if input.Icon != nil {
+		icon, err := lib.NormalizeTeamIcon(*input.Icon)
+		if err != nil {
+			return nil, lib.ValidationError("icon", err)
+		}
+		update.Icon = &icon
+	}
+	if input.Motto != nil {
+		motto, err := lib.NormalizeTeamMotto(*input.Motto)
+		if err != nil {
+			return nil, lib.ValidationError("motto", err)
+		}
+		update.Motto = &motto
+	}
+	update.CaptainID = input.CaptainID
+
+	team, err := s.teams.GetTeamByID(teamID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, lib.NotFound("Team not found")
+		}
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+	if !team.CanEdit(identity.UserID, lib.HasScope(identity.Scopes, lib.ScopeAdmin)) {
+		if team.CaptainID == nil || team.ID == structs.DefaultTeamID {
+			return nil, lib.Forbidden("Only admins can edit a team without a leader")
+		}
+		return nil, lib.Forbidden("Only the team leader can edit this team")
+	}
+
+	updated, err := s.teams.UpdateTeam(teamID, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, structs.ErrTeamNameTaken):
+			return nil, lib.Conflict("Team name is already used")
+		case errors.Is(err, structs.ErrCaptainNotMember):
+			return nil, lib.ValidationError("captain_id", err)
+		}
+		return nil, fmt.Errorf("failed to update team: %w", err)
+	}
+	s.positions.Invalidate(ctx)
+
+	before, after := auditChanges{}, auditChanges{}
+	if update.Name != nil {
+		before["name"], after["name"] = team.Name, updated.Name
+	}
+	if update.Color != nil {
+		before["color"], after["color"] = team.Color, updated.Color
+	}
+	if update.Icon != nil {
+		before["icon"], after["icon"] = team.Icon, updated.Icon
+	}
+	if update.Motto != nil {
+		before["motto"], after["motto"] = team.Motto, updated.Motto
+	}
+	if update.CaptainID != nil {
+		before["captain_id"], after["captain_id"] = team.CaptainID, updated.CaptainID
+	}
+	recordAudit(ctx, s.audit, structs.AuditTeamUpdate, "team", teamID, before, after)
+	return updated, nil
+}
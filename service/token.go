@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+type TokenService struct {
+	tokens repository.APITokenRepository
+	audit  repository.AuditRepository
+}
+
+func NewTokenService(repos *repository.Repositories) *TokenService {
+	return &TokenService{tokens: repos.APITokens, audit: repos.Audit}
+}
+
+func (s *TokenService) List(userID string) ([]structs.APIToken, error) {
+	tokens, err := s.tokens.ListAPITokensByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// Create issues a token for the caller and returns the plain token together with
+// the stored record. The plain token cannot be recovered later.
+func (s *TokenService) Create(ctx context.Context, identity *lib.Identity, name string, scopes []string, expiresInDays int) (string, *structs.APIToken, error) {
+	if name == "" {
+		return "", nil, lib.ValidationError("name", fmt.Errorf("token name is required"))
+	}
+	if err := lib.ValidateScopes(scopes); err != nil {
+		return "", nil, lib.ValidationError("scopes", err)
+	}
+	if expiresInDays < 0 {
+		return "", nil, lib.ValidationError("expires_in_days", fmt.Errorf("expires_in_days must not be negative"))
+	}
+	// ログイン中のユーザが持っていない権限はトークンにも付与できない
+	for _, scope := range scopes {
+		if !lib.HasScope(identity.Scopes, scope) {
+			return "", nil, lib.Forbidden("Cannot grant a scope you do not have").WithDetails(fiber.Map{"scope": scope})
+		}
+	}
+	var expiresAt *time.Time
+	if expiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, expiresInDays)
+		expiresAt = &t
+	}
+	token, tokenHash, err := lib.GenerateAPIToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+	apiToken, err := s.tokens.CreateAPIToken(identity.UserID, name, tokenHash, scopes, expiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+	recordAudit(ctx, s.audit, structs.AuditAPITokenCreate, "api_token", strconv.Itoa(apiToken.ID), nil,
+		auditChanges{"name": apiToken.Name, "scopes": apiToken.Scopes, "expires_at": apiToken.ExpiresAt})
+	return token, apiToken, nil
+}
+
+func (s *TokenService) Revoke(ctx context.Context, userID string, tokenID string) (*structs.APIToken, error) {
+	apiToken, err := s.tokens.RevokeAPIToken(userID, tokenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, lib.NotFound("API token not found")
+		}
+		return nil, fmt.Errorf("failed to revoke API token: %w", err)
+	}
+	recordAudit(ctx, s.audit, structs.AuditAPITokenRevoke, "api_token", tokenID, nil,
+		auditChanges{"name": apiToken.Name, "revoked_at": apiToken.RevokedAt})
+	return apiToken, nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/repository"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+type UserService struct {
+	users     repository.UserRepository
+	teams     repository.TeamRepository
+	audit     repository.AuditRepository
+	avatars   lib.AvatarStore
+	positions *PositionCache
+}
+
+func NewUserService(repos *repository.Repositories, avatars lib.AvatarStore, positions *PositionCache) *UserService {
+	return &UserService{
+		users:     repos.Users,
+		teams:     repos.Teams,
+		audit:     repos.Audit,
+		avatars:   avatars,
+		positions: positions,
+	}
+}
+
+// ProfileInput is an unvalidated profile update. Nil fields are left as they are.
+type ProfileInput struct {
+	UserName         *string
+	Avatar           *string // "google" or "none"
+	Phone            *string
+	EmergencyContact *string
+	// AvatarImage はアップロードされた画像。nil ならアップロードなし
+	AvatarImage []byte
+}
+
+func (s *UserService) Me(userID string) (*structs.UserDetail, *structs.TeamDetail, error) {
+	userDetail, err := s.users.GetUserDetailByID(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user detail: %w", err)
+	}
+	teamDetail, err := s.teams.GetTeamDetailByID(strconv.Itoa(userDetail.Team.ID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get team detail: %w", err)
+	}
+	return userDetail, teamDetail, nil
+}
+
+func (s *UserService) GetUser(userID string) (*structs.UserDetail, error) {
+	userDetail, err := s.users.GetUserDetailByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user detail: %w", err)
+	}
+	return userDetail, nil
+}
+
+func (s *UserService) UpdateProfile(ctx context.Context, userID string, input ProfileInput) (*structs.UserProfile, error) {
+	var update structs.ProfileUpdate
+	if input.UserName != nil {
+		name, err := lib.NormalizeUserName(*input.UserName)
+		if err != nil {
+			return nil, lib.ValidationError("user_name", err)
+		}
+		update.UserName = &name
+	}
+	if input.Phone != nil {
+		phone, err := lib.NormalizePhone(*input.Phone)
+		if err != nil {
+			return nil, lib.ValidationError("phone", err)
+		}
+		update.Phone = &phone
+	}
+	if input.EmergencyContact != nil {
+		contact, err := lib.NormalizeEmergencyContact(*input.EmergencyContact)
+		if err != nil {
+			return nil, lib.ValidationError("emergency_contact", err)
+		}
+		update.EmergencyContact = &contact
+	}
+	// 監査ログに変更前の値を残すため、アバターを変更する前に読んでおく
+	previous, err := s.users.GetUserDetailByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user detail: %w", err)
+	}
+	if input.Avatar != nil {
+		switch *input.Avatar {
+		case structs.AvatarSourceGoogle:
+			profile := previous.UserProfile
+			if profile.GoogleAvatarURL == "" {
+				return nil, lib.ValidationError("avatar", errors.New("no Google profile picture is available"))
+			}
+			if err := lib.CacheGoogleAvatar(ctx, s.users, s.avatars, &profile); err != nil {
+				return nil, lib.NewAPIError(fiber.StatusBadGateway, lib.CodeUpstreamError, "Failed to get Google avatar").WithErr(err)
+			}
+		case structs.AvatarSourceNone:
+			if err := s.avatars.Delete(ctx, userID); err != nil {
+				return nil, fmt.Errorf("failed to delete avatar: %w", err)
+			}
+			none, source := "", structs.AvatarSourceNone
+			update.AvatarURL = &none
+			update.AvatarSource = &source
+		default:
+			return nil, lib.ValidationError("avatar", fmt.Errorf("avatar must be \"google\" or \"none\""))
+		}
+	}
+	if input.AvatarImage != nil {
+		if len(input.AvatarImage) > lib.MaxAvatarSize {
+			return nil, lib.NewAPIError(fiber.StatusRequestEntityTooLarge, lib.CodePayloadTooLarge, "Avatar is too large").
+				WithDetails(fiber.Map{"max_bytes": lib.MaxAvatarSize})
+		}
+		if err := lib.StoreAvatar(ctx, s.avatars, userID, input.AvatarImage); err != nil {
+			return nil, lib.ValidationError("avatar", err)
+		}
+		avatarURL, source := lib.AvatarKey(userID), structs.AvatarSourceUpload
+		update.AvatarURL = &avatarURL
+		update.AvatarSource = &source
+	}
+
+	userProfile, err := s.users.UpdateUserProfile(userID, update)
+	if err != nil {
+		if errors.Is(err, structs.ErrUserNameTaken) {
+			return nil, lib.Conflict("User name is already used in your team")
+		}
+		return nil, fmt.Errorf("failed to update user profile: %w", err)
+	}
+	s.positions.Invalidate(ctx)
+
+	before, after := auditChanges{}, auditChanges{}
+	if update.UserName != nil {
+		before["user_name"], after["user_name"] = previous.UserProfile.UserName, userProfile.UserName
+	}
+	if input.Avatar != nil || input.AvatarImage != nil {
+		before["avatar_source"], after["avatar_source"] = previous.UserProfile.AvatarSource, userProfile.AvatarSource
+	}
+	// 連絡先は変更されたことだけを残す
+	if update.Phone != nil {
+		before["phone"], after["phone"] = lib.Redacted, lib.Redacted
+	}
+	if update.EmergencyContact != nil {
+		before["emergency_contact"], after["emergency_contact"] = lib.Redacted, lib.Redacted
+	}
+	if len(after) > 0 {
+		recordAudit(ctx, s.audit, structs.AuditUserUpdate, "user", userID, before, after)
+	}
+	return userProfile, nil
+}
+
+func (s *UserService) ChangeUserName(ctx context.Context, userID string, name string) (*structs.UserProfile, error) {
+	name, err := lib.NormalizeUserName(name)
+	if err != nil {
+		return nil, lib.ValidationError("user_name", err)
+	}
+	previous, err := s.users.GetUserDetailByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user detail: %w", err)
+	}
+	userProfile, err := s.users.ChangeUserName(userID, name)
+	if err != nil {
+		if errors.Is(err, structs.ErrUserNameTaken) {
+			return nil, lib.Conflict("User name is already used in your team")
+		}
+		return nil, fmt.Errorf("failed to change user name: %w", err)
+	}
+	s.positions.Invalidate(ctx)
+	recordAudit(ctx, s.audit, structs.AuditUserUpdate, "user", userID,
+		auditChanges{"user_name": previous.UserProfile.UserName}, auditChanges{"user_name": userProfile.UserName})
+	return userProfile, nil
+}
+
+func (s *UserService) Delete(ctx context.Context, userID string, purgeLocations bool) error {
+	// 監査ログは消せないので、匿名化したプロフィールの名前は残さず ID だけを記録する
+	before := auditChanges{}
+	if previous, err := s.users.GetUserDetailByID(userID); err == nil {
+		before["team_id"] = previous.Team.ID
+	}
+	// 先にアバターを消す。失敗してもアカウントは残るので、やり直せる
+	if err := s.avatars.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	if err := s.users.DeleteUser(userID, purgeLocations); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return lib.NotFound("User not found")
+		}
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	s.positions.Invalidate(ctx)
+	recordAudit(ctx, s.audit, structs.AuditUserDelete, "user", userID, before, auditChanges{"purge_locations": purgeLocations})
+	return nil
+}
+
+// ListContacts returns the emergency contacts of every player, or of one team, for the
+// organizers. Each lookup is recorded in the audit log.
+func (s *UserService) ListContacts(ctx context.Context, teamID int) ([]structs.UserProfile, error) {
+	profiles, err := s.users.ListContacts(teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contacts: %w", err)
+	}
+	target := "all"
+	if teamID != 0 {
+		target = strconv.Itoa(teamID)
+	}
+	recordAudit(ctx, s.audit, structs.AuditContactsView, "team", target, nil, auditChanges{"count": len(profiles)})
+	return profiles, nil
+}
+
+func (s *UserService) Export(userID string) (*structs.UserExport, error) {
+	export, err := s.users.ExportUserData(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export user data: %w", err)
+	}
+	return export, nil
+}
+
+// Avatar returns the stored avatar image and its content type.
+func (s *UserService) Avatar(ctx context.Context, userID string) ([]byte, string, error) {
+	data, contentType, err := s.avatars.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, lib.ErrAvatarNotFound) {
+			return nil, "", lib.NotFound("Avatar not found")
+		}
+		return nil, "", fmt.Errorf("failed to get avatar: %w", err)
+	}
+	return data, contentType, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func TestUpdateProfileGoogleAvatarWithoutPicture(t *testing.T) {
+	users := &stubUsers{users: map[string]structs.User{
+		"player": {ID: "player", Role: lib.RolePlayer, IsExist: true},
+	}}
+	s := &UserService{users: users}
+	avatar := structs.AvatarSourceGoogle
+
+	_, err := s.UpdateProfile(context.Background(), "player", ProfileInput{Avatar: &avatar})
+	var apiErr *lib.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("UpdateProfile() error = %v, want *lib.APIError", err)
+	}
+	if apiErr.Status != fiber.StatusBadRequest || apiErr.Code != lib.CodeValidationFailed {
+		t.Errorf("UpdateProfile() = %d %s, want 400 %s", apiErr.Status, apiErr.Code, lib.CodeValidationFailed)
+	}
+}
@@ -0,0 +1,124 @@
+package structs
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeletedUserName replaces the user name of a deleted account.
+const DeletedUserName = "退会済みユーザ"
+
+type UserExport struct {
+	ExportedAt   time.Time     `json:"exported_at"`
+	User         User          `json:"user"`
+	UserProfile  UserProfile   `json:"user_profile"`
+	Contact      Contact       `json:"contact"`
+	Team         Team          `json:"team"`
+	Geolocations []Geolocation `json:"geolocations"`
+	APITokens    []APIToken    `json:"api_tokens"`
+}
+
+// DeleteUser soft deletes the account by clearing IsExist, anonymizes the profile,
+// removes the user as team captain and revokes all API tokens. Location history is
+// only removed when purgeLocations is set.
+func (db *Database) DeleteUser(userID string, purgeLocations bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).
+			Where("id = ? AND is_exist = ?", userID, true).
+			Updates(map[string]interface{}{"is_exist": false, "email": ""})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&UserProfile{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"user_name":         DeletedUserName,
+				"avatar_url":        nil,
+				"google_avatar_url": nil,
+				"phone":             nil,
+				"emergency_contact": nil,
+			}).Error; err != nil {
+			return err
+		}
+
+		// 退会したリーダーのチームはリーダーなし（管理者のみ変更可）に戻す
+		if err := tx.Model(&Team{}).
+			Where("captain_id = ?", userID).
+			Update("captain_id", nil).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&APIToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if purgeLocations {
+			if err := tx.Where("user_id = ?", userID).Delete(&Geolocation{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *Database) restoreUser(user *User, email string, picture string) (*User, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		user.IsExist = true
+		user.Email = email
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		return tx.Model(&UserProfile{}).
+			Where("id = ?", user.ID).
+			Updates(map[string]interface{}{
+				"user_name":         DefaultUserName,
+				"team_id":           DefaultTeamID,
+				"avatar_url":        nil,
+				"google_avatar_url": picture,
+				"avatar_source":     AvatarSourceGoogle,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ExportUserData collects everything stored about the user.
+func (db *Database) ExportUserData(userID string) (*UserExport, error) {
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	userDetail, err := db.GetUserDetailByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var geolocations []Geolocation
+	if err := db.Where("user_id = ?", userID).Order("created_at ASC").Find(&geolocations).Error; err != nil {
+		return nil, err
+	}
+
+	tokens, err := db.ListAPITokensByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserExport{
+		ExportedAt:   time.Now(),
+		User:         *user,
+		UserProfile:  userDetail.UserProfile,
+		Contact:      userDetail.UserProfile.Contact(),
+		Team:         userDetail.Team,
+		Geolocations: geolocations,
+		APITokens:    tokens,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package structs_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func TestDeleteUserClearsCaptain(t *testing.T) {
+	db := newTestDatabase(t)
+	team := createTeam(t, db, "赤組", []string{"captain", "member"}, true)
+
+	if err := db.DeleteUser("captain", false); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+
+	got, err := db.GetTeamByID(strconv.Itoa(team.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CaptainID != nil {
+		t.Errorf("CaptainID = %q, want nil after the captain was deleted", *got.CaptainID)
+	}
+	// リーダーがいなくなったチームは管理者しか変更できない
+	if got.CanEdit("member", false) {
+		t.Error("a member can edit the team after the captain was deleted")
+	}
+	if exists, err := db.CheckUserExistsByID("captain"); err != nil || exists {
+		t.Errorf("CheckUserExistsByID() = %v, %v, want false", exists, err)
+	}
+}
+
+func TestDeleteUserKeepsOtherCaptains(t *testing.T) {
+	db := newTestDatabase(t)
+	team := createTeam(t, db, "白組", []string{"captain", "member"}, true)
+
+	if err := db.DeleteUser("member", false); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+
+	var got structs.Team
+	if err := db.First(&got, team.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.CaptainID == nil || *got.CaptainID != "captain" {
+		t.Errorf("CaptainID = %v, want captain", got.CaptainID)
+	}
+}
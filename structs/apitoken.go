@@ -0,0 +1,71 @@
+package structs
+
+import (
+	"strings"
+	"time"
+)
+
+type APIToken struct {
+	ID         int       `gorm:"primaryKey,autoIncrement"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+	UserID     string    `gorm:"not null;index"`
+	Name       string    `gorm:"not null"`
+	TokenHash  string    `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     string    `gorm:"not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (db *Database) CreateAPIToken(userID string, name string, tokenHash string, scopes []string, expiresAt *time.Time) (*APIToken, error) {
+	token := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: tokenHash,
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(token).Error; err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetActiveAPITokenByHash returns a token that is neither revoked nor expired.
+func (db *Database) GetActiveAPITokenByHash(tokenHash string) (*APIToken, error) {
+	var token APIToken
+	if err := db.Where("token_hash = ? AND revoked_at IS NULL", tokenHash).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (db *Database) ListAPITokensByUserID(userID string) ([]APIToken, error) {
+	var tokens []APIToken
+	if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (db *Database) RevokeAPIToken(userID string, tokenID string) (*APIToken, error) {
+	var token APIToken
+	if err := db.First(&token, "id = ? AND user_id = ?", tokenID, userID).Error; err != nil {
+		return nil, err
+	}
+	if token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+		if err := db.Save(&token).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &token, nil
+}
+
+func (db *Database) TouchAPIToken(tokenID int) error {
+	return db.Model(&APIToken{}).Where("id = ?", tokenID).Update("last_used_at", time.Now()).Error
+}
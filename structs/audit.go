@@ -0,0 +1,80 @@
+package structs
+
+import (
+	"time"
+)
+
+// Audited actions. The target of each is given in the comment.
+const (
+	AuditTeamUpdate        = "team.update"        // team
+	AuditUserUpdate        = "user.update"        // user
+	AuditUserDelete        = "user.delete"        // user
+	AuditGeolocationCreate = "geolocation.create" // geolocation
+	AuditAPITokenCreate    = "api_token.create"   // api_token
+	AuditAPITokenRevoke    = "api_token.revoke"   // api_token
+	AuditContactsView      = "contacts.view"      // team（全チームなら "all"）
+)
+
+// AuditLog records who did what to which record. The table is append-only: the
+// database rejects updates and deletes, and rows are kept when the actor is deleted.
+type AuditLog struct {
+	ID         int       `gorm:"primaryKey,autoIncrement"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ActorID    string    `gorm:"not null;index"`
+	Action     string    `gorm:"not null"`
+	TargetType string    `gorm:"not null"`
+	TargetID   string    `gorm:"not null"`
+	// Before と After は変更された項目の変更前と変更後の値（JSON）。なければ空
+	Before    string `gorm:"not null;default:''"`
+	After     string `gorm:"not null;default:''"`
+	IP        string `gorm:"not null;default:''"`
+	RequestID string `gorm:"not null;default:''"`
+}
+
+// AuditLogFilter selects audit logs. Zero fields are not filtered on.
+type AuditLogFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	// BeforeID は前のページの最後の ID。これより古い記録を返す
+	BeforeID int
+	Limit    int
+}
+
+func (db *Database) AddAuditLog(entry *AuditLog) error {
+	return db.Create(entry).Error
+}
+
+// ListAuditLogs returns the matching audit logs, newest first.
+func (db *Database) ListAuditLogs(filter AuditLogFilter) ([]AuditLog, error) {
+	query := db.Model(&AuditLog{})
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	var logs []AuditLog
+	if err := query.Order("id DESC").Limit(filter.Limit).Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
@@ -0,0 +1,90 @@
+package structs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func TestAuditLogsAreAppendOnly(t *testing.T) {
+	db := newTestDatabase(t)
+	entry := &structs.AuditLog{
+		ActorID:    "admin",
+		Action:     structs.AuditTeamUpdate,
+		TargetType: "team",
+		TargetID:   "1",
+		After:      `{"name":"赤組"}`,
+	}
+	if err := db.AddAuditLog(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.Model(&structs.AuditLog{}).Where("id = ?", entry.ID).Update("actor_id", "someone else").Error
+	if err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("UPDATE audit_logs error = %v, want the trigger to reject it", err)
+	}
+	err = db.Delete(&structs.AuditLog{}, entry.ID).Error
+	if err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("DELETE FROM audit_logs error = %v, want the trigger to reject it", err)
+	}
+	// 退会したユーザの記録も残る
+	if err := db.Exec("DELETE FROM audit_logs WHERE actor_id = ?", "admin").Error; err == nil {
+		t.Error("DELETE FROM audit_logs by actor succeeded")
+	}
+
+	logs, err := db.ListAuditLogs(structs.AuditLogFilter{ActorID: "admin", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].ActorID != "admin" || logs[0].After != entry.After {
+		t.Errorf("ListAuditLogs() = %+v, want the original entry", logs)
+	}
+}
+
+func TestListAuditLogsFilter(t *testing.T) {
+	db := newTestDatabase(t)
+	for _, entry := range []structs.AuditLog{
+		{ActorID: "a", Action: structs.AuditTeamUpdate, TargetType: "team", TargetID: "1"},
+		{ActorID: "b", Action: structs.AuditUserUpdate, TargetType: "user", TargetID: "b"},
+		{ActorID: "a", Action: structs.AuditUserDelete, TargetType: "user", TargetID: "a"},
+		{ActorID: "a", Action: structs.AuditTeamUpdate, TargetType: "team", TargetID: "2"},
+	} {
+		if err := db.AddAuditLog(&entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter structs.AuditLogFilter
+		want   []int
+	}{
+		{"all, newest first", structs.AuditLogFilter{Limit: 10}, []int{4, 3, 2, 1}},
+		{"actor", structs.AuditLogFilter{ActorID: "a", Limit: 10}, []int{4, 3, 1}},
+		{"action", structs.AuditLogFilter{Action: structs.AuditTeamUpdate, Limit: 10}, []int{4, 1}},
+		{"target", structs.AuditLogFilter{TargetType: "user", TargetID: "b", Limit: 10}, []int{2}},
+		{"next page", structs.AuditLogFilter{BeforeID: 3, Limit: 10}, []int{2, 1}},
+		{"limit", structs.AuditLogFilter{Limit: 2}, []int{4, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, err := db.ListAuditLogs(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, log := range logs {
+				ids = append(ids, log.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("IDs = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("IDs = %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -10,12 +10,18 @@ type Database struct {
 	*gorm.DB
 }
 
+const (
+	DefaultUserName = "ユーザ名未登録"
+	DefaultTeamID   = 9
+)
+
 type User struct {
 	ID        string `gorm:"primaryKey"`
 	Email     string
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	IsExist   bool      `gorm:"default:true"`
+	Role      string    `gorm:"not null;default:player"`
 }
 
 type UserProfile struct {
@@ -23,8 +29,16 @@ type UserProfile struct {
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	UserName  string    `gorm:"not null"`
-	TeamID    int       `gorm:"not null"`
+	TeamID    int       `gorm:"not null;default:9"`
 	AvatarURL string    `gorm:"default:null"`
+	// GoogleAvatarURL はアップロードしたアバターから Google の画像に戻すために残しておく
+	GoogleAvatarURL  string `gorm:"default:null" json:"-"`
+	AvatarSource     string `gorm:"not null;default:google"`
+	Phone            string `gorm:"default:null" json:"-"`
+	EmergencyContact string `gorm:"default:null" json:"-"`
+
+	// Team はチームを削除すると「チーム未設定」（DefaultTeamID）に戻る
+	Team *Team `gorm:"constraint:OnDelete:SET DEFAULT" json:"-"`
 }
 
 type Team struct {
@@ -32,6 +46,26 @@ type Team struct {
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	Name      string    `gorm:"unique;not null"`
+	GameID    *int
+	Color     string  `gorm:"default:null"` // "#RRGGBB"
+	Icon      string  `gorm:"default:null"` // 絵文字
+	Motto     string  `gorm:"default:null"`
+	CaptainID *string // チームリーダーのユーザ ID
+
+	Members []UserProfile `json:"-"`
+}
+
+type Game struct {
+	ID        int       `gorm:"primaryKey,autoIncrement"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	Name      string    `gorm:"not null"`
+	StartAt   *time.Time
+	EndAt     *time.Time
+	// RetentionDays 日後に位置情報を RetentionMode に従って処理する。nil なら保持し続ける
+	RetentionDays *int
+	RetentionMode string `gorm:"not null;default:purge"`
+	CoarsenDigits int    `gorm:"not null;default:2"`
 }
 
 type Geolocation struct {
@@ -39,8 +73,13 @@ type Geolocation struct {
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	UserID    string    `gorm:"not null"`
-	Latitude  float64   `gorm:"not null"`
-	Longitude float64   `gorm:"not null"`
+	// GameID は登録した時点のチームの試合。保持期間の処理はこの試合の設定に従う
+	GameID    *int
+	Latitude  float64 `gorm:"not null"`
+	Longitude float64 `gorm:"not null"`
+	Coarsened bool    `gorm:"not null;default:false"`
+
+	UserProfile *UserProfile `gorm:"foreignKey:UserID" json:"-"`
 }
 
 type UserDetail struct {
@@ -58,46 +97,9 @@ type GeolocationDetail struct {
 	Geolocation Geolocation
 }
 
-func (db *Database) AutoMigrateModels() error {
-	err := db.AutoMigrate(&User{}, &UserProfile{}, &Team{}, &Geolocation{})
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (db *Database) AutoCreateTestData() error {
-	var count int64
-	db.Model(&Team{}).Where("id = ?", 9).Count(&count)
-	if count == 0 {
-		testTeam := Team{
-			ID:   9,
-			Name: "チーム未設定",
-		}
-		if err := db.Create(&testTeam).Error; err != nil {
-			return err
-		}
-	}
-
-	db.Model(&Geolocation{}).Where("id = ?", 1).Count(&count)
-	if count == 0 {
-		testGeolocation := Geolocation{
-			ID:        1,
-			UserID:    "111862085249385638299",
-			Latitude:  34.385973,
-			Longitude: 132.453895,
-		}
-		if err := db.Create(&testGeolocation).Error; err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 func (db *Database) CheckUserExistsByID(id string) (bool, error) {
 	var count int64
-	if err := db.Model(&User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+	if err := db.Model(&User{}).Where("id = ? AND is_exist = ?", id, true).Count(&count).Error; err != nil {
 		return false, err
 	}
 	return count > 0, nil
@@ -105,103 +107,126 @@ func (db *Database) CheckUserExistsByID(id string) (bool, error) {
 
 func (db *Database) GetUserByID(userID string) (*User, error) {
 	var user User
-	if err := db.First(&user, "id = ?", userID).Error; err != nil {
+	if err := db.First(&user, "id = ? AND is_exist = ?", userID, true).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
 func (db *Database) GetUserDetailByID(userID string) (*UserDetail, error) {
-	var user User
-	if err := db.First(&user, "id = ?", userID).Error; err != nil {
-		return nil, err
-	}
-
 	var userProfile UserProfile
-	if err := db.First(&userProfile, "id = ?", userID).Error; err != nil {
-		return nil, err
-	}
-
-	var team Team
-	if err := db.First(&team, "id = ?", userProfile.TeamID).Error; err != nil {
+	if err := db.InnerJoins("Team").
+		Where("user_profiles.id = ? AND user_profiles.id IN (?)", userID, db.activeUserIDs()).
+		First(&userProfile).Error; err != nil {
 		return nil, err
 	}
 
+	team := *userProfile.Team
+	userProfile.Team = nil
 	return &UserDetail{
 		UserProfile: userProfile,
 		Team:        team,
 	}, nil
 }
 
+// preloadActiveMembers loads Team.Members without the users that deleted their account.
+func (db *Database) preloadActiveMembers() *gorm.DB {
+	return db.Preload("Members", "id IN (?)", db.activeUserIDs())
+}
+
 func (db *Database) GetTeamDetailByID(teamID string) (*TeamDetail, error) {
 	var team Team
-	if err := db.First(&team, "id = ?", teamID).Error; err != nil {
-		return nil, err
-	}
-
-	var members []UserProfile
-	if err := db.Where("team_id = ?", teamID).Find(&members).Error; err != nil {
+	if err := db.preloadActiveMembers().First(&team, "id = ?", teamID).Error; err != nil {
 		return nil, err
 	}
 
+	members := team.Members
+	team.Members = nil
 	return &TeamDetail{
 		Team:    team,
 		Members: members,
 	}, nil
 }
 
+// latestTeamGeolocations selects the newest location of each team's active members,
+// with one row per active member of the team so that the teams come in the same query.
+// The members' phone and emergency contact are not selected: the result is cached in
+// Redis, which other services may share.
+// The latest location of every user is looked up through idx_geolocations_user_id_created_at,
+// so the cost depends on the number of users rather than the length of the history.
+const latestTeamGeolocations = `
+WITH active_users AS (
+	SELECT id FROM users WHERE is_exist = ?
+), latest AS (
+	SELECT id, created_at, updated_at, user_id, game_id, latitude, longitude, coarsened, team_id FROM (
+		SELECT g.*, p.team_id,
+			ROW_NUMBER() OVER (PARTITION BY p.team_id ORDER BY g.created_at DESC, g.id DESC) AS team_rank
+		FROM user_profiles p
+		JOIN active_users u ON u.id = p.id
+		JOIN geolocations g ON g.id = (
+			SELECT g2.id FROM geolocations g2
+			WHERE g2.user_id = p.id
+			ORDER BY g2.created_at DESC, g2.id DESC
+			LIMIT 1
+		)
+	) ranked
+	WHERE team_rank = 1
+)
+SELECT
+	l.id AS geo_id, l.created_at AS geo_created_at, l.updated_at AS geo_updated_at,
+	l.user_id AS geo_user_id, l.game_id AS geo_game_id, l.latitude AS geo_latitude, l.longitude AS geo_longitude,
+	l.coarsened AS geo_coarsened,
+	t.id AS team_id, t.created_at AS team_created_at, t.updated_at AS team_updated_at,
+	t.name AS team_name, t.game_id AS team_game_id, t.color AS team_color, t.icon AS team_icon,
+	t.motto AS team_motto, t.captain_id AS team_captain_id,
+	m.id AS member_id, m.created_at AS member_created_at, m.updated_at AS member_updated_at,
+	m.user_name AS member_user_name, m.team_id AS member_team_id, m.avatar_url AS member_avatar_url,
+	m.google_avatar_url AS member_google_avatar_url, m.avatar_source AS member_avatar_source
+FROM latest l
+JOIN teams t ON t.id = l.team_id
+JOIN user_profiles m ON m.team_id = t.id AND m.id IN (SELECT id FROM active_users)
+ORDER BY t.id, m.id`
+
+// teamGeolocationRow is a row of latestTeamGeolocations.
+type teamGeolocationRow struct {
+	Geolocation Geolocation `gorm:"embedded;embeddedPrefix:geo_"`
+	Team        Team        `gorm:"embedded;embeddedPrefix:team_"`
+	Member      UserProfile `gorm:"embedded;embeddedPrefix:member_"`
+}
+
+// GetGeolocationLatestAll returns the latest location of every team that has one,
+// in a single query. Teams that were deleted are left out by the join.
 func (db *Database) GetGeolocationLatestAll() (*[]GeolocationDetail, error) {
-	var teams []Team
-	if err := db.Find(&teams).Error; err != nil {
+	var rows []teamGeolocationRow
+	if err := db.Raw(latestTeamGeolocations, true).Scan(&rows).Error; err != nil {
 		return nil, err
 	}
 
-	var details []GeolocationDetail
-
-	for _, team := range teams {
-		var members []UserProfile
-		if err := db.Where("team_id = ?", team.ID).Find(&members).Error; err != nil {
-			return nil, err
-		}
-
-		// Collect all user IDs in this team
-		var userIDs []string
-		for _, member := range members {
-			userIDs = append(userIDs, member.ID)
-		}
-
-		if len(userIDs) == 0 {
-			continue // チームにメンバーがいない場合もスキップ
-		}
-
-		var latestGeolocation Geolocation
-		// Get the latest geolocation for any user in this team
-		if err := db.Where("user_id IN ?", userIDs).
-			Order("created_at DESC").
-			First(&latestGeolocation).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				continue // Geolocation が一件もない場合はスキップ
-			}
-			return nil, err
-		}
-
-		teamDetail := TeamDetail{
-			Team:    team,
-			Members: members,
+	// 行はチームごとに並んでいるので、チームが変わるところで区切る
+	details := []GeolocationDetail{}
+	for _, row := range rows {
+		if n := len(details); n == 0 || details[n-1].TeamDetail.Team.ID != row.Team.ID {
+			details = append(details, GeolocationDetail{
+				TeamDetail: TeamDetail{
+					Team:    row.Team,
+					Members: []UserProfile{},
+				},
+				Geolocation: row.Geolocation,
+			})
 		}
-
-		details = append(details, GeolocationDetail{
-			TeamDetail:  teamDetail,
-			Geolocation: latestGeolocation,
-		})
+		detail := &details[len(details)-1]
+		detail.TeamDetail.Members = append(detail.TeamDetail.Members, row.Member)
 	}
 
 	return &details, nil
 }
 
-func (db *Database) AddGeolocation(userID string, latitude float64, longitude float64) (*Geolocation, error) {
+// AddGeolocation records a location of userID during gameID, the game of the user's
+// team at the time (nil if the team is not in a game).
+func (db *Database) AddGeolocation(userID string, gameID *int, latitude float64, longitude float64) (*Geolocation, error) {
 	geolocation := &Geolocation{
 		UserID:    userID,
+		GameID:    gameID,
 		Latitude:  latitude,
 		Longitude: longitude,
 	}
@@ -211,7 +236,22 @@ func (db *Database) AddGeolocation(userID string, latitude float64, longitude fl
 	return geolocation, nil
 }
 
+// activeUserIDs is a subquery selecting users that have not deleted their account.
+func (db *Database) activeUserIDs() *gorm.DB {
+	return db.Model(&User{}).Select("id").Where("is_exist = ?", true)
+}
+
 func (db *Database) CreateUser(userID string, email string, picture string) (*User, error) {
+	// 退会済みのユーザが再度ログインした場合は新規ユーザとして復帰させる
+	var deleted User
+	result := db.Where("id = ? AND is_exist = ?", userID, false).Limit(1).Find(&deleted)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return db.restoreUser(&deleted, email, picture)
+	}
+
 	user := &User{
 		ID:    userID,
 		Email: email,
@@ -221,10 +261,12 @@ func (db *Database) CreateUser(userID string, email string, picture string) (*Us
 	}
 
 	userProfile := &UserProfile{
-		ID:        userID,
-		UserName:  "ユーザ名未登録", // Default username, can be updated later
-		TeamID:    9,         // Default team ID, can be updated later
-		AvatarURL: picture,
+		ID:       userID,
+		UserName: DefaultUserName, // Default username, can be updated later
+		TeamID:   DefaultTeamID,   // Default team ID, can be updated later
+		// アバターは Google から取得してキャッシュするまで空にしておく
+		GoogleAvatarURL: picture,
+		AvatarSource:    AvatarSourceGoogle,
 	}
 	if err := db.Create(userProfile).Error; err != nil {
 		return nil, err
@@ -233,14 +275,5 @@ func (db *Database) CreateUser(userID string, email string, picture string) (*Us
 }
 
 func (db *Database) ChangeUserName(userID string, newUserName string) (*UserProfile, error) {
-	var userProfile UserProfile
-	if err := db.First(&userProfile, "id = ?", userID).Error; err != nil {
-		return nil, err
-	}
-
-	userProfile.UserName = newUserName
-	if err := db.Save(&userProfile).Error; err != nil {
-		return nil, err
-	}
-	return &userProfile, nil
+	return db.UpdateUserProfile(userID, ProfileUpdate{UserName: &newUserName})
 }
@@ -0,0 +1,60 @@
+package structs_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/m-tsuru/tenchi-geolocation/lib"
+	"github.com/m-tsuru/tenchi-geolocation/migrations"
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// newTestDatabase returns a migrated SQLite database in a temporary directory.
+func newTestDatabase(t testing.TB) *structs.Database {
+	t.Helper()
+	db, err := lib.OpenDatabase(&lib.DatabaseConfig{
+		Driver: lib.DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "test.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	return &structs.Database{DB: db}
+}
+
+// createTeam adds a team with the given members. The first member is the captain
+// when withCaptain is set.
+func createTeam(t testing.TB, db *structs.Database, name string, memberIDs []string, withCaptain bool) *structs.Team {
+	t.Helper()
+	team := &structs.Team{Name: name}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range memberIDs {
+		if _, err := db.CreateUser(userID, userID+"@example.com", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Model(&structs.UserProfile{}).Where("id = ?", userID).Update("team_id", team.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if withCaptain {
+		team.CaptainID = &memberIDs[0]
+		if err := db.Save(team).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return team
+}
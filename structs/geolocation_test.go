@@ -0,0 +1,169 @@
+package structs_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+// getGeolocationLatestAllThreeQueries is the previous implementation of
+// GetGeolocationLatestAll, which loaded the teams and their members in separate queries
+// after the latest locations. It is kept for the benchmark.
+func getGeolocationLatestAllThreeQueries(db *structs.Database) (*[]structs.GeolocationDetail, error) {
+	var latest []struct {
+		structs.Geolocation
+		TeamID int
+	}
+	if err := db.Raw(`
+SELECT id, created_at, updated_at, user_id, latitude, longitude, coarsened, team_id FROM (
+	SELECT g.*, p.team_id,
+		ROW_NUMBER() OVER (PARTITION BY p.team_id ORDER BY g.created_at DESC, g.id DESC) AS team_rank
+	FROM user_profiles p
+	JOIN users u ON u.id = p.id AND u.is_exist = ?
+	JOIN geolocations g ON g.id = (
+		SELECT g2.id FROM geolocations g2
+		WHERE g2.user_id = p.id
+		ORDER BY g2.created_at DESC, g2.id DESC
+		LIMIT 1
+	)
+) latest
+WHERE team_rank = 1
+ORDER BY team_id`, true).Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+
+	details := []structs.GeolocationDetail{}
+	if len(latest) == 0 {
+		return &details, nil
+	}
+	teamIDs := make([]int, 0, len(latest))
+	for _, l := range latest {
+		teamIDs = append(teamIDs, l.TeamID)
+	}
+	activeUserIDs := db.Model(&structs.User{}).Select("id").Where("is_exist = ?", true)
+	var teams []structs.Team
+	if err := db.Preload("Members", "id IN (?)", activeUserIDs).Where("id IN ?", teamIDs).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	teamsByID := make(map[int]structs.Team, len(teams))
+	for _, team := range teams {
+		teamsByID[team.ID] = team
+	}
+	for _, l := range latest {
+		team, ok := teamsByID[l.TeamID]
+		if !ok {
+			continue
+		}
+		members := team.Members
+		team.Members = nil
+		details = append(details, structs.GeolocationDetail{
+			TeamDetail:  structs.TeamDetail{Team: team, Members: members},
+			Geolocation: l.Geolocation,
+		})
+	}
+	return &details, nil
+}
+
+// seedTeamGeolocations adds teams with membersPerTeam members each. Every member
+// reports a few locations, and one member of each team has deleted their account.
+func seedTeamGeolocations(t testing.TB, db *structs.Database, teams int, membersPerTeam int) {
+	t.Helper()
+	start := time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC)
+	for i := range teams {
+		memberIDs := make([]string, membersPerTeam)
+		for j := range memberIDs {
+			memberIDs[j] = fmt.Sprintf("user-%03d-%d", i, j)
+		}
+		createTeam(t, db, fmt.Sprintf("team-%03d", i), memberIDs, i%2 == 0)
+		var geolocations []structs.Geolocation
+		for j, userID := range memberIDs {
+			for k := range 3 {
+				at := start.Add(time.Duration(k*membersPerTeam+j) * time.Minute)
+				geolocations = append(geolocations, structs.Geolocation{
+					CreatedAt: at,
+					UpdatedAt: at,
+					UserID:    userID,
+					Latitude:  35 + float64(i)/1000,
+					Longitude: 139 + float64(j)/1000,
+				})
+			}
+		}
+		if err := db.Create(&geolocations).Error; err != nil {
+			t.Fatal(err)
+		}
+		// 最後のメンバーが退会しているので、最新の位置はその前のメンバーのもの
+		if err := db.DeleteUser(memberIDs[membersPerTeam-1], false); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetGeolocationLatestAll(t *testing.T) {
+	db := newTestDatabase(t)
+	seedTeamGeolocations(t, db, 5, 3)
+	createTeam(t, db, "no locations", []string{"quiet"}, false)
+	phone, emergencyContact := "090-1234-5678", "家族 080-0000-0000"
+	for i := range 5 {
+		if _, err := db.UpdateUserProfile(fmt.Sprintf("user-%03d-0", i), structs.ProfileUpdate{Phone: &phone, EmergencyContact: &emergencyContact}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := db.GetGeolocationLatestAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := getGeolocationLatestAllThreeQueries(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 5 {
+		t.Fatalf("len = %d, want 5 teams with a location", len(*got))
+	}
+	// 結果はキャッシュされるので、メンバーの連絡先は含めない
+	for i := range *want {
+		members := (*want)[i].TeamDetail.Members
+		for j := range members {
+			members[j].Phone, members[j].EmergencyContact = "", ""
+		}
+	}
+	for i, detail := range *got {
+		for _, member := range detail.TeamDetail.Members {
+			if member.Phone != "" || member.EmergencyContact != "" {
+				t.Errorf("team %d: member %s has contact details %q, %q", i, member.ID, member.Phone, member.EmergencyContact)
+			}
+		}
+		if detail.Geolocation.UserID != fmt.Sprintf("user-%03d-1", i) {
+			t.Errorf("team %d: latest location from %q, want the last active member", i, detail.Geolocation.UserID)
+		}
+		if len(detail.TeamDetail.Members) != 2 {
+			t.Errorf("team %d: %d members, want the 2 active ones", i, len(detail.TeamDetail.Members))
+		}
+	}
+	if !reflect.DeepEqual(*got, *want) {
+		t.Errorf("GetGeolocationLatestAll() differs from the three-query version\ngot:  %+v\nwant: %+v", *got, *want)
+	}
+}
+
+func BenchmarkGetGeolocationLatestAll(b *testing.B) {
+	db := newTestDatabase(b)
+	seedTeamGeolocations(b, db, 300, 4)
+
+	b.Run("three queries", func(b *testing.B) {
+		for range b.N {
+			if _, err := getGeolocationLatestAllThreeQueries(db); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("single query", func(b *testing.B) {
+		for range b.N {
+			if _, err := db.GetGeolocationLatestAll(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package structs
+
+import (
+	"context"
+)
+
+// Ping checks that the database is reachable.
+func (db *Database) Ping(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// SchemaVersion returns the highest applied migration. Unlike migrations.Migrator it
+// only reads schema_version, so it is cheap enough for every readiness probe.
+func (db *Database) SchemaVersion(ctx context.Context) (int, error) {
+	var version *int
+	if err := db.WithContext(ctx).Raw("SELECT MAX(version) FROM schema_version").Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return *version, nil
+}
@@ -0,0 +1,91 @@
+package structs
+
+import (
+	"fmt"
+)
+
+// IntegrityIssue is a group of rows that refer to something that does not exist.
+type IntegrityIssue struct {
+	Description string
+	Table       string
+	Count       int64
+	// Samples は問題のある行の ID（最大 5 件）
+	Samples []string
+}
+
+type integrityCheck struct {
+	description string
+	table       string
+	condition   string
+}
+
+// 外部キー制約（マイグレーション 0003）より前に書き込まれたデータには不整合が残っていることがある
+var integrityChecks = []integrityCheck{
+	{"profile without user", "user_profiles",
+		"NOT EXISTS (SELECT 1 FROM users WHERE users.id = user_profiles.id)"},
+	{"user without profile", "users",
+		"NOT EXISTS (SELECT 1 FROM user_profiles WHERE user_profiles.id = users.id)"},
+	{"profile in a missing team", "user_profiles",
+		"NOT EXISTS (SELECT 1 FROM teams WHERE teams.id = user_profiles.team_id)"},
+	{"team in a missing game", "teams",
+		"game_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM games WHERE games.id = teams.game_id)"},
+	{"team with a missing captain", "teams",
+		"captain_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = teams.captain_id)"},
+	{"geolocation of a missing user", "geolocations",
+		"NOT EXISTS (SELECT 1 FROM users WHERE users.id = geolocations.user_id)"},
+	{"API token of a missing user", "api_tokens",
+		"NOT EXISTS (SELECT 1 FROM users WHERE users.id = api_tokens.user_id)"},
+	{"retention run of a missing game", "retention_runs",
+		"NOT EXISTS (SELECT 1 FROM games WHERE games.id = retention_runs.game_id)"},
+}
+
+// CheckIntegrity reports orphaned rows. An empty result means the data is consistent.
+func (db *Database) CheckIntegrity() ([]IntegrityIssue, error) {
+	var issues []IntegrityIssue
+	for _, check := range integrityChecks {
+		var count int64
+		if err := db.Table(check.table).Where(check.condition).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("%s: %w", check.description, err)
+		}
+		if count == 0 {
+			continue
+		}
+		var samples []string
+		if err := db.Table(check.table).Where(check.condition).Order("id").Limit(5).Pluck("id", &samples).Error; err != nil {
+			return nil, fmt.Errorf("%s: %w", check.description, err)
+		}
+		issues = append(issues, IntegrityIssue{
+			Description: check.description,
+			Table:       check.table,
+			Count:       count,
+			Samples:     samples,
+		})
+	}
+	return issues, nil
+}
+
+// ValidateForeignKeys validates the constraints added with NOT VALID (Postgres only)
+// and returns their names. It fails if orphaned rows remain.
+func (db *Database) ValidateForeignKeys() ([]string, error) {
+	if db.Dialector.Name() != "postgres" {
+		return nil, nil
+	}
+	var constraints []struct {
+		Table string
+		Name  string
+	}
+	if err := db.Raw(`SELECT conrelid::regclass::text AS "table", conname AS name
+		FROM pg_constraint
+		WHERE contype = 'f' AND NOT convalidated AND connamespace = current_schema()::regnamespace
+		ORDER BY conname`).Scan(&constraints).Error; err != nil {
+		return nil, err
+	}
+	var validated []string
+	for _, c := range constraints {
+		if err := db.Exec(fmt.Sprintf(`ALTER TABLE %s VALIDATE CONSTRAINT %q`, c.Table, c.Name)).Error; err != nil {
+			return validated, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		validated = append(validated, c.Name)
+	}
+	return validated, nil
+}
@@ -0,0 +1,116 @@
+package structs
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrUserNameTaken = errors.New("user name is already used in the team")
+
+const (
+	AvatarSourceGoogle = "google"
+	AvatarSourceUpload = "upload"
+	AvatarSourceNone   = "none"
+)
+
+// Contact is the emergency contact information, which is hidden from other players.
+type Contact struct {
+	Phone            string `json:"phone"`
+	EmergencyContact string `json:"emergency_contact"`
+}
+
+func (p *UserProfile) Contact() Contact {
+	return Contact{
+		Phone:            p.Phone,
+		EmergencyContact: p.EmergencyContact,
+	}
+}
+
+// ProfileUpdate lists the fields to change. Nil fields are left as they are.
+// Values are expected to be validated by the caller.
+type ProfileUpdate struct {
+	UserName         *string
+	AvatarURL        *string
+	AvatarSource     *string
+	Phone            *string
+	EmergencyContact *string
+}
+
+func (db *Database) UpdateUserProfile(userID string, update ProfileUpdate) (*UserProfile, error) {
+	var userProfile UserProfile
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&userProfile, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		if update.UserName != nil {
+			userProfile.UserName = *update.UserName
+		}
+		if update.AvatarURL != nil {
+			userProfile.AvatarURL = *update.AvatarURL
+		}
+		if update.AvatarSource != nil {
+			userProfile.AvatarSource = *update.AvatarSource
+		}
+		if update.Phone != nil {
+			userProfile.Phone = *update.Phone
+		}
+		if update.EmergencyContact != nil {
+			userProfile.EmergencyContact = *update.EmergencyContact
+		}
+		// 同じチーム内で同じ名前（大文字小文字は区別しない）は一意インデックスで拒否される
+		if err := tx.Save(&userProfile).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrUserNameTaken
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &userProfile, nil
+}
+
+// SetGoogleAvatarURL records the picture URL Google returned at the latest login.
+func (db *Database) SetGoogleAvatarURL(userID string, pictureURL string) (*UserProfile, error) {
+	var userProfile UserProfile
+	if err := db.First(&userProfile, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	if userProfile.GoogleAvatarURL == pictureURL {
+		return &userProfile, nil
+	}
+	userProfile.GoogleAvatarURL = pictureURL
+	if err := db.Save(&userProfile).Error; err != nil {
+		return nil, err
+	}
+	return &userProfile, nil
+}
+
+// ListProfilesWithRemoteAvatar returns profiles whose avatar still points to an external URL.
+func (db *Database) ListProfilesWithRemoteAvatar() ([]UserProfile, error) {
+	var profiles []UserProfile
+	if err := db.Where("avatar_url LIKE ? OR avatar_url LIKE ?", "http://%", "https://%").
+		Where("id IN (?)", db.activeUserIDs()).
+		Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// ListContacts returns the profiles of active users, which include their contact
+// details, ordered by team. A teamID of 0 lists every team.
+func (db *Database) ListContacts(teamID int) ([]UserProfile, error) {
+	query := db.Where("id IN (?)", db.activeUserIDs())
+	if teamID != 0 {
+		query = query.Where("team_id = ?", teamID)
+	}
+	var profiles []UserProfile
+	if err := query.Order("team_id, user_name").Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
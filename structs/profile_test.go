@@ -0,0 +1,48 @@
+package structs_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func TestUpdateUserProfileNameUniqueInTeam(t *testing.T) {
+	db := newTestDatabase(t)
+	createTeam(t, db, "赤組", []string{"red-1", "red-2"}, false)
+	createTeam(t, db, "白組", []string{"white-1"}, false)
+
+	rename := func(userID string, name string) error {
+		_, err := db.UpdateUserProfile(userID, structs.ProfileUpdate{UserName: &name})
+		return err
+	}
+	if err := rename("red-1", "Alice"); err != nil {
+		t.Fatalf("rename red-1: %v", err)
+	}
+	if err := rename("red-2", "alice"); !errors.Is(err, structs.ErrUserNameTaken) {
+		t.Errorf("same name in the team: error = %v, want ErrUserNameTaken", err)
+	}
+	if err := rename("white-1", "Alice"); err != nil {
+		t.Errorf("same name in another team: error = %v", err)
+	}
+	// 初期値の名前は全員が同じなので重複してよい
+	if err := rename("red-1", structs.DefaultUserName); err != nil {
+		t.Errorf("rename back to the default name: error = %v", err)
+	}
+	if err := rename("red-2", "alice"); err != nil {
+		t.Errorf("rename after the name was freed: error = %v", err)
+	}
+}
+
+func TestUpdateTeamNameTaken(t *testing.T) {
+	db := newTestDatabase(t)
+	createTeam(t, db, "赤組", nil, false)
+	white := createTeam(t, db, "白組", nil, false)
+
+	name := "赤組"
+	_, err := db.UpdateTeam(strconv.Itoa(white.ID), structs.TeamUpdate{Name: &name})
+	if !errors.Is(err, structs.ErrTeamNameTaken) {
+		t.Errorf("UpdateTeam() error = %v, want ErrTeamNameTaken", err)
+	}
+}
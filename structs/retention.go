@@ -0,0 +1,96 @@
+package structs
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RetentionModePurge   = "purge"
+	RetentionModeCoarsen = "coarsen"
+)
+
+// RetentionRun records what a retention pass did to one game's location history.
+type RetentionRun struct {
+	ID        int       `gorm:"primaryKey,autoIncrement"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	GameID    int       `gorm:"not null;index"`
+	Mode      string    `gorm:"not null"`
+	Affected  int64     `gorm:"not null"`
+	// RecordedBefore は処理対象になった位置情報の登録日時の上限（試合終了時刻）
+	RecordedBefore time.Time `gorm:"not null"`
+}
+
+// gameGeolocations selects the location history recorded for the game, by the game of
+// the player's team when the location was submitted. It does not look at the players'
+// current teams, which may have moved on to another game since, and leaves alone the
+// locations of other games played at the same time.
+func gameGeolocations(tx *gorm.DB, game *Game) *gorm.DB {
+	return tx.Model(&Geolocation{}).Where("game_id = ?", game.ID)
+}
+
+// ApplyRetention purges or coarsens the location history of every game whose
+// retention period has passed, and records a RetentionRun for each game it touched.
+// Games without EndAt are skipped.
+func (db *Database) ApplyRetention(now time.Time) ([]RetentionRun, error) {
+	var games []Game
+	if err := db.Where("retention_days IS NOT NULL AND end_at IS NOT NULL").Find(&games).Error; err != nil {
+		return nil, err
+	}
+
+	var runs []RetentionRun
+	for _, game := range games {
+		if now.Before(game.EndAt.AddDate(0, 0, *game.RetentionDays)) {
+			continue
+		}
+
+		run := RetentionRun{
+			GameID:         game.ID,
+			Mode:           game.RetentionMode,
+			RecordedBefore: *game.EndAt,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var result *gorm.DB
+			switch game.RetentionMode {
+			case RetentionModePurge:
+				result = gameGeolocations(tx, &game).Delete(&Geolocation{})
+			case RetentionModeCoarsen:
+				// 小数点以下 CoarsenDigits 桁に丸める（2 桁でおよそ 1km）
+				result = gameGeolocations(tx, &game).
+					Where("coarsened = ?", false).
+					Updates(map[string]interface{}{
+						"latitude":  gorm.Expr("ROUND(CAST(latitude AS NUMERIC), ?)", game.CoarsenDigits),
+						"longitude": gorm.Expr("ROUND(CAST(longitude AS NUMERIC), ?)", game.CoarsenDigits),
+						"coarsened": true,
+					})
+			default:
+				return fmt.Errorf("game %d has unknown retention mode %q", game.ID, game.RetentionMode)
+			}
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			run.Affected = result.RowsAffected
+			return tx.Create(&run).Error
+		})
+		if err != nil {
+			return runs, err
+		}
+		if run.Affected > 0 {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+func (db *Database) ListRetentionRuns(limit int) ([]RetentionRun, error) {
+	var runs []RetentionRun
+	if err := db.Order("created_at DESC").Limit(limit).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
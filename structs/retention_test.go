@@ -0,0 +1,98 @@
+package structs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func TestApplyRetentionOnlyTouchesItsGame(t *testing.T) {
+	db := newTestDatabase(t)
+	start := time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(8 * time.Hour)
+	days := 30
+	purged := &structs.Game{Name: "夏の陣", StartAt: &start, EndAt: &end, RetentionDays: &days, RetentionMode: structs.RetentionModePurge}
+	// 同じ時間帯に別の会場で行われ、位置情報を保持し続ける試合
+	kept := &structs.Game{Name: "夏の陣（別会場）", StartAt: &start, EndAt: &end}
+	for _, game := range []*structs.Game{purged, kept} {
+		if err := db.Create(game).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTeam(t, db, "赤組", []string{"runner"}, false)
+	createTeam(t, db, "白組", []string{"other"}, false)
+
+	add := func(userID string, gameID *int) int {
+		g, err := db.AddGeolocation(userID, gameID, 35.681236, 139.767125)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Model(g).Update("created_at", start.Add(time.Hour)).Error; err != nil {
+			t.Fatal(err)
+		}
+		return g.ID
+	}
+	target := add("runner", &purged.ID)
+	otherGame := add("other", &kept.ID)
+	noGame := add("other", nil)
+
+	// 試合の後で別のチームに移っても、試合中の位置情報は処理される
+	if err := db.Model(&structs.UserProfile{}).Where("id = ?", "runner").Update("team_id", structs.DefaultTeamID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := db.ApplyRetention(end.AddDate(0, 0, days+1))
+	if err != nil {
+		t.Fatalf("ApplyRetention() error = %v", err)
+	}
+	if len(runs) != 1 || runs[0].GameID != purged.ID || runs[0].Affected != 1 {
+		t.Fatalf("runs = %+v, want one run of game %d affecting 1 location", runs, purged.ID)
+	}
+
+	var remaining []int
+	if err := db.Model(&structs.Geolocation{}).Order("id").Pluck("id", &remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 2 || remaining[0] != otherGame || remaining[1] != noGame {
+		t.Errorf("remaining = %v, want %v (location %d should be purged)", remaining, []int{otherGame, noGame}, target)
+	}
+
+	// 処理の記録がある試合は削除できない
+	if err := db.Delete(purged).Error; err == nil {
+		t.Error("deleting a game with retention runs succeeded")
+	}
+	if runs, err := db.ListRetentionRuns(10); err != nil || len(runs) != 1 {
+		t.Errorf("ListRetentionRuns() = %+v, %v, want the run to be kept", runs, err)
+	}
+}
+
+func TestApplyRetentionWaitsForRetentionPeriod(t *testing.T) {
+	db := newTestDatabase(t)
+	start := time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(8 * time.Hour)
+	days := 30
+	game := &structs.Game{Name: "夏の陣", StartAt: &start, EndAt: &end, RetentionDays: &days, RetentionMode: structs.RetentionModeCoarsen, CoarsenDigits: 2}
+	if err := db.Create(game).Error; err != nil {
+		t.Fatal(err)
+	}
+	createTeam(t, db, "赤組", []string{"runner"}, false)
+	location := &structs.Geolocation{UserID: "runner", GameID: &game.ID, Latitude: 35.681236, Longitude: 139.767125, CreatedAt: start.Add(time.Hour)}
+	if err := db.Create(location).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if runs, err := db.ApplyRetention(end.AddDate(0, 0, days-1)); err != nil || len(runs) != 0 {
+		t.Fatalf("ApplyRetention() before the period = %+v, %v, want no runs", runs, err)
+	}
+	if _, err := db.ApplyRetention(end.AddDate(0, 0, days)); err != nil {
+		t.Fatal(err)
+	}
+	var got structs.Geolocation
+	if err := db.First(&got, location.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !got.Coarsened || got.Latitude != 35.68 || got.Longitude != 139.77 {
+		t.Errorf("location = %v, %v (coarsened %v), want 35.68, 139.77", got.Latitude, got.Longitude, got.Coarsened)
+	}
+}
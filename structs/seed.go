@@ -0,0 +1,184 @@
+package structs
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Fixture is the content of a seed file. Records with an ID that already exists are
+// updated, so the same file can be loaded again after editing it.
+type Fixture struct {
+	Games        []GameFixture        `yaml:"games" json:"games"`
+	Teams        []TeamFixture        `yaml:"teams" json:"teams"`
+	Users        []UserFixture        `yaml:"users" json:"users"`
+	Geolocations []GeolocationFixture `yaml:"geolocations" json:"geolocations"`
+}
+
+type GameFixture struct {
+	ID            int        `yaml:"id" json:"id"`
+	Name          string     `yaml:"name" json:"name"`
+	StartAt       *time.Time `yaml:"start_at" json:"start_at"`
+	EndAt         *time.Time `yaml:"end_at" json:"end_at"`
+	RetentionDays *int       `yaml:"retention_days" json:"retention_days"`
+	RetentionMode string     `yaml:"retention_mode" json:"retention_mode"`
+	CoarsenDigits *int       `yaml:"coarsen_digits" json:"coarsen_digits"`
+}
+
+type TeamFixture struct {
+	ID        int     `yaml:"id" json:"id"`
+	Name      string  `yaml:"name" json:"name"`
+	GameID    *int    `yaml:"game_id" json:"game_id"`
+	Color     string  `yaml:"color" json:"color"`
+	Icon      string  `yaml:"icon" json:"icon"`
+	Motto     string  `yaml:"motto" json:"motto"`
+	CaptainID *string `yaml:"captain_id" json:"captain_id"`
+}
+
+type UserFixture struct {
+	ID               string `yaml:"id" json:"id"`
+	Email            string `yaml:"email" json:"email"`
+	Role             string `yaml:"role" json:"role"`
+	UserName         string `yaml:"user_name" json:"user_name"`
+	TeamID           int    `yaml:"team_id" json:"team_id"`
+	Phone            string `yaml:"phone" json:"phone"`
+	EmergencyContact string `yaml:"emergency_contact" json:"emergency_contact"`
+}
+
+type GeolocationFixture struct {
+	ID        int        `yaml:"id" json:"id"`
+	UserID    string     `yaml:"user_id" json:"user_id"`
+	GameID    *int       `yaml:"game_id" json:"game_id"`
+	Latitude  float64    `yaml:"latitude" json:"latitude"`
+	Longitude float64    `yaml:"longitude" json:"longitude"`
+	CreatedAt *time.Time `yaml:"created_at" json:"created_at"`
+}
+
+// SeedResult counts the records written by Seed.
+type SeedResult struct {
+	Games        int
+	Teams        int
+	Users        int
+	Geolocations int
+}
+
+// Seed writes the fixture in one transaction. Values are expected to be validated
+// by the caller.
+func (db *Database) Seed(fixture *Fixture) (*SeedResult, error) {
+	result := &SeedResult{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		upsert := func() *gorm.DB {
+			return tx.Clauses(clause.OnConflict{UpdateAll: true})
+		}
+
+		for _, g := range fixture.Games {
+			game := Game{
+				ID:            g.ID,
+				Name:          g.Name,
+				StartAt:       g.StartAt,
+				EndAt:         g.EndAt,
+				RetentionDays: g.RetentionDays,
+				RetentionMode: g.RetentionMode,
+				CoarsenDigits: 2,
+			}
+			if game.RetentionMode == "" {
+				game.RetentionMode = RetentionModePurge
+			}
+			if g.CoarsenDigits != nil {
+				game.CoarsenDigits = *g.CoarsenDigits
+			}
+			if err := upsert().Create(&game).Error; err != nil {
+				return fmt.Errorf("game %q: %w", g.Name, err)
+			}
+			result.Games++
+		}
+
+		// リーダーはメンバーの登録後に設定する
+		for _, t := range fixture.Teams {
+			team := Team{
+				ID:     t.ID,
+				Name:   t.Name,
+				GameID: t.GameID,
+				Color:  t.Color,
+				Icon:   t.Icon,
+				Motto:  t.Motto,
+			}
+			if err := upsert().Omit("captain_id").Create(&team).Error; err != nil {
+				return fmt.Errorf("team %q: %w", t.Name, err)
+			}
+			result.Teams++
+		}
+
+		for _, u := range fixture.Users {
+			user := User{ID: u.ID, Email: u.Email, IsExist: true, Role: u.Role}
+			if user.Role == "" {
+				user.Role = "player"
+			}
+			if err := upsert().Create(&user).Error; err != nil {
+				return fmt.Errorf("user %q: %w", u.ID, err)
+			}
+			userProfile := UserProfile{
+				ID:               u.ID,
+				UserName:         u.UserName,
+				TeamID:           u.TeamID,
+				AvatarSource:     AvatarSourceNone,
+				Phone:            u.Phone,
+				EmergencyContact: u.EmergencyContact,
+			}
+			if userProfile.UserName == "" {
+				userProfile.UserName = DefaultUserName
+			}
+			if userProfile.TeamID == 0 {
+				userProfile.TeamID = DefaultTeamID
+			}
+			if err := upsert().Create(&userProfile).Error; err != nil {
+				return fmt.Errorf("user profile %q: %w", u.ID, err)
+			}
+			result.Users++
+		}
+
+		for _, t := range fixture.Teams {
+			if t.CaptainID == nil {
+				continue
+			}
+			if err := tx.Model(&Team{}).Where("id = ?", t.ID).Update("captain_id", t.CaptainID).Error; err != nil {
+				return fmt.Errorf("captain of team %q: %w", t.Name, err)
+			}
+		}
+
+		for _, g := range fixture.Geolocations {
+			geolocation := Geolocation{
+				ID:        g.ID,
+				UserID:    g.UserID,
+				GameID:    g.GameID,
+				Latitude:  g.Latitude,
+				Longitude: g.Longitude,
+			}
+			if g.CreatedAt != nil {
+				geolocation.CreatedAt = *g.CreatedAt
+			}
+			if err := upsert().Create(&geolocation).Error; err != nil {
+				return fmt.Errorf("geolocation of user %q: %w", g.UserID, err)
+			}
+			result.Geolocations++
+		}
+
+		// ID を指定して挿入した場合、Postgres のシーケンスは進まない
+		if tx.Dialector.Name() == "postgres" {
+			for _, table := range []string{"games", "teams", "geolocations"} {
+				if err := tx.Exec(fmt.Sprintf(
+					`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), GREATEST((SELECT MAX("id") FROM "%[1]s"), 1))`, table,
+				)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
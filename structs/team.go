@@ -0,0 +1,102 @@
+package structs
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTeamNameTaken    = errors.New("team name is already used")
+	ErrCaptainNotMember = errors.New("captain must be a member of the team")
+)
+
+// TeamUpdate lists the fields to change. Nil fields are left as they are.
+// Values are expected to be validated by the caller.
+type TeamUpdate struct {
+	Name      *string
+	Color     *string
+	Icon      *string
+	Motto     *string
+	CaptainID *string // 空文字ならリーダーを外す
+}
+
+func (db *Database) GetTeamByID(teamID string) (*Team, error) {
+	var team Team
+	if err := db.First(&team, "id = ?", teamID).Error; err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// CanEdit reports whether the user may edit the team. Admins can edit any team;
+// otherwise only the captain can. Teams without a captain and チーム未設定 are
+// admin-only, so the first captain is always appointed by an admin.
+func (t *Team) CanEdit(userID string, isAdmin bool) bool {
+	if isAdmin {
+		return true
+	}
+	if t.ID == DefaultTeamID || t.CaptainID == nil {
+		return false
+	}
+	return *t.CaptainID == userID
+}
+
+func (db *Database) isActiveTeamMember(tx *gorm.DB, teamID int, userID string) (bool, error) {
+	var count int64
+	if err := tx.Model(&UserProfile{}).
+		Where("id = ? AND team_id = ?", userID, teamID).
+		Where("id IN (?)", tx.Model(&User{}).Select("id").Where("is_exist = ?", true)).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (db *Database) UpdateTeam(teamID string, update TeamUpdate) (*Team, error) {
+	var team Team
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&team, "id = ?", teamID).Error; err != nil {
+			return err
+		}
+
+		if update.Name != nil {
+			team.Name = *update.Name
+		}
+		if update.Color != nil {
+			team.Color = *update.Color
+		}
+		if update.Icon != nil {
+			team.Icon = *update.Icon
+		}
+		if update.Motto != nil {
+			team.Motto = *update.Motto
+		}
+		if update.CaptainID != nil {
+			if *update.CaptainID == "" {
+				team.CaptainID = nil
+			} else {
+				ok, err := db.isActiveTeamMember(tx, team.ID, *update.CaptainID)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return ErrCaptainNotMember
+				}
+				captainID := *update.CaptainID
+				team.CaptainID = &captainID
+			}
+		}
+		if err := tx.Save(&team).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrTeamNameTaken
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
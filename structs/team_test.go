@@ -0,0 +1,34 @@
+package structs_test
+
+import (
+	"testing"
+
+	"github.com/m-tsuru/tenchi-geolocation/structs"
+)
+
+func TestTeamCanEdit(t *testing.T) {
+	captain := "captain"
+	tests := []struct {
+		name    string
+		team    structs.Team
+		userID  string
+		isAdmin bool
+		want    bool
+	}{
+		{"captain", structs.Team{ID: 1, CaptainID: &captain}, "captain", false, true},
+		{"other member", structs.Team{ID: 1, CaptainID: &captain}, "member", false, false},
+		{"admin", structs.Team{ID: 1, CaptainID: &captain}, "admin", true, true},
+		// リーダーのいないチームでメンバーが自分をリーダーにできないよう、管理者だけにする
+		{"no captain", structs.Team{ID: 1}, "member", false, false},
+		{"no captain, admin", structs.Team{ID: 1}, "admin", true, true},
+		{"default team", structs.Team{ID: structs.DefaultTeamID, CaptainID: &captain}, "captain", false, false},
+		{"default team, admin", structs.Team{ID: structs.DefaultTeamID}, "admin", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.team.CanEdit(tt.userID, tt.isAdmin); got != tt.want {
+				t.Errorf("CanEdit(%q, %v) = %v, want %v", tt.userID, tt.isAdmin, got, tt.want)
+			}
+		})
+	}
+}
@@ -28,8 +28,17 @@ window.onload = function() {
   const geoBtn = document.getElementById('register-geo-btn');
   const updateBtn = document.getElementById('update-geo-btn');
 
+  // CSP でインライン属性のハンドラは使えないのでここで登録する
+  document.getElementById('reset-auth-btn').onclick = () => {
+    apiFetch('api/v1/logout', {method: 'POST'}).then(() => { location.reload(); });
+  };
+  document.getElementById('export-data-btn').onclick = () => {
+    location.href = 'api/v1/user/me/export';
+  };
+  document.getElementById('delete-account-btn').onclick = deleteAccount;
+
   // 初回ロード時に認証状態を判定
-  fetch('/api/user/me').then(res => {
+  apiFetch('api/v1/user/me').then(res => {
     if (res.status === 401 || res.status === 403) {
       isAuthenticated = false;
       geoBtn.classList.add('unauth');
@@ -46,26 +55,23 @@ window.onload = function() {
     }
     if (!marker) return alert('現在地が取得できていません');
     const {lat, lng} = marker.getLatLng();
-    fetch('/api/geo', {
+    apiFetch('api/v1/geo', {
       method: 'POST',
       headers: {'Content-Type': 'application/json'},
       body: JSON.stringify({latitude: lat, longitude: lng})
     }).then(res => {
-      if (res.status === 403) {
-        return res.text().then(msg => {
-          if (msg.includes('Request not allowed at this time')) {
+      if (!res.ok) {
+        return readError(res).then(err => {
+          if (err.code === 'outside_submission_window') {
             alert('現在は登録できません（指定された時間外です）');
             return;
           }
-          alert('登録できません: ' + msg);
+          alert('登録できません: ' + err.message);
         });
       }
-      if (!res.ok) {
-        return res.text().then(msg => alert('登録できません: ' + msg));
-      }
       return res.json();
     }).then(data => {
-      if (data && data.latitude) {
+      if (data && data.id) {
         alert('位置情報を登録しました');
       }
     });
@@ -77,16 +83,16 @@ window.onload = function() {
     geoMarkers = [];
   }
 
-  // --- /api/geo で全チームの位置を取得しマップに描画 ---
+  // --- /api/v1/geo で全チームの位置を取得しマップに描画 ---
   function fetchAndShowAllTeamsGeo() {
     let myTeamId = null;
     // まず自分のチームIDを取得
-    fetch('/api/user/me').then(res => {
+    apiFetch('api/v1/user/me').then(res => {
       if (!res.ok) throw new Error('ユーザー情報の取得に失敗しました (ログインしていますか？)');
       return res.json();
     }).then(userData => {
-      myTeamId = userData.team.id || userData.team.ID || null;
-      return fetch('/api/geo');
+      myTeamId = userData.team.id;
+      return apiFetch('api/v1/geo');
     }).then(res => {
       if (!res.ok) throw new Error('位置情報の取得に失敗しました');
       return res.json();
@@ -94,24 +100,29 @@ window.onload = function() {
       clearGeoMarkers();
       if (!Array.isArray(data)) return;
       data.forEach(detail => {
-        const geo = detail.Geolocation || detail.geolocation;
-        const team = (detail.TeamDetail || detail.team_detail || detail).Team || detail.team;
+        const geo = detail.geolocation;
+        const team = detail.team;
         if (!geo || !team) return;
-        const lat = geo.Latitude || geo.latitude;
-        const lng = geo.Longitude || geo.longitude;
-        const teamName = team.Name || team.name || 'チーム';
-        const teamId = team.ID || team.id;
-        const time = geo.CreatedAt || geo.created_at || '';
-        // マーカー色: 自分のチームは青, 他は緑
-        let markerColor = (myTeamId && teamId && String(myTeamId) === String(teamId)) ? '#3498db' : '#27ae60';
+        const lat = geo.latitude;
+        const lng = geo.longitude;
+        const teamName = escapeHTML(team.name || 'チーム');
+        const teamId = team.id;
+        const teamIcon = escapeHTML(team.icon);
+        const teamMotto = escapeHTML(team.motto);
+        const time = geo.created_at || '';
+        // マーカー色: チームの色。未設定なら自分のチームは青, 他は緑
+        const isMyTeam = myTeamId && teamId && String(myTeamId) === String(teamId);
+        const markerColor = team.color || (isMyTeam ? '#3498db' : '#27ae60');
+        // 自分のチームは枠を太くして見分ける
+        const border = isMyTeam ? '4px solid #2c3e50' : '2px solid #fff';
         const icon = L.divIcon({
           className: '',
-          html: `<div style="background:${markerColor};width:22px;height:22px;border-radius:50%;border:2px solid #fff;box-shadow:0 2px 6px #0002;"></div>`,
+          html: `<div style="background:${markerColor};width:22px;height:22px;border-radius:50%;border:${border};box-shadow:0 2px 6px #0002;display:flex;align-items:center;justify-content:center;font-size:13px;">${teamIcon}</div>`,
           iconSize: [22,22],
           iconAnchor: [11,11],
         });
         const m = L.marker([lat, lng], {icon}).addTo(map)
-          .bindPopup(`<b>${teamName}</b><br>(${lat.toFixed(5)}, ${lng.toFixed(5)})<br>${time ? '更新: '+time : ''}`);
+          .bindPopup(`<b>${teamIcon} ${teamName}</b>${teamMotto ? '<br><i>' + teamMotto + '</i>' : ''}<br>(${lat.toFixed(5)}, ${lng.toFixed(5)})<br>${time ? '更新: '+time : ''}`);
         geoMarkers.push(m);
       });
       setMapUpdateTime();
@@ -145,7 +156,7 @@ window.onload = function() {
       e.stopPropagation();
       drawer.classList.add('open');
       // ドロワーを開くたびにユーザ情報を取得・描画
-      fetch('/api/user/me').then(res => {
+      apiFetch('api/v1/user/me').then(res => {
         if (res.status === 401 || res.status === 403) {
           // 認証エラー時はログインボタンのみ表示
           document.querySelector('.drawer-content').innerHTML = `
@@ -154,7 +165,7 @@ window.onload = function() {
             </div>
           `;
           document.getElementById('login-btn').onclick = () => {
-            window.location.href = '/api/login';
+            window.location.href = 'api/v1/login';
           };
           return;
         }
@@ -163,54 +174,130 @@ window.onload = function() {
         if (!data) return;
         // プロフィール
         const teamNameElem = document.getElementById('drawer-profile-team');
-        teamNameElem.textContent = data.team.name || data.team.Name || '';
+        teamNameElem.textContent = data.team.name;
         teamNameElem.style.cursor = 'pointer';
         teamNameElem.title = 'タップしてチーム名を変更';
         teamNameElem.onclick = () => {
           const current = teamNameElem.textContent;
           const newName = prompt('新しいチーム名を入力してください', current);
           if (newName && newName !== current) {
-            fetch(`/api/team/${data.team.id || data.team.ID}`, {
+            apiFetch(`api/v1/team/${data.team.id}`, {
               method: 'POST',
               headers: { 'Content-Type': 'application/json' },
               body: JSON.stringify({ name: newName })
             })
             .then(res => {
+              if (res.status === 403) throw new Error('チームリーダーのみ変更できます');
               if (!res.ok) throw new Error('チーム名の変更に失敗しました');
               return res.json();
             })
             .then(team => {
-              teamNameElem.textContent = team.name || team.Name || newName;
+              teamNameElem.textContent = team.name || newName;
               alert('チーム名を変更しました');
             })
             .catch(e => alert(e.message || 'チーム名の変更に失敗しました'));
           }
         };
-        document.getElementById('drawer-profile-avatar').src = data.user_profile.avatar_url || data.user_profile.AvatarURL || 'https://www.gravatar.com/avatar/?d=mp';
+        const avatarElem = document.getElementById('drawer-profile-avatar');
+        avatarElem.src = data.user_profile.avatar_url || 'https://www.gravatar.com/avatar/?d=mp';
+        avatarElem.style.cursor = 'pointer';
+        avatarElem.title = 'タップしてアバターを変更';
+        avatarElem.onclick = () => {
+          const input = document.createElement('input');
+          input.type = 'file';
+          input.accept = 'image/png,image/jpeg,image/gif,image/webp';
+          input.onchange = () => {
+            if (!input.files.length) return;
+            const form = new FormData();
+            form.append('avatar', input.files[0]);
+            apiFetch('api/v1/user/me', { method: 'PATCH', body: form })
+            .then(res => {
+              if (!res.ok) return readError(res).then(err => { throw new Error(err.message); });
+              return res.json();
+            })
+            .then(result => {
+              avatarElem.src = result.user_profile.avatar_url || avatarElem.src;
+              alert('アバターを変更しました');
+            })
+            .catch(e => alert('アバターの変更に失敗しました: ' + e.message));
+          };
+          input.click();
+        };
+        const contactBtn = document.getElementById('edit-contact-btn');
+        if (contactBtn) {
+          contactBtn.onclick = () => {
+            const contact = data.contact || {};
+            const phone = prompt('緊急時の電話番号を入力してください（運営のみ閲覧できます）', contact.phone);
+            if (phone === null) return;
+            const emergencyContact = prompt('緊急連絡先（保護者の氏名・連絡先など）を入力してください', contact.emergency_contact || '');
+            if (emergencyContact === null) return;
+            apiFetch('api/v1/user/me', {
+              method: 'PATCH',
+              headers: { 'Content-Type': 'application/json' },
+              body: JSON.stringify({ phone: phone, emergency_contact: emergencyContact })
+            })
+            .then(res => {
+              if (!res.ok) return readError(res).then(err => { throw new Error(err.message); });
+              return res.json();
+            })
+            .then(result => {
+              data.contact = result.contact;
+              alert('緊急連絡先を登録しました');
+            })
+            .catch(e => alert('緊急連絡先の登録に失敗しました: ' + e.message));
+          };
+        }
         const userNameElem = document.getElementById('drawer-profile-username');
-        userNameElem.textContent = data.user_profile.user_name || data.user_profile.UserName || '';
+        userNameElem.textContent = data.user_profile.user_name;
         userNameElem.style.cursor = 'pointer';
         userNameElem.title = 'タップしてユーザ名を変更';
         userNameElem.onclick = () => {
           const current = userNameElem.textContent;
           const newName = prompt('新しいユーザ名を入力してください', current);
           if (newName && newName !== current) {
-            fetch('/api/user/me/name', {
+            apiFetch('api/v1/user/me/name', {
               method: 'POST',
               headers: { 'Content-Type': 'application/json' },
               body: JSON.stringify({ name: newName })
             })
             .then(res => {
+              if (res.status === 409) throw new Error('チーム内で同じユーザ名が使われています');
               if (!res.ok) throw new Error('ユーザ名の変更に失敗しました');
               return res.json();
             })
             .then(profile => {
-              userNameElem.textContent = profile.user_name || profile.UserName || newName;
+              userNameElem.textContent = profile.user_name || newName;
               alert('ユーザ名を変更しました');
             })
             .catch(e => alert(e.message || 'ユーザ名の変更に失敗しました'));
           }
         };
+        const teamSettingsBtn = document.getElementById('edit-team-btn');
+        if (teamSettingsBtn) {
+          teamSettingsBtn.onclick = () => {
+            const color = prompt('チームの色を #RRGGBB 形式で入力してください', data.team.color);
+            if (color === null) return;
+            const icon = prompt('チームのアイコン（絵文字 1 文字）を入力してください', data.team.icon);
+            if (icon === null) return;
+            const motto = prompt('チームのモットーを入力してください', data.team.motto);
+            if (motto === null) return;
+            apiFetch(`api/v1/team/${data.team.id}`, {
+              method: 'POST',
+              headers: { 'Content-Type': 'application/json' },
+              body: JSON.stringify({ color: color, icon: icon, motto: motto })
+            })
+            .then(res => {
+              if (res.status === 403) throw new Error('チームリーダーのみ変更できます');
+              if (!res.ok) return readError(res).then(err => { throw new Error(err.message); });
+              return res.json();
+            })
+            .then(team => {
+              data.team = team;
+              alert('チームの設定を変更しました');
+            })
+            .catch(e => alert('チームの設定の変更に失敗しました: ' + e.message));
+          };
+        }
         // チームメンバー
         const users = data.team_members || [];
         const ul = document.getElementById('drawer-team-users');
@@ -219,8 +306,8 @@ window.onload = function() {
           const li = document.createElement('li');
           li.className = 'drawer-team-user';
           li.innerHTML = `
-            <img class="drawer-team-user-avatar" src="${member.avatar_url || member.AvatarURL || 'https://www.gravatar.com/avatar/?d=mp'}" alt="avatar" />
-            <span class="drawer-team-user-name">${member.user_name || member.UserName || ''}</span>
+            <img class="drawer-team-user-avatar" src="${escapeHTML(member.avatar_url || 'https://www.gravatar.com/avatar/?d=mp')}" alt="avatar" />
+            <span class="drawer-team-user-name">${escapeHTML(member.user_name)}</span>
           `;
           ul.appendChild(li);
         });
@@ -242,6 +329,40 @@ window.onload = function() {
   }
 };
 
+// 状態を変えるリクエストには Cookie の CSRF トークンを X-CSRF-Token ヘッダで送る。
+// URL はページからの相対パスで書き、BasePath の下に置いても動くようにする
+function apiFetch(url, options = {}) {
+  const method = (options.method || 'GET').toUpperCase();
+  if (method !== 'GET' && method !== 'HEAD') {
+    options.headers = Object.assign({'X-CSRF-Token': getCookie('csrf_token')}, options.headers);
+  }
+  return fetch(url, options);
+}
+
+function getCookie(name) {
+  const cookie = document.cookie.split('; ').find(c => c.startsWith(name + '='));
+  return cookie ? decodeURIComponent(cookie.slice(name.length + 1)) : '';
+}
+
+// API のエラーレスポンス {code, message, details} を読む
+function readError(res) {
+  return res.json().catch(() => ({code: 'unknown', message: res.statusText}));
+}
+
+function escapeHTML(str) {
+  return String(str).replace(/[&<>"']/g, c => ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'}[c]));
+}
+
+function deleteAccount() {
+  if (!confirm('アカウントを削除しますか？プロフィールは匿名化されます。')) return;
+  const purge = confirm('登録した位置情報の履歴も削除しますか？');
+  apiFetch(`api/v1/user/me?purge_locations=${purge}`, {method: 'DELETE'}).then(res => {
+    if (!res.ok) return readError(res).then(err => alert('削除できません: ' + err.message));
+    alert('アカウントを削除しました');
+    location.reload();
+  });
+}
+
 function deleteAllSiteCookies() {
     const cookies = document.cookie.split(';');
     for (let cookie of cookies) {